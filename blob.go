@@ -5,16 +5,39 @@ import (
 	"context"
 	"io"
 
+	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 )
 
+type blobOpt struct {
+	progress func(types.Progress)
+}
+
+// BlobOpts define options for the Blob* commands
+type BlobOpts func(*blobOpt)
+
+// BlobWithProgress calls cb with the bytes transferred, or when the blob is skipped.
+func BlobWithProgress(cb func(types.Progress)) BlobOpts {
+	return func(opts *blobOpt) {
+		opts.progress = cb
+	}
+}
+
 // BlobCopy copies a blob between two locations
 // If the blob already exists in the target, the copy is skipped
 // A server side cross repository blob mount is attempted
-func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor) error {
+func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, opts ...BlobOpts) error {
+	var opt blobOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	return rc.blobCopy(ctx, refSrc, refTgt, d, newProgress(opt.progress))
+}
+
+func (rc *RegClient) blobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Ref, d types.Descriptor, p *progress) error {
 	tDesc := d
 	tDesc.URLs = []string{} // ignore URLs when pushing to target
 	// for the same repository, there's nothing to copy
@@ -24,6 +47,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d.Digest,
 		}).Debug("Blob copy skipped, same repo")
+		p.blobSkipped(d)
 		return nil
 	}
 	// check if layer already exists
@@ -32,6 +56,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt":    refTgt.Reference,
 			"digest": d,
 		}).Debug("Blob copy skipped, already exists")
+		p.blobSkipped(d)
 		return nil
 	}
 	// try mounting blob from the source repo is the registry is the same
@@ -43,6 +68,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 				"tgt":    refTgt.Reference,
 				"digest": d,
 			}).Debug("Blob copy performed server side with registry mount")
+			p.blobSkipped(d)
 			return nil
 		}
 		rc.log.WithFields(logrus.Fields{
@@ -51,6 +77,11 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 			"tgt": refTgt.Reference,
 		}).Warn("Failed to mount blob")
 	}
+	// try mounting blob from other repositories known to hold it
+	if rc.blobMountKnown(ctx, refTgt, tDesc) {
+		p.blobSkipped(d)
+		return nil
+	}
 	// fast options failed, download layer from source and push to target
 	blobIO, err := rc.BlobGet(ctx, refSrc, d)
 	if err != nil {
@@ -62,7 +93,12 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 		return err
 	}
 	defer blobIO.Close()
-	if _, err := rc.BlobPut(ctx, refTgt, blobIO.GetDescriptor(), blobIO); err != nil {
+	schemeAPI, err := rc.schemeGet(refTgt.Scheme)
+	if err != nil {
+		return err
+	}
+	pr := p.reader(d, blobIO)
+	if _, err := rc.blobPut(ctx, schemeAPI, refTgt, blobIO.GetDescriptor(), pr); err != nil {
 		rc.log.WithFields(logrus.Fields{
 			"err": err,
 			"src": refSrc.Reference,
@@ -70,6 +106,7 @@ func (rc *RegClient) BlobCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.Re
 		}).Warn("Failed to push blob")
 		return err
 	}
+	pr.finish()
 	return nil
 }
 
@@ -85,16 +122,25 @@ func (rc *RegClient) BlobDelete(ctx context.Context, r ref.Ref, d types.Descript
 }
 
 // BlobGet retrieves a blob, returning a reader
+// With WithBlobCache, the blob is read from the cache when available and added to the cache after it is read.
 func (rc *RegClient) BlobGet(ctx context.Context, r ref.Ref, d types.Descriptor) (blob.Reader, error) {
 	data, err := d.GetData()
 	if err == nil {
 		return blob.NewReader(blob.WithDesc(d), blob.WithRef(r), blob.WithReader(bytes.NewReader(data))), nil
 	}
+	if b := rc.cacheBlobGet(r, d); b != nil {
+		return b, nil
+	}
 	schemeAPI, err := rc.schemeGet(r.Scheme)
 	if err != nil {
 		return nil, err
 	}
-	return schemeAPI.BlobGet(ctx, r, d)
+	b, err := schemeAPI.BlobGet(ctx, r, d)
+	if err != nil {
+		return nil, err
+	}
+	rc.blobLocs.add(r, d)
+	return rc.cacheBlobTee(r, b), nil
 }
 
 // BlobGetOCIConfig retrieves an OCI config from a blob, automatically extracting the JSON
@@ -112,7 +158,11 @@ func (rc *RegClient) BlobHead(ctx context.Context, r ref.Ref, d types.Descriptor
 	if err != nil {
 		return nil, err
 	}
-	return schemeAPI.BlobHead(ctx, r, d)
+	b, err := schemeAPI.BlobHead(ctx, r, d)
+	if err == nil {
+		rc.blobLocs.add(r, d)
+	}
+	return b, err
 }
 
 // BlobMount attempts to perform a server side copy/mount of the blob between repositories
@@ -121,17 +171,34 @@ func (rc *RegClient) BlobMount(ctx context.Context, refSrc ref.Ref, refTgt ref.R
 	if err != nil {
 		return err
 	}
-	return schemeAPI.BlobMount(ctx, refSrc, refTgt, d)
+	err = schemeAPI.BlobMount(ctx, refSrc, refTgt, d)
+	if err == nil {
+		rc.blobLocs.add(refTgt, d)
+	}
+	return err
 }
 
 // BlobPut uploads a blob to a repository.
 // This will attempt an anonymous blob mount first which some registries may support.
 // It will then try doing a full put of the blob without chunking (most widely supported).
 // If the full put fails, it will fall back to a chunked upload (useful for flaky networks).
+// With WithBlobLocationCache, a mount from a repository known to hold the blob is attempted first.
 func (rc *RegClient) BlobPut(ctx context.Context, ref ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
 	schemeAPI, err := rc.schemeGet(ref.Scheme)
 	if err != nil {
 		return types.Descriptor{}, err
 	}
-	return schemeAPI.BlobPut(ctx, ref, d, rdr)
+	if d.Digest != "" && d.Size > 0 && rc.blobMountKnown(ctx, ref, d) {
+		return d, nil
+	}
+	return rc.blobPut(ctx, schemeAPI, ref, d, rdr)
+}
+
+// blobPut uploads the blob with the scheme, skipping the mount from known locations
+func (rc *RegClient) blobPut(ctx context.Context, schemeAPI scheme.API, ref ref.Ref, d types.Descriptor, rdr io.Reader) (types.Descriptor, error) {
+	dp, err := schemeAPI.BlobPut(ctx, ref, d, rdr)
+	if err == nil {
+		rc.blobLocs.add(ref, dp)
+	}
+	return dp, err
 }
@@ -0,0 +1,152 @@
+package regclient
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// blobLocLimit is the number of repositories tracked for each digest
+const blobLocLimit = 5
+
+// blobLocDigestLimit is the number of digests tracked, the least recently used digest is removed first
+const blobLocDigestLimit = 10000
+
+// blobLocations tracks which repositories on a registry are known to hold a blob.
+// A nil blobLocations is valid and tracks nothing.
+type blobLocations struct {
+	mu    sync.Mutex
+	limit int
+	lru   *list.List                   // *blobLocEntry, most recently used first
+	known map[blobLocKey]*list.Element // registry and digest -> entry in lru
+}
+
+type blobLocKey struct {
+	registry string
+	digest   string
+}
+
+type blobLocEntry struct {
+	key   blobLocKey
+	repos []string // most recent last
+}
+
+func newBlobLocations() *blobLocations {
+	return &blobLocations{
+		limit: blobLocDigestLimit,
+		lru:   list.New(),
+		known: map[blobLocKey]*list.Element{},
+	}
+}
+
+// add records the repository of r as holding the blob, only registry refs are tracked
+func (bl *blobLocations) add(r ref.Ref, d types.Descriptor) {
+	if bl == nil || r.Scheme != "reg" || d.Digest == "" {
+		return
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	key := blobLocKey{registry: r.Registry, digest: d.Digest.String()}
+	el, ok := bl.known[key]
+	if !ok {
+		el = bl.lru.PushFront(&blobLocEntry{key: key})
+		bl.known[key] = el
+	} else {
+		bl.lru.MoveToFront(el)
+	}
+	entry := el.Value.(*blobLocEntry)
+	for i, repo := range entry.repos {
+		if repo == r.Repository {
+			entry.repos = append(entry.repos[:i], entry.repos[i+1:]...)
+			break
+		}
+	}
+	entry.repos = append(entry.repos, r.Repository)
+	if len(entry.repos) > blobLocLimit {
+		entry.repos = entry.repos[len(entry.repos)-blobLocLimit:]
+	}
+	for bl.limit > 0 && bl.lru.Len() > bl.limit {
+		oldest := bl.lru.Back()
+		bl.lru.Remove(oldest)
+		delete(bl.known, oldest.Value.(*blobLocEntry).key)
+	}
+}
+
+// repos returns other repositories on the registry of r known to hold the blob, most recent first
+func (bl *blobLocations) repos(r ref.Ref, d types.Descriptor) []string {
+	if bl == nil || r.Scheme != "reg" || d.Digest == "" {
+		return nil
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	el, ok := bl.known[blobLocKey{registry: r.Registry, digest: d.Digest.String()}]
+	if !ok {
+		return []string{}
+	}
+	bl.lru.MoveToFront(el)
+	repos := el.Value.(*blobLocEntry).repos
+	result := make([]string, 0, len(repos))
+	for i := len(repos) - 1; i >= 0; i-- {
+		if repos[i] != r.Repository {
+			result = append(result, repos[i])
+		}
+	}
+	return result
+}
+
+// remove deletes the repository of r from the locations of the blob
+func (bl *blobLocations) remove(r ref.Ref, d types.Descriptor) {
+	if bl == nil || r.Scheme != "reg" || d.Digest == "" {
+		return
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	key := blobLocKey{registry: r.Registry, digest: d.Digest.String()}
+	el, ok := bl.known[key]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*blobLocEntry)
+	for i, repo := range entry.repos {
+		if repo == r.Repository {
+			entry.repos = append(entry.repos[:i], entry.repos[i+1:]...)
+			break
+		}
+	}
+	if len(entry.repos) == 0 {
+		bl.lru.Remove(el)
+		delete(bl.known, key)
+	}
+}
+
+// blobMountKnown attempts to mount the blob into r from other repositories known to hold it.
+// Repositories that fail to mount are removed from the cache.
+func (rc *RegClient) blobMountKnown(ctx context.Context, r ref.Ref, d types.Descriptor) bool {
+	for _, repo := range rc.blobLocs.repos(r, d) {
+		rSrc := r
+		rSrc.Repository = repo
+		rSrc.Tag = ""
+		rSrc.Digest = ""
+		err := rc.BlobMount(ctx, rSrc, r, d)
+		if err == nil {
+			rc.log.WithFields(logrus.Fields{
+				"src":    rSrc.CommonName(),
+				"tgt":    r.CommonName(),
+				"digest": d.Digest,
+			}).Debug("Blob mounted from known location")
+			return true
+		}
+		rc.log.WithFields(logrus.Fields{
+			"err":    err,
+			"src":    rSrc.CommonName(),
+			"tgt":    r.CommonName(),
+			"digest": d.Digest,
+		}).Debug("Failed to mount blob from known location")
+		rc.blobLocs.remove(rSrc, d)
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package regclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/reqresp"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBlobLocations(t *testing.T) {
+	d1, _ := reqresp.NewRandomBlob(64, 1)
+	d2, _ := reqresp.NewRandomBlob(64, 2)
+	desc1 := types.Descriptor{Digest: d1, Size: 64}
+	desc2 := types.Descriptor{Digest: d2, Size: 64}
+	newRef := func(s string) ref.Ref {
+		r, err := ref.New(s)
+		if err != nil {
+			t.Fatalf("failed to parse ref %s: %v", s, err)
+		}
+		return r
+	}
+	rA := newRef("registry.example.org/proj/a")
+	rB := newRef("registry.example.org/proj/b")
+	rC := newRef("registry.example.org/proj/c:v1")
+	rOther := newRef("other.example.org/proj/b")
+	rOCI := newRef("ocidir://testrepo")
+
+	t.Run("nil", func(t *testing.T) {
+		var bl *blobLocations
+		bl.add(rA, desc1)
+		bl.remove(rA, desc1)
+		if repos := bl.repos(rB, desc1); len(repos) != 0 {
+			t.Errorf("unexpected repos: %v", repos)
+		}
+	})
+	t.Run("add", func(t *testing.T) {
+		bl := newBlobLocations()
+		bl.add(rA, desc1)
+		bl.add(rC, desc1)
+		bl.add(rA, desc1)
+		bl.add(rOCI, desc1)
+		bl.add(rB, desc2)
+		tests := []struct {
+			name   string
+			r      ref.Ref
+			d      types.Descriptor
+			expect []string
+		}{
+			{name: "most recent first", r: rB, d: desc1, expect: []string{"proj/a", "proj/c"}},
+			{name: "exclude target", r: rA, d: desc1, expect: []string{"proj/c"}},
+			{name: "other digest", r: rA, d: desc2, expect: []string{"proj/b"}},
+			{name: "other registry", r: rOther, d: desc1, expect: []string{}},
+			{name: "ocidir", r: rOCI, d: desc1, expect: []string{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				repos := bl.repos(tt.r, tt.d)
+				if !stringSliceEq(repos, tt.expect) {
+					t.Errorf("unexpected repos, expected %v, received %v", tt.expect, repos)
+				}
+			})
+		}
+	})
+	t.Run("limit", func(t *testing.T) {
+		bl := newBlobLocations()
+		for i := 0; i < blobLocLimit+2; i++ {
+			bl.add(newRef(fmt.Sprintf("registry.example.org/proj/repo%d", i)), desc1)
+		}
+		repos := bl.repos(rA, desc1)
+		if len(repos) != blobLocLimit {
+			t.Fatalf("unexpected repo count, expected %d, received %v", blobLocLimit, repos)
+		}
+		if expect := fmt.Sprintf("proj/repo%d", blobLocLimit+1); repos[0] != expect {
+			t.Errorf("unexpected first repo, expected %s, received %s", expect, repos[0])
+		}
+	})
+	t.Run("digest limit", func(t *testing.T) {
+		bl := newBlobLocations()
+		bl.limit = 2
+		d3, _ := reqresp.NewRandomBlob(64, 3)
+		desc3 := types.Descriptor{Digest: d3, Size: 64}
+		bl.add(rA, desc1)
+		bl.add(rA, desc2)
+		// a lookup marks desc1 as recently used, so desc2 is removed when desc3 is added
+		if repos := bl.repos(rB, desc1); !stringSliceEq(repos, []string{"proj/a"}) {
+			t.Errorf("unexpected repos: %v", repos)
+		}
+		bl.add(rA, desc3)
+		if bl.lru.Len() != 2 || len(bl.known) != 2 {
+			t.Errorf("unexpected number of digests, lru %d, known %d", bl.lru.Len(), len(bl.known))
+		}
+		for _, tt := range []struct {
+			d      types.Descriptor
+			expect []string
+		}{
+			{d: desc1, expect: []string{"proj/a"}},
+			{d: desc2, expect: []string{}},
+			{d: desc3, expect: []string{"proj/a"}},
+		} {
+			if repos := bl.repos(rB, tt.d); !stringSliceEq(repos, tt.expect) {
+				t.Errorf("unexpected repos for %s, expected %v, received %v", tt.d.Digest.String(), tt.expect, repos)
+			}
+		}
+	})
+	t.Run("remove", func(t *testing.T) {
+		bl := newBlobLocations()
+		bl.add(rA, desc1)
+		bl.add(rC, desc1)
+		bl.remove(rA, desc1)
+		if repos := bl.repos(rB, desc1); !stringSliceEq(repos, []string{"proj/c"}) {
+			t.Errorf("unexpected repos after remove: %v", repos)
+		}
+		bl.remove(rC, desc1)
+		if repos := bl.repos(rB, desc1); len(repos) != 0 {
+			t.Errorf("unexpected repos after remove: %v", repos)
+		}
+		if bl.lru.Len() != 0 || len(bl.known) != 0 {
+			t.Errorf("empty entry not removed, lru %d, known %d", bl.lru.Len(), len(bl.known))
+		}
+	})
+}
+
+func TestBlobPutMountKnown(t *testing.T) {
+	ctx := context.Background()
+	blobLen := 1024
+	d1, blob1 := reqresp.NewRandomBlob(blobLen, 1)
+	d2, blob2 := reqresp.NewRandomBlob(blobLen, 2)
+	rrs := []reqresp.ReqResp{
+		// d1 exists in proj/a and is mounted to proj/b
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "HEAD for d1",
+				Method: "HEAD",
+				Path:   "/v2/proj/a/blobs/" + d1.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST mount d1 from proj/a",
+				Method: "POST",
+				Path:   "/v2/proj/b/blobs/uploads/",
+				Query: map[string][]string{
+					"mount": {d1.String()},
+					"from":  {"proj/a"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+		// d2 is listed in proj/c but the mount fails, falling back to the anonymous mount
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "HEAD for d2",
+				Method: "HEAD",
+				Path:   "/v2/proj/c/blobs/" + d2.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d2.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST mount d2 from proj/c",
+				Method: "POST",
+				Path:   "/v2/proj/d/blobs/uploads/",
+				Query: map[string][]string{
+					"mount": {d2.String()},
+					"from":  {"proj/c"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "POST anonymous mount d2",
+				Method: "POST",
+				Path:   "/v2/proj/d/blobs/uploads/",
+				Query: map[string][]string{
+					"mount": {d2.String()},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusCreated,
+			},
+		},
+	}
+	rrs = append(rrs, reqresp.BaseEntries...)
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []config.Host{
+		{
+			Name:     tsHost,
+			Hostname: tsHost,
+			TLS:      config.TLSDisabled,
+		},
+	}
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.WarnLevel,
+	}
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	rc := New(
+		WithConfigHosts(rcHosts),
+		WithLog(log),
+		WithRetryDelay(delayInit, delayMax),
+		WithRetryLimit(1),
+		WithBlobLocationCache(),
+	)
+	newRef := func(repo string) ref.Ref {
+		r, err := ref.New(tsHost + "/" + repo)
+		if err != nil {
+			t.Fatalf("failed to parse ref %s: %v", repo, err)
+		}
+		return r
+	}
+
+	t.Run("Mount", func(t *testing.T) {
+		desc := types.Descriptor{Digest: d1, Size: int64(blobLen)}
+		if _, err := rc.BlobHead(ctx, newRef("proj/a"), desc); err != nil {
+			t.Fatalf("failed to head blob: %v", err)
+		}
+		dp, err := rc.BlobPut(ctx, newRef("proj/b"), desc, bytes.NewReader(blob1))
+		if err != nil {
+			t.Fatalf("failed to put blob: %v", err)
+		}
+		if dp.Digest != d1 {
+			t.Errorf("digest mismatch, expected %s, received %s", d1, dp.Digest)
+		}
+		if repos := rc.blobLocs.repos(newRef("proj/e"), desc); !stringSliceEq(repos, []string{"proj/b", "proj/a"}) {
+			t.Errorf("unexpected known repos: %v", repos)
+		}
+	})
+	t.Run("Stale", func(t *testing.T) {
+		desc := types.Descriptor{Digest: d2, Size: int64(blobLen)}
+		if _, err := rc.BlobHead(ctx, newRef("proj/c"), desc); err != nil {
+			t.Fatalf("failed to head blob: %v", err)
+		}
+		_, err := rc.BlobPut(ctx, newRef("proj/d"), desc, bytes.NewReader(blob2))
+		if err != nil {
+			t.Fatalf("failed to put blob: %v", err)
+		}
+		if repos := rc.blobLocs.repos(newRef("proj/e"), desc); !stringSliceEq(repos, []string{"proj/d"}) {
+			t.Errorf("unexpected known repos: %v", repos)
+		}
+	})
+}
+
+func stringSliceEq(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package regclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/blobcache"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/blob"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheEnabled returns true when content for the ref should be read from and added to the blob cache
+func (rc *RegClient) cacheEnabled(r ref.Ref) bool {
+	return rc.blobCache != nil && r.Scheme == "reg"
+}
+
+// cacheBlobGet returns a blob reader from the cache, or nil on a cache miss
+func (rc *RegClient) cacheBlobGet(r ref.Ref, d types.Descriptor) blob.Reader {
+	if !rc.cacheEnabled(r) || d.Digest == "" {
+		return nil
+	}
+	rdr, size, err := rc.blobCache.Get(d.Digest)
+	if err != nil {
+		return nil
+	}
+	if d.Size == 0 {
+		d.Size = size
+	}
+	rc.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": d.Digest,
+	}).Debug("Blob read from cache")
+	return blob.NewReader(blob.WithDesc(d), blob.WithRef(r), blob.WithReader(rdr))
+}
+
+// cacheBlobTee returns a blob reader that adds the content to the cache once it is read and verified
+func (rc *RegClient) cacheBlobTee(r ref.Ref, b blob.Reader) blob.Reader {
+	d := b.GetDescriptor()
+	if !rc.cacheEnabled(r) || d.Digest == "" {
+		return b
+	}
+	w, err := rc.blobCache.Writer(d.Digest, d.Size)
+	if err != nil {
+		return b
+	}
+	return blob.NewReader(
+		blob.WithDesc(d),
+		blob.WithRef(r),
+		blob.WithHeader(b.RawHeaders()),
+		blob.WithResp(b.Response()),
+		blob.WithReader(&cacheTee{rc: rc, b: b, w: w}),
+	)
+}
+
+// cacheManifestGet returns a manifest from the cache, or nil on a cache miss
+func (rc *RegClient) cacheManifestGet(r ref.Ref) manifest.Manifest {
+	if !rc.cacheEnabled(r) || r.Digest == "" {
+		return nil
+	}
+	dig, err := digest.Parse(r.Digest)
+	if err != nil {
+		return nil
+	}
+	d := types.Descriptor{Digest: dig}
+	rdr, _, err := rc.blobCache.Get(d.Digest)
+	if err != nil {
+		return nil
+	}
+	defer rdr.Close()
+	raw, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil
+	}
+	d.MediaType = cacheManifestMediaType(raw)
+	d.Size = int64(len(raw))
+	m, err := manifest.New(
+		manifest.WithDesc(d),
+		manifest.WithRaw(raw),
+		manifest.WithRef(r),
+	)
+	if err != nil || m.GetDescriptor().Digest != d.Digest {
+		return nil
+	}
+	rc.log.WithFields(logrus.Fields{
+		"ref": r.CommonName(),
+	}).Debug("Manifest read from cache")
+	return m
+}
+
+// cacheManifestPut adds a manifest pulled by digest to the cache
+func (rc *RegClient) cacheManifestPut(r ref.Ref, m manifest.Manifest) {
+	if !rc.cacheEnabled(r) || r.Digest == "" || m.GetDescriptor().Digest.String() != r.Digest {
+		return
+	}
+	raw, err := m.RawBody()
+	if err != nil || len(raw) == 0 {
+		return
+	}
+	err = rc.blobCache.Put(m.GetDescriptor().Digest, raw)
+	if err != nil && !errors.Is(err, types.ErrMismatch) {
+		rc.log.WithFields(logrus.Fields{
+			"ref": r.CommonName(),
+			"err": err,
+		}).Warn("Failed to cache manifest")
+	}
+}
+
+// cacheManifestMediaType returns the media type from the manifest body.
+// Manifests without a media type (OCI and Docker schema1) are detected by their fields.
+func cacheManifestMediaType(raw []byte) string {
+	mt := struct {
+		MediaType     string          `json:"mediaType,omitempty"`
+		SchemaVersion int             `json:"schemaVersion,omitempty"`
+		Signatures    json.RawMessage `json:"signatures,omitempty"`
+		Manifests     json.RawMessage `json:"manifests,omitempty"`
+	}{}
+	if err := json.Unmarshal(raw, &mt); err != nil {
+		return ""
+	}
+	if mt.MediaType != "" {
+		return mt.MediaType
+	}
+	// schema1 manifests do not include a media type
+	if mt.SchemaVersion == 1 && len(mt.Signatures) > 0 {
+		return types.MediaTypeDocker1ManifestSigned
+	} else if mt.SchemaVersion == 1 {
+		return types.MediaTypeDocker1Manifest
+	}
+	if len(mt.Manifests) > 0 {
+		return types.MediaTypeOCI1ManifestList
+	}
+	return types.MediaTypeOCI1Manifest
+}
+
+// cacheTee writes the blob to the cache as it is read, committing after the blob is verified
+type cacheTee struct {
+	rc *RegClient
+	b  blob.Reader
+	w  *blobcache.Writer
+}
+
+func (ct *cacheTee) Read(p []byte) (int, error) {
+	n, err := ct.b.Read(p)
+	if ct.w != nil && n > 0 {
+		if _, errW := ct.w.Write(p[:n]); errW != nil {
+			ct.w.Cancel()
+			ct.w = nil
+		}
+	}
+	if ct.w != nil && err != nil {
+		if err == io.EOF {
+			if errC := ct.w.Commit(); errC != nil {
+				ct.rc.log.WithFields(logrus.Fields{
+					"digest": ct.b.GetDescriptor().Digest,
+					"err":    errC,
+				}).Warn("Failed to cache blob")
+			}
+		} else {
+			ct.w.Cancel()
+		}
+		ct.w = nil
+	}
+	return n, err
+}
+
+// Seek passes through to the blob reader, the content is no longer cached
+func (ct *cacheTee) Seek(offset int64, whence int) (int64, error) {
+	rs, ok := ct.b.(io.Seeker)
+	if !ok {
+		return 0, types.ErrUnsupported
+	}
+	if ct.w != nil && !(offset == 0 && whence == io.SeekCurrent) {
+		ct.w.Cancel()
+		ct.w = nil
+	}
+	return rs.Seek(offset, whence)
+}
+
+func (ct *cacheTee) Close() error {
+	if ct.w != nil {
+		ct.w.Cancel()
+		ct.w = nil
+	}
+	return ct.b.Close()
+}
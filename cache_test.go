@@ -0,0 +1,154 @@
+package regclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/reqresp"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestBlobCache(t *testing.T) {
+	ctx := context.Background()
+	repoPath := "/proj/repo"
+	blobLen := 1024
+	d1, blob1 := reqresp.NewRandomBlob(blobLen, 1)
+	m1 := []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[]}`,
+		types.MediaTypeOCI1ImageConfig, d1.String(), blobLen))
+	dm1 := digest.FromBytes(m1)
+	// each entry is only served once, a second request fails the test
+	rrs := []reqresp.ReqResp{
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "GET for d1",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + repoPath + "/blobs/" + d1.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   blob1,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "GET for m1",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + repoPath + "/manifests/" + dm1.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   m1,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", len(m1))},
+					"Content-Type":          {types.MediaTypeOCI1Manifest},
+					"Docker-Content-Digest": {dm1.String()},
+				},
+			},
+		},
+	}
+	rrs = append(rrs, reqresp.BaseEntries...)
+	ts := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+	tsHost := tsURL.Host
+	rcHosts := []config.Host{
+		{
+			Name:     tsHost,
+			Hostname: tsHost,
+			TLS:      config.TLSDisabled,
+		},
+	}
+	fsMem := rwfs.MemNew()
+	rc := New(
+		WithConfigHosts(rcHosts),
+		WithFS(fsMem),
+		WithBlobCache("cache", 0),
+		WithRetryLimit(1),
+	)
+	r, err := ref.New(tsHost + repoPath)
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+
+	t.Run("Blob", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			br, err := rc.BlobGet(ctx, r, types.Descriptor{Digest: d1})
+			if err != nil {
+				t.Fatalf("failed to get blob %d: %v", i, err)
+			}
+			out, err := ioutil.ReadAll(br)
+			br.Close()
+			if err != nil {
+				t.Fatalf("failed to read blob %d: %v", i, err)
+			}
+			if string(out) != string(blob1) {
+				t.Errorf("blob mismatch on request %d", i)
+			}
+		}
+	})
+	t.Run("Manifest", func(t *testing.T) {
+		rm := r
+		rm.Digest = dm1.String()
+		for i := 0; i < 2; i++ {
+			m, err := rc.ManifestGet(ctx, rm)
+			if err != nil {
+				t.Fatalf("failed to get manifest %d: %v", i, err)
+			}
+			if m.GetDescriptor().Digest != dm1 || m.GetDescriptor().MediaType != types.MediaTypeOCI1Manifest {
+				t.Errorf("unexpected descriptor on request %d: %v", i, m.GetDescriptor())
+			}
+			cd, err := m.GetConfig()
+			if err != nil || cd.Digest != d1 {
+				t.Errorf("unexpected config on request %d: %v, %v", i, cd, err)
+			}
+		}
+	})
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := rc.blobCache.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if stats.Count != 2 || stats.Size != int64(blobLen+len(m1)) {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+	})
+}
+
+func TestCacheManifestMediaType(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		expect string
+	}{
+		{name: "media type", raw: `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`, expect: types.MediaTypeDocker2Manifest},
+		{name: "oci manifest", raw: `{"schemaVersion":2,"config":{},"layers":[]}`, expect: types.MediaTypeOCI1Manifest},
+		{name: "oci index", raw: `{"schemaVersion":2,"manifests":[{}]}`, expect: types.MediaTypeOCI1ManifestList},
+		{name: "schema1", raw: `{"schemaVersion":1,"name":"repo","tag":"v1","fsLayers":[]}`, expect: types.MediaTypeDocker1Manifest},
+		{name: "schema1 signed", raw: `{"schemaVersion":1,"name":"repo","tag":"v1","fsLayers":[],"signatures":[{"header":{}}]}`, expect: types.MediaTypeDocker1ManifestSigned},
+		{name: "invalid", raw: `{`, expect: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mt := cacheManifestMediaType([]byte(tt.raw))
+			if mt != tt.expect {
+				t.Errorf("unexpected media type, expected %s, received %s", tt.expect, mt)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"time"
@@ -61,23 +62,46 @@ func credsToRCHost(c ConfigCreds) config.Host {
 
 // ConfigDefaults is uses for general options and defaults for ConfigScript entries
 type ConfigDefaults struct {
+	HTTPHosts      []string      `yaml:"httpHosts" json:"httpHosts"`
 	Interval       time.Duration `yaml:"interval" json:"interval"`
+	Listen         string        `yaml:"listen" json:"listen"`
+	ListenToken    string        `yaml:"listenToken" json:"listenToken"`
 	Schedule       string        `yaml:"schedule" json:"schedule"`
 	Parallel       int           `yaml:"parallel" json:"parallel"`
 	SkipDockerConf bool          `yaml:"skipDockerConfig" json:"skipDockerConfig"`
+	StateFile      string        `yaml:"stateFile" json:"stateFile"`
 	Timeout        time.Duration `yaml:"timeout" json:"timeout"`
 	UserAgent      string        `yaml:"userAgent" json:"userAgent"`
 }
 
 // ConfigScript defines a source/target repository to sync
 type ConfigScript struct {
-	Name     string        `yaml:"name" json:"name"`
-	Script   string        `yaml:"script" json:"script"`
+	Name     string          `yaml:"name" json:"name"`
+	Script   string          `yaml:"script" json:"script"`
+	Interval time.Duration   `yaml:"interval" json:"interval"`
+	Schedule string          `yaml:"schedule" json:"schedule"`
+	Timeout  time.Duration   `yaml:"timeout" json:"timeout"`
+	Triggers []ConfigTrigger `yaml:"triggers" json:"triggers"`
+}
+
+// ConfigTrigger runs a script on an event
+type ConfigTrigger struct {
+	Type     string        `yaml:"type" json:"type"`
+	Repo     string        `yaml:"repo" json:"repo"`
+	Tag      string        `yaml:"tag" json:"tag"`
+	Actions  []string      `yaml:"actions" json:"actions"`
 	Interval time.Duration `yaml:"interval" json:"interval"`
-	Schedule string        `yaml:"schedule" json:"schedule"`
-	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
 }
 
+const (
+	// TriggerManual runs a script from a request to the trigger API
+	TriggerManual = "manual"
+	// TriggerWatch polls a repository and runs a script when a tag changes
+	TriggerWatch = "watch"
+	// TriggerWebhook runs a script from a registry notification
+	TriggerWebhook = "webhook"
+)
+
 // ConfigNew creates an empty configuration
 func ConfigNew() *Config {
 	c := Config{
@@ -100,6 +124,17 @@ func ConfigLoadReader(r io.Reader) (*Config, error) {
 	// apply defaults to each step
 	for i := range c.Scripts {
 		scriptSetDefaults(&c.Scripts[i], c.Defaults)
+		for _, t := range c.Scripts[i].Triggers {
+			switch t.Type {
+			case TriggerManual, TriggerWebhook:
+			case TriggerWatch:
+				if t.Repo == "" {
+					return nil, fmt.Errorf("watch trigger on script %s requires a repo: %w", c.Scripts[i].Name, ErrMissingInput)
+				}
+			default:
+				return nil, fmt.Errorf("unknown trigger type %s on script %s: %w", t.Type, c.Scripts[i].Name, ErrInvalidInput)
+			}
+		}
 	}
 	err := configExpandTemplates(c)
 	if err != nil {
@@ -15,6 +15,8 @@ var (
 	ErrNotFound = errors.New("not found")
 	// ErrScriptFailed when the script fails to run
 	ErrScriptFailed = errors.New("failure in user script")
+	// ErrTestFailed when the actions of a script do not match the test
+	ErrTestFailed = errors.New("test failed")
 	// ErrUnsupportedConfigVersion happens when config file version is greater than this command supports
 	ErrUnsupportedConfigVersion = errors.New("unsupported config version")
 )
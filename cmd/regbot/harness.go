@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/internal/state"
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/oci"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test <file>",
+	Short: "test scripts against fixtures",
+	Long: `Runs scripts against in-memory OCI Layout fixtures described in a test file.
+Changes requested by each script (tag deletes, image copies, manifest and blob
+puts, http requests) are recorded instead of being run, and compared to the
+expected actions in the test file. Scripts are read from the test file, or
+from the config file when only the name is provided.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTest,
+}
+
+// TestConfig is the parsed test file for the test command
+type TestConfig struct {
+	Fixtures string      `yaml:"fixtures" json:"fixtures"`
+	Images   []TestImage `yaml:"images" json:"images"`
+	Tests    []TestCase  `yaml:"tests" json:"tests"`
+}
+
+// TestImage describes an image generated in the fixtures
+type TestImage struct {
+	Ref         string            `yaml:"ref" json:"ref"`
+	Platform    string            `yaml:"platform" json:"platform"`
+	Created     string            `yaml:"created" json:"created"`
+	Labels      map[string]string `yaml:"labels" json:"labels"`
+	Annotations map[string]string `yaml:"annotations" json:"annotations"`
+}
+
+// TestCase runs a script and compares the recorded actions
+type TestCase struct {
+	Name      string                 `yaml:"name" json:"name"`
+	Script    string                 `yaml:"script" json:"script"`
+	State     map[string]interface{} `yaml:"state" json:"state"`
+	Expect    []sandbox.Action       `yaml:"expect" json:"expect"`
+	ExpectErr bool                   `yaml:"expectErr" json:"expectErr"`
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	tc := TestConfig{}
+	err = yaml.UnmarshalStrict(b, &tc)
+	if err != nil {
+		return err
+	}
+	// scripts without a body are loaded from the config file
+	scripts := map[string]ConfigScript{}
+	var httpHosts []string
+	if rootOpts.confFile != "" {
+		fh, err := os.Open(rootOpts.confFile)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		c, err := ConfigLoadReader(fh)
+		if err != nil {
+			return err
+		}
+		for _, s := range c.Scripts {
+			scripts[s.Name] = s
+		}
+		httpHosts = c.Defaults.HTTPHosts
+	}
+	fsMem := rwfs.MemNew()
+	if tc.Fixtures != "" {
+		dir := tc.Fixtures
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(args[0]), dir)
+		}
+		err = rwfs.CopyRecursive(rwfs.OSNew(""), dir, fsMem, ".")
+		if err != nil {
+			return fmt.Errorf("failed to load fixtures from %s: %w", dir, err)
+		}
+	}
+	rcTest := regclient.New(
+		regclient.WithFS(fsMem),
+		regclient.WithLog(log),
+		regclient.WithUserAgent(UserAgent+" (test)"),
+	)
+	for _, ti := range tc.Images {
+		err = ti.create(ctx, rcTest)
+		if err != nil {
+			return fmt.Errorf("failed to create fixture %s: %w", ti.Ref, err)
+		}
+	}
+
+	failed := 0
+	for _, t := range tc.Tests {
+		s := ConfigScript{Name: t.Name, Script: t.Script}
+		if s.Script == "" {
+			cs, ok := scripts[t.Name]
+			if !ok {
+				return fmt.Errorf("script not found for test %s: %w", t.Name, ErrNotFound)
+			}
+			s = cs
+		}
+		msg := t.run(ctx, s, rcTest, httpHosts)
+		if msg != "" {
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "FAIL: %s\n%s", t.Name, msg)
+		} else {
+			fmt.Fprintf(cmd.OutOrStdout(), "PASS: %s\n", t.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed: %w", failed, len(tc.Tests), ErrTestFailed)
+	}
+	return nil
+}
+
+// run executes the script and returns a description of any failures
+func (t TestCase) run(ctx context.Context, s ConfigScript, rcTest *regclient.RegClient, httpHosts []string) string {
+	if s.Timeout > 0 {
+		ctxTimeout, cancel := context.WithTimeout(ctx, s.Timeout)
+		ctx = ctxTimeout
+		defer cancel()
+	}
+	st := state.New("")
+	for k, v := range t.State {
+		err := st.Set(s.Name, k, yamlToJSON(v))
+		if err != nil {
+			return fmt.Sprintf("  failed to set state %s: %v\n", k, err)
+		}
+	}
+	actions := []sandbox.Action{}
+	sb := sandbox.New(s.Name,
+		sandbox.WithContext(ctx),
+		sandbox.WithHTTPHosts(httpHosts),
+		sandbox.WithLog(log),
+		sandbox.WithRecorder(func(a sandbox.Action) {
+			actions = append(actions, a)
+		}),
+		sandbox.WithRegClient(rcTest),
+		sandbox.WithState(st),
+	)
+	defer sb.Close()
+	err := sb.RunScript(s.Script)
+	if err != nil && !t.ExpectErr {
+		return fmt.Sprintf("  script failed: %v\n", err)
+	} else if err == nil && t.ExpectErr {
+		return "  script did not fail\n"
+	}
+
+	expect := make([]sandbox.Action, len(t.Expect))
+	for i, a := range t.Expect {
+		a.Ref = normalizeRef(a.Ref)
+		a.Source = normalizeRef(a.Source)
+		expect[i] = a
+	}
+	match := len(expect) == len(actions)
+	for i := 0; match && i < len(expect); i++ {
+		match = expect[i] == actions[i]
+	}
+	if match {
+		return ""
+	}
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "  expected actions:\n")
+	writeActions(msg, expect)
+	fmt.Fprintf(msg, "  recorded actions:\n")
+	writeActions(msg, actions)
+	return msg.String()
+}
+
+// create generates an image in the fixtures
+func (ti TestImage) create(ctx context.Context, rcTest *regclient.RegClient) error {
+	r, err := ref.New(ti.Ref)
+	if err != nil {
+		return err
+	}
+	plat := platform.Platform{OS: "linux", Architecture: "amd64"}
+	if ti.Platform != "" {
+		plat, err = platform.Parse(ti.Platform)
+		if err != nil {
+			return err
+		}
+	}
+	conf := v1.Image{
+		Architecture: plat.Architecture,
+		Variant:      plat.Variant,
+		OS:           plat.OS,
+		Config: v1.ImageConfig{
+			Labels: ti.Labels,
+		},
+		RootFS: v1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{},
+		},
+	}
+	if ti.Created != "" {
+		created, err := time.Parse(time.RFC3339, ti.Created)
+		if err != nil {
+			return err
+		}
+		conf.Created = &created
+	}
+	confJSON, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	confDesc, err := rcTest.BlobPut(ctx, r, types.Descriptor{}, bytes.NewReader(confJSON))
+	if err != nil {
+		return err
+	}
+	confDesc.MediaType = types.MediaTypeOCI1ImageConfig
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned:   oci.Versioned{SchemaVersion: 2},
+		MediaType:   types.MediaTypeOCI1Manifest,
+		Config:      confDesc,
+		Layers:      []types.Descriptor{},
+		Annotations: ti.Annotations,
+	}))
+	if err != nil {
+		return err
+	}
+	err = rcTest.ManifestPut(ctx, r, m)
+	if err != nil {
+		return err
+	}
+	return rcTest.Close(ctx, r)
+}
+
+// normalizeRef converts a reference to the format recorded by the sandbox
+func normalizeRef(s string) string {
+	if s == "" {
+		return s
+	}
+	r, err := ref.New(s)
+	if err != nil {
+		return s
+	}
+	return r.CommonName()
+}
+
+func writeActions(w io.Writer, actions []sandbox.Action) {
+	if len(actions) == 0 {
+		fmt.Fprintf(w, "    (none)\n")
+	}
+	for _, a := range actions {
+		b, _ := json.Marshal(a)
+		fmt.Fprintf(w, "    %s\n", string(b))
+	}
+}
+
+// yamlToJSON converts maps parsed from yaml to use string keys
+func yamlToJSON(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, val := range vt {
+			m[fmt.Sprintf("%v", k)] = yamlToJSON(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(vt))
+		for i, val := range vt {
+			l[i] = yamlToJSON(val)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestHarness(t *testing.T) {
+	dir := t.TempDir()
+	fixtures, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatalf("failed to find testdata: %v", err)
+	}
+	confFile := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(confFile, []byte(`
+version: 1
+defaults:
+  httpHosts:
+    - example.invalid
+scripts:
+  - name: Cleanup
+    script: |
+      for _, t in ipairs(tag.ls("ocidir://app")) do
+        ic = image.config("ocidir://app:" .. t)
+        if ic.Config.Labels["version"] == "1" then
+          tag.delete("ocidir://app:" .. t)
+        end
+      end
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	header := `
+fixtures: ` + fixtures + `
+images:
+  - ref: ocidir://app:v1
+    labels:
+      version: "1"
+  - ref: ocidir://app:v2
+    labels:
+      version: "2"
+tests:
+`
+	tests := []struct {
+		name      string
+		tests     string
+		expErr    error
+		expOutput []string
+	}{
+		{
+			name: "config script",
+			tests: `
+  - name: Cleanup
+    expect:
+      - action: tag.delete
+        ref: ocidir://app:v1
+`,
+			expOutput: []string{"PASS: Cleanup"},
+		},
+		{
+			name: "inline script",
+			tests: `
+  - name: Copy
+    state:
+      last: v1
+    script: |
+      image.copy("ocidir://testrepo:" .. state.get("last"), "ocidir://testcopy:latest")
+      manifest.put(manifest.get("ocidir://testrepo:v1"), "ocidir://testcopy:v1")
+    expect:
+      - action: image.copy
+        source: ocidir://testrepo:v1
+        ref: ocidir://testcopy:latest
+      - action: manifest.put
+        ref: ocidir://testcopy:v1
+`,
+			expOutput: []string{"PASS: Copy"},
+		},
+		{
+			name: "http requests",
+			tests: `
+  - name: HTTP
+    script: |
+      resp = http.get("https://example.invalid/status")
+      if resp.status ~= 200 and resp.body == "" and next(resp.headers) == nil then
+        resp = http.post("https://example.invalid/hook", {status = resp.status})
+        if resp.status ~= 0 then
+          error "unexpected status"
+        end
+      end
+    expect:
+      - action: http.get
+        host: example.invalid
+      - action: http.post
+        host: example.invalid
+`,
+			expOutput: []string{"PASS: HTTP"},
+		},
+		{
+			name: "expected error",
+			tests: `
+  - name: Error
+    script: error "failed"
+    expectErr: true
+`,
+			expOutput: []string{"PASS: Error"},
+		},
+		{
+			name: "mismatch",
+			tests: `
+  - name: Cleanup
+    expect:
+      - action: tag.delete
+        ref: ocidir://app:v2
+`,
+			expErr:    ErrTestFailed,
+			expOutput: []string{"FAIL: Cleanup", `{"action":"tag.delete","ref":"ocidir://app:v1"}`},
+		},
+		{
+			name: "missing script",
+			tests: `
+  - name: Missing
+`,
+			expErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testFile := filepath.Join(dir, "test.yaml")
+			err := os.WriteFile(testFile, []byte(header+tt.tests), 0644)
+			if err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+			rootOpts.confFile = confFile
+			defer func() { rootOpts.confFile = "" }()
+			out := &bytes.Buffer{}
+			cmd := &cobra.Command{}
+			cmd.SetOut(out)
+			err = runTest(cmd, []string{testFile})
+			if tt.expErr != nil {
+				if err == nil || !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v, output: %s", err, out.String())
+			}
+			for _, exp := range tt.expOutput {
+				if !strings.Contains(out.String(), exp) {
+					t.Errorf("output missing %s, received: %s", exp, out.String())
+				}
+			}
+		})
+	}
+}
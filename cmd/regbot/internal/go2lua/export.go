@@ -81,7 +81,7 @@ func exportReflect(ls *lua.LState, v reflect.Value) lua.LValue {
 		}
 		// Unsupported struct, no exported fields and no string interface
 		return lua.LNil
-	case reflect.Ptr:
+	case reflect.Interface, reflect.Ptr:
 		if v.IsNil() {
 			return lua.LNil
 		}
@@ -94,7 +94,6 @@ func exportReflect(ls *lua.LState, v reflect.Value) lua.LValue {
 		// Complex128
 		// Chan
 		// Func
-		// Interface
 		// UnsafePointer
 
 		return lua.LNil
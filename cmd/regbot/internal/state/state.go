@@ -0,0 +1,169 @@
+// Package state stores persistent key/value data for regbot scripts
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store is a JSON file of values, namespaced by script.
+// Every change is written to a temporary file and renamed over the original.
+// When the filename is empty, values are kept in memory.
+type Store struct {
+	mu       sync.Mutex
+	filename string
+	loaded   bool
+	data     map[string]map[string]interface{}
+}
+
+// New returns a store backed by filename
+func New(filename string) *Store {
+	return &Store{
+		filename: filename,
+		data:     map[string]map[string]interface{}{},
+	}
+}
+
+// Get returns the value of a key, ok is false when the key is not set
+func (s *Store) Get(ns, key string) (val interface{}, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, false, err
+	}
+	val, ok = s.data[ns][key]
+	return val, ok, nil
+}
+
+// Set stores a value, the value must be JSON encodable
+func (s *Store) Set(ns, key string, val interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	// round trip the value to match what is loaded from the file
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	prev, prevOK := s.data[ns][key]
+	if _, ok := s.data[ns]; !ok {
+		s.data[ns] = map[string]interface{}{}
+	}
+	s.data[ns][key] = v
+	if err := s.save(); err != nil {
+		// restore the previous value on failure
+		if prevOK {
+			s.data[ns][key] = prev
+		} else {
+			delete(s.data[ns], key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a key
+func (s *Store) Delete(ns, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	prev, ok := s.data[ns][key]
+	if !ok {
+		return nil
+	}
+	delete(s.data[ns], key)
+	if err := s.save(); err != nil {
+		s.data[ns][key] = prev
+		return err
+	}
+	return nil
+}
+
+// List returns the sorted keys beginning with prefix
+func (s *Store) List(ns, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range s.data[ns] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// load reads the file on first use, a missing file is an empty store
+func (s *Store) load() error {
+	if s.loaded || s.filename == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.data); err != nil {
+			return fmt.Errorf("failed to parse state file %s: %w", s.filename, err)
+		}
+	}
+	if s.data == nil {
+		s.data = map[string]map[string]interface{}{}
+	}
+	s.loaded = true
+	return nil
+}
+
+// save writes the data to a temporary file and renames it over the state file
+func (s *Store) save() error {
+	if s.filename == "" {
+		return nil
+	}
+	// remove empty namespaces
+	for ns := range s.data {
+		if len(s.data[ns]) == 0 {
+			delete(s.data, ns)
+		}
+	}
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file %s: %w", s.filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	s := New(filename)
+	// missing keys
+	_, ok, err := s.Get("a", "missing")
+	if err != nil {
+		t.Fatalf("failed to get missing key: %v", err)
+	}
+	if ok {
+		t.Errorf("missing key found")
+	}
+	// set values in two namespaces
+	if err := s.Set("a", "key1", "value1"); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := s.Set("a", "key2", map[string]int{"count": 2}); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := s.Set("a", "other", true); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := s.Set("b", "key1", "value2"); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if err := s.Set("a", "invalid", func() {}); err == nil {
+		t.Errorf("set of a func did not fail")
+	}
+	// reload from the file
+	s = New(filename)
+	tests := []struct {
+		name   string
+		ns     string
+		key    string
+		expOK  bool
+		expVal interface{}
+	}{
+		{
+			name:   "string",
+			ns:     "a",
+			key:    "key1",
+			expOK:  true,
+			expVal: "value1",
+		},
+		{
+			name:   "namespace",
+			ns:     "b",
+			key:    "key1",
+			expOK:  true,
+			expVal: "value2",
+		},
+		{
+			name:   "bool",
+			ns:     "a",
+			key:    "other",
+			expOK:  true,
+			expVal: true,
+		},
+		{
+			name:  "invalid",
+			ns:    "a",
+			key:   "invalid",
+			expOK: false,
+		},
+		{
+			name:  "missing namespace",
+			ns:    "c",
+			key:   "key1",
+			expOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val, ok, err := s.Get(tt.ns, tt.key)
+			if err != nil {
+				t.Fatalf("failed to get: %v", err)
+			}
+			if ok != tt.expOK {
+				t.Errorf("unexpected found, expected %t, received %t", tt.expOK, ok)
+			}
+			if ok && val != tt.expVal {
+				t.Errorf("unexpected value, expected %v, received %v", tt.expVal, val)
+			}
+		})
+	}
+	t.Run("map", func(t *testing.T) {
+		val, _, err := s.Get("a", "key2")
+		if err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+		m, ok := val.(map[string]interface{})
+		if !ok || m["count"] != float64(2) {
+			t.Errorf("unexpected value: %v", val)
+		}
+	})
+	t.Run("list", func(t *testing.T) {
+		keys, err := s.List("a", "key")
+		if err != nil {
+			t.Fatalf("failed to list: %v", err)
+		}
+		if len(keys) != 2 || keys[0] != "key1" || keys[1] != "key2" {
+			t.Errorf("unexpected keys: %v", keys)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		if err := s.Delete("a", "key1"); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		if err := s.Delete("a", "missing"); err != nil {
+			t.Fatalf("failed to delete missing key: %v", err)
+		}
+		s = New(filename)
+		if _, ok, _ := s.Get("a", "key1"); ok {
+			t.Errorf("deleted key found")
+		}
+		if _, ok, _ := s.Get("b", "key1"); !ok {
+			t.Errorf("key in other namespace deleted")
+		}
+	})
+	t.Run("no temp files", func(t *testing.T) {
+		entries, err := os.ReadDir(filepath.Dir(filename))
+		if err != nil {
+			t.Fatalf("failed to read dir: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("unexpected files in state dir: %v", entries)
+		}
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		if err := os.WriteFile(filename, []byte("{invalid"), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		s = New(filename)
+		if _, _, err := s.Get("a", "key1"); err == nil {
+			t.Errorf("corrupt file did not fail")
+		}
+	})
+}
@@ -3,12 +3,25 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/internal/state"
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/ref"
 	"golang.org/x/sync/semaphore"
 )
@@ -26,6 +39,7 @@ func TestRegbot(t *testing.T) {
 	// setup various globals normally done by loadConf
 	sem = semaphore.NewWeighted(1)
 	rc = regclient.New(regclient.WithFS(fsMem))
+	st = state.New(filepath.Join(t.TempDir(), "state.json"))
 	var confBytes = `
   version: 1
   defaults:
@@ -38,14 +52,79 @@ func TestRegbot(t *testing.T) {
 		t.Errorf("failed parsing config: %v", err)
 		return
 	}
+	// webhook server counts posts and returns the last body on a get
+	hookMu := sync.Mutex{}
+	hookCount := 0
+	hookLast := json.RawMessage("null")
+	tsHook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hookMu.Lock()
+		defer hookMu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/hook":
+			if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			hookCount++
+			hookLast = b
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodGet && r.URL.Path == "/status":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Count int             `json:"count"`
+				Last  json.RawMessage `json:"last"`
+			}{Count: hookCount, Last: hookLast})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer tsHook.Close()
+	tsHookURL, _ := url.Parse(tsHook.URL)
+	conf.Defaults.HTTPHosts = []string{tsHookURL.Host}
 	shortTime, err := time.ParseDuration("10ms")
 	if err != nil {
 		t.Errorf("failed to setup shortTime: %v", err)
 		return
 	}
+	// push a referrers index for v1 using the referrers tag schema
+	mReferrers, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{
+			{
+				MediaType:    types.MediaTypeOCI1Manifest,
+				ArtifactType: "application/example.sbom",
+				Size:         1234,
+				Digest:       digest.FromString("sbom"),
+				Annotations:  map[string]string{"org.example.format": "spdx"},
+			},
+			{
+				MediaType:    types.MediaTypeOCI1Manifest,
+				ArtifactType: "application/example.signature",
+				Size:         5678,
+				Digest:       digest.FromString("signature"),
+			},
+		},
+	}))
+	if err != nil {
+		t.Errorf("failed to create referrers index: %v", err)
+		return
+	}
+	rReferrers, err := ref.New("ocidir://testrepo:sha256-94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694")
+	if err != nil {
+		t.Errorf("failed to parse referrers ref: %v", err)
+		return
+	}
+	err = rc.ManifestPut(ctx, rReferrers, mReferrers)
+	if err != nil {
+		t.Errorf("failed to push referrers index: %v", err)
+		return
+	}
 	tests := []struct {
 		name      string
 		script    ConfigScript
+		event     *sandbox.Event
 		dryrun    bool
 		exists    []string
 		missing   []string
@@ -83,6 +162,24 @@ func TestRegbot(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "CheckBase",
+			script: ConfigScript{
+				Name: "CheckBase",
+				Script: `
+				if image.checkBase("ocidir://testrepo:v3", {base = "ocidir://testrepo:v1", platform = "linux/amd64"}) ~= true then
+					error "base image should match"
+				end
+				if image.checkBase("ocidir://testrepo:v1", {base = "ocidir://testrepo:v3", platform = "linux/amd64"}) ~= false then
+					error "base image should be changed"
+				end
+				if image.checkBase("ocidir://testrepo:v1", {platform = "linux/amd64"}) ~= nil then
+					error "base image should be unknown"
+				end
+				`,
+			},
+			expErr: nil,
+		},
 		{
 			name: "CopyLatest",
 			script: ConfigScript{
@@ -137,6 +234,261 @@ func TestRegbot(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "ImageConfig",
+			script: ConfigScript{
+				Name: "ImageConfig",
+				Script: `
+				ic = image.config("ocidir://testrepo:v1")
+				if ic.history[2].created_by ~= "LABEL version=1" then
+					error "history missing/invalid"
+				end
+				plats = image.platforms("ocidir://testrepo:v1")
+				if #plats ~= 2 or plats[1] ~= "linux/amd64" or plats[2] ~= "linux/arm64" then
+					error "unexpected platforms"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "ImageReferrers",
+			script: ConfigScript{
+				Name: "ImageReferrers",
+				Script: `
+				refs = image.referrers("ocidir://testrepo:v1")
+				if #refs ~= 2 or refs[1].artifactType ~= "application/example.sbom" or refs[1].annotations["org.example.format"] ~= "spdx" or refs[2].size ~= 5678 then
+					error "unexpected referrers"
+				end
+				refs = image.referrers("ocidir://testrepo:v1", {artifactType = "application/example.signature"})
+				if #refs ~= 1 or refs[1].digest ~= "` + digest.FromString("signature").String() + `" then
+					error "artifactType filter failed"
+				end
+				refs = image.referrers("ocidir://testrepo:v2")
+				if #refs ~= 0 then
+					error "unexpected referrers on v2"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "ImageMod",
+			script: ConfigScript{
+				Name: "ImageMod",
+				Script: `
+				r = image.mod("ocidir://testrepo:v1", {
+					platforms = {"linux/arm64"},
+					labels = {source = "https://example.com/repo"},
+					annotations = {["org.example.policy"] = "checked"},
+					target = "ocidir://testmod:arm64",
+				})
+				if tostring(r) ~= "ocidir://testmod:arm64" then
+					error("unexpected ref " .. tostring(r))
+				end
+				plats = image.platforms(r)
+				if #plats ~= 1 or plats[1] ~= "linux/arm64" then
+					error "platforms not filtered"
+				end
+				ic = image.config(manifest.get(r, "linux/arm64"))
+				if ic.Config.Labels["source"] ~= "https://example.com/repo" then
+					error "label not added"
+				end
+				m = manifest.getList(r)
+				if m.Annotations["org.example.policy"] ~= "checked" then
+					error "annotation not added"
+				end
+				`,
+			},
+			exists: []string{"ocidir://testmod:arm64"},
+			expErr: nil,
+		},
+		{
+			name: "ImageModDigest",
+			script: ConfigScript{
+				Name: "ImageModDigest",
+				Script: `
+				image.copy("ocidir://testrepo:v1", "ocidir://testmoddigest:v1")
+				r = image.mod("ocidir://testmoddigest:v1", {labels = {source = "https://example.com/repo"}})
+				if r:tag() ~= "" or r:digest() == "" or r:digest() == "sha256:94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694" then
+					error("unexpected ref " .. tostring(r))
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name:   "ImageModDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "ImageModDryRun",
+				Script: `
+				r = image.mod("ocidir://testrepo:v1", {labels = {source = "https://example.com/repo"}})
+				if r:tag() ~= "" or r:digest() ~= "sha256:94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694" then
+					error("unexpected ref " .. tostring(r))
+				end
+				r = image.mod("ocidir://testrepo:v1", {target = "ocidir://testmoddryrun:v1"})
+				if tostring(r) ~= "ocidir://testmoddryrun:v1" then
+					error("unexpected ref " .. tostring(r))
+				end
+				`,
+			},
+			missing: []string{"ocidir://testmoddryrun:v1"},
+			expErr:  nil,
+		},
+		{
+			name: "BlobCopy",
+			script: ConfigScript{
+				Name: "BlobCopy",
+				Script: `
+				blob.copy("ocidir://testrepo", "ocidir://testblob", "sha256:9fc9590240f5264b6470ceca1aa90197f9223973890bebbb082011fc985e4412")
+				`,
+			},
+			desired: []string{
+				"testblob/blobs/sha256/9fc9590240f5264b6470ceca1aa90197f9223973890bebbb082011fc985e4412",
+			},
+			expErr: nil,
+		},
+		{
+			name: "Event",
+			script: ConfigScript{
+				Name: "Event",
+				Script: `
+				if event.type ~= "webhook" or event.action ~= "push" or event.tag ~= "v1" then
+					error "unexpected event"
+				end
+				image.config(event.repo .. ":" .. event.tag)
+				`,
+			},
+			event:  &sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "ocidir://testrepo", Tag: "v1"},
+			expErr: nil,
+		},
+		{
+			name: "NoEvent",
+			script: ConfigScript{
+				Name: "NoEvent",
+				Script: `
+				if event ~= nil then
+					error "unexpected event"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "State",
+			script: ConfigScript{
+				Name: "State",
+				Script: `
+				if state.get("count") ~= nil then
+					error "count should be unset"
+				end
+				state.set("count", 1)
+				state.set("count", state.get("count") + 1)
+				state.set("seen/v1", {digest = "sha256:1234", tags = {"a", "b"}})
+				state.set("seen/v2", true)
+				state.set("other", "value")
+				if state.get("count") ~= 2 then
+					error "count should be 2"
+				end
+				seen = state.get("seen/v1")
+				if seen.digest ~= "sha256:1234" or seen.tags[2] ~= "b" then
+					error "table not returned"
+				end
+				keys = state.list("seen/")
+				if #keys ~= 2 or keys[1] ~= "seen/v1" or keys[2] ~= "seen/v2" then
+					error "unexpected list of keys"
+				end
+				state.delete("seen/v2")
+				if state.get("seen/v2") ~= nil or #state.list() ~= 3 then
+					error "delete failed"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "StateNamespace",
+			script: ConfigScript{
+				Name: "StateNamespace",
+				Script: `
+				if state.get("count") ~= nil or #state.list() ~= 0 then
+					error "state from another script is visible"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name:   "StateDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "State",
+				Script: `
+				state.set("count", 5)
+				state.delete("other")
+				if state.get("count") ~= 2 or state.get("other") ~= "value" then
+					error "state changed in dry-run"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "StateInvalid",
+			script: ConfigScript{
+				Name: "StateInvalid",
+				Script: `
+				state.set("fn", function() end)
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
+		{
+			name: "HTTPPost",
+			script: ConfigScript{
+				Name: "HTTPPost",
+				Script: `
+				resp = http.post("` + tsHook.URL + `/hook", {text = "deleted", tags = {"v1", "v2"}}, {headers = {["X-Token"] = "secret"}})
+				if resp.status ~= 202 then
+					error("unexpected status " .. resp.status)
+				end
+				resp = http.get("` + tsHook.URL + `/status", {timeout = "5s"})
+				if resp.status ~= 200 or resp.json.count ~= 1 or resp.json.last.text ~= "deleted" or resp.json.last.tags[2] ~= "v2" then
+					error("unexpected response " .. resp.body)
+				end
+				if http.json({count = 1}) ~= '{"count":1}' then
+					error "json encoding failed"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name:   "HTTPDryRun",
+			dryrun: true,
+			script: ConfigScript{
+				Name: "HTTPDryRun",
+				Script: `
+				http.post("` + tsHook.URL + `/hook", {text = "dry-run"}, {headers = {["X-Token"] = "secret"}})
+				resp = http.get("` + tsHook.URL + `/status")
+				if resp.json.count ~= 1 then
+					error "post sent in dry-run"
+				end
+				`,
+			},
+			expErr: nil,
+		},
+		{
+			name: "HTTPBlocked",
+			script: ConfigScript{
+				Name: "HTTPBlocked",
+				Script: `
+				http.get("http://example.com/")
+				`,
+			},
+			expErr: ErrScriptFailed,
+		},
 		{
 			name: "Timeout",
 			script: ConfigScript{
@@ -154,7 +506,7 @@ func TestRegbot(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rootOpts.dryRun = tt.dryrun
-			err = tt.script.process(ctx)
+			err = tt.script.processEvent(ctx, tt.event)
 			if tt.expErr != nil {
 				if err == nil {
 					t.Errorf("process did not fail")
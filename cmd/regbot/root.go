@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"io/fs"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/internal/state"
 	"github.com/regclient/regclient/cmd/regbot/sandbox"
 	"github.com/regclient/regclient/config"
 	"github.com/regclient/regclient/pkg/template"
@@ -26,6 +29,11 @@ const (
 More details at https://github.com/regclient/regclient`
 	// UserAgent sets the header on http requests
 	UserAgent = "regclient/regbot"
+	// timeouts for the trigger server
+	listenReadHeaderTimeout = 10 * time.Second
+	listenReadTimeout       = 30 * time.Second
+	listenWriteTimeout      = 30 * time.Second
+	listenIdleTimeout       = 2 * time.Minute
 )
 
 var rootOpts struct {
@@ -48,6 +56,7 @@ var (
 	log    *logrus.Logger
 	rc     *regclient.RegClient
 	sem    *semaphore.Weighted
+	st     *state.Store
 )
 
 var rootCmd = &cobra.Command{
@@ -189,8 +198,23 @@ func runServer(cmd *cobra.Command, args []string) error {
 	c := cron.New(cron.WithChain(
 		cron.SkipIfStillRunning(cron.DefaultLogger),
 	))
+	er := newEventRunner(ctx, &wg)
+	listenTriggers := false
 	for _, s := range conf.Scripts {
 		s := s
+		for _, t := range s.Triggers {
+			t := t
+			switch t.Type {
+			case TriggerWatch:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					watchRepo(ctx, s, t, er.run)
+				}()
+			case TriggerManual, TriggerWebhook:
+				listenTriggers = true
+			}
+		}
 		sched := s.Schedule
 		if sched == "" && s.Interval != 0 {
 			sched = "@every " + s.Interval.String()
@@ -206,17 +230,52 @@ func runServer(cmd *cobra.Command, args []string) error {
 				}).Debug("Running task")
 				wg.Add(1)
 				defer wg.Done()
+				// wait for any triggered run of the same script
+				lock := er.lock(s.Name)
+				lock.Lock()
+				defer lock.Unlock()
 				err := s.process(ctx)
 				if mainErr == nil {
 					mainErr = err
 				}
 			})
-		} else {
+		} else if len(s.Triggers) == 0 {
 			log.WithFields(logrus.Fields{
 				"name": s.Name,
-			}).Error("No schedule or interval found, ignoring")
+			}).Error("No schedule, interval, or trigger found, ignoring")
 		}
 	}
+	var srv *http.Server
+	if conf.Defaults.Listen != "" {
+		if conf.Defaults.ListenToken == "" {
+			log.WithFields(logrus.Fields{
+				"listen": conf.Defaults.Listen,
+			}).Warn("Listen token is not configured, any client can trigger scripts")
+		}
+		srv = &http.Server{
+			Addr: conf.Defaults.Listen,
+			Handler: &triggerServer{
+				scripts: conf.Scripts,
+				token:   conf.Defaults.ListenToken,
+				run:     er.run,
+			},
+			ReadHeaderTimeout: listenReadHeaderTimeout,
+			ReadTimeout:       listenReadTimeout,
+			WriteTimeout:      listenWriteTimeout,
+			IdleTimeout:       listenIdleTimeout,
+		}
+		go func() {
+			err := srv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.WithFields(logrus.Fields{
+					"listen": conf.Defaults.Listen,
+					"error":  err,
+				}).Error("Trigger server failed")
+			}
+		}()
+	} else if listenTriggers {
+		log.Warn("Listen address is not configured, webhook and manual triggers are disabled")
+	}
 	c.Start()
 	// wait on interrupt signal
 	sig := make(chan os.Signal, 1)
@@ -225,6 +284,14 @@ func runServer(cmd *cobra.Command, args []string) error {
 	log.WithFields(logrus.Fields{}).Debug("Interrupt received, stopping")
 	// clean shutdown
 	c.Stop()
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("Failed to stop trigger server")
+		}
+	}
 	cancel()
 	log.WithFields(logrus.Fields{}).Debug("Waiting on running tasks")
 	wg.Wait()
@@ -289,11 +356,18 @@ func loadConf() error {
 		rcOpts = append(rcOpts, regclient.WithConfigHosts(rcHosts))
 	}
 	rc = regclient.New(rcOpts...)
+	// state is shared by all scripts, an empty filename keeps the state in memory
+	st = state.New(conf.Defaults.StateFile)
 	return nil
 }
 
 // process a sync step
 func (s ConfigScript) process(ctx context.Context) error {
+	return s.processEvent(ctx, nil)
+}
+
+// processEvent runs a script with the event that triggered it
+func (s ConfigScript) processEvent(ctx context.Context, ev *sandbox.Event) error {
 	log.WithFields(logrus.Fields{
 		"script": s.Name,
 	}).Debug("Starting script")
@@ -305,13 +379,18 @@ func (s ConfigScript) process(ctx context.Context) error {
 	}
 	sbOpts := []sandbox.Opt{
 		sandbox.WithContext(ctx),
+		sandbox.WithHTTPHosts(conf.Defaults.HTTPHosts),
 		sandbox.WithRegClient(rc),
 		sandbox.WithLog(log),
 		sandbox.WithSemaphore(sem),
+		sandbox.WithState(st),
 	}
 	if rootOpts.dryRun {
 		sbOpts = append(sbOpts, sandbox.WithDryRun())
 	}
+	if ev != nil {
+		sbOpts = append(sbOpts, sandbox.WithEvent(*ev))
+	}
 	sb := sandbox.New(s.Name, sbOpts...)
 	defer sb.Close()
 	err := sb.RunScript(s.Script)
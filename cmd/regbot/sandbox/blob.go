@@ -30,6 +30,7 @@ func setupBlob(s *Sandbox) {
 		luaBlobName,
 		map[string]lua.LGFunction{
 			// "__tostring": s.blobContent,
+			"copy": s.blobCopy,
 			"get":  s.blobGet,
 			"head": s.blobHead,
 			"put":  s.blobPut,
@@ -97,6 +98,44 @@ func setupBlob(s *Sandbox) {
 // 	return b
 // }
 
+func (s *Sandbox) blobCopy(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	src := s.checkReference(ls, 1)
+	tgt := s.checkReference(ls, 2)
+	d := src.r.Digest
+	if ls.GetTop() >= 3 {
+		d = ls.CheckString(3)
+	}
+	dp, err := digest.Parse(d)
+	if err != nil {
+		ls.ArgError(3, "digest parsing failed: "+err.Error())
+	}
+	rTgt := tgt.r
+	rTgt.Digest = dp.String()
+	if s.sem != nil {
+		s.sem.Acquire(s.ctx, 1)
+		defer s.sem.Release(1)
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"source":  src.r.CommonName(),
+		"target":  tgt.r.CommonName(),
+		"digest":  dp.String(),
+		"dry-run": s.dryRun,
+	}).Info("Copy blob")
+	if s.record(Action{Action: "blob.copy", Ref: rTgt.CommonName(), Source: src.r.CommonName()}) {
+		return 0
+	}
+	err = s.rc.BlobCopy(s.ctx, src.r, tgt.r, types.Descriptor{Digest: dp})
+	if err != nil {
+		ls.RaiseError("Failed copying blob \"%s\" from \"%s\" to \"%s\": %v", dp.String(), src.r.CommonName(), tgt.r.CommonName(), err)
+	}
+	return 0
+}
+
 func (s *Sandbox) blobGet(ls *lua.LState) int {
 	err := s.ctx.Err()
 	if err != nil {
@@ -161,8 +200,9 @@ func (s *Sandbox) blobPut(ls *lua.LState) int {
 	r := s.checkReference(ls, 1)
 	var d digest.Digest
 	s.log.WithFields(logrus.Fields{
-		"script": s.name,
-		"ref":    r.r.CommonName(),
+		"script":  s.name,
+		"ref":     r.r.CommonName(),
+		"dry-run": s.dryRun,
 	}).Debug("Put blob")
 
 	if ls.GetTop() < 2 {
@@ -172,7 +212,7 @@ func (s *Sandbox) blobPut(ls *lua.LState) int {
 	var rdr io.Reader
 	switch ls.Get(2).Type() {
 	case lua.LTString:
-		str := ls.CheckString(1)
+		str := ls.CheckString(2)
 		rdr = strings.NewReader(str)
 	case lua.LTUserData:
 		ud := ls.CheckUserData(2)
@@ -191,6 +231,17 @@ func (s *Sandbox) blobPut(ls *lua.LState) int {
 		ls.ArgError(2, "blob content expected")
 	}
 
+	if s.record(Action{Action: "blob.put", Ref: r.r.CommonName()}) {
+		// return the digest and size without pushing the content
+		b, err := io.ReadAll(rdr)
+		if err != nil {
+			ls.RaiseError("Failed to read blob: %v", err)
+		}
+		ls.Push(lua.LString(digest.FromBytes(b).String()))
+		ls.Push(lua.LNumber(len(b)))
+		return 2
+	}
+
 	dOut, err := s.rc.BlobPut(s.ctx, r.r, types.Descriptor{Digest: d}, rdr)
 	if err != nil {
 		ls.RaiseError("Failed to put blob: %v", err)
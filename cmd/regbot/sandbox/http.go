@@ -0,0 +1,206 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	httpTimeout = 30 * time.Second
+	httpBodyMax = 10 * 1024 * 1024
+)
+
+func setupHTTP(s *Sandbox) {
+	s.setupMod(
+		luaHTTPName,
+		map[string]lua.LGFunction{
+			"get":  s.httpGet,
+			"json": s.httpJSON,
+			"post": s.httpPost,
+		},
+		map[string]map[string]lua.LGFunction{
+			"__index": {},
+		},
+	)
+}
+
+// httpGet sends a get request: http.get(url, opts)
+func (s *Sandbox) httpGet(ls *lua.LState) int {
+	return s.httpDo(ls, http.MethodGet, ls.CheckString(1), nil, 2)
+}
+
+// httpJSON encodes a value as a JSON string: http.json(value)
+func (s *Sandbox) httpJSON(ls *lua.LState) int {
+	val, err := importValue(ls.CheckAny(1), map[*lua.LTable]bool{})
+	if err != nil {
+		ls.ArgError(1, err.Error())
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		ls.RaiseError("Failed to encode json: %v", err)
+	}
+	ls.Push(lua.LString(b))
+	return 1
+}
+
+// httpPost sends a post request: http.post(url, body, opts)
+// A table body is encoded as JSON.
+func (s *Sandbox) httpPost(ls *lua.LState) int {
+	u := ls.CheckString(1)
+	var body lua.LValue = lua.LString("")
+	if ls.GetTop() >= 2 {
+		body = ls.Get(2)
+	}
+	return s.httpDo(ls, http.MethodPost, u, body, 3)
+}
+
+func (s *Sandbox) httpDo(ls *lua.LState, method, u string, body lua.LValue, optsArg int) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	lOpts := struct {
+		Headers map[string]string `json:"headers"`
+		Timeout string            `json:"timeout"`
+	}{}
+	if ls.GetTop() >= optsArg {
+		err := go2lua.Import(ls, ls.Get(optsArg), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	timeout := httpTimeout
+	if lOpts.Timeout != "" {
+		timeout, err = time.ParseDuration(lOpts.Timeout)
+		if err != nil {
+			ls.RaiseError("Failed to parse timeout \"%s\": %v", lOpts.Timeout, err)
+		}
+	}
+	reqURL, err := url.Parse(u)
+	if err != nil {
+		ls.RaiseError("Failed to parse url: %v", err)
+	}
+	if !s.httpAllowed(reqURL) {
+		ls.RaiseError("Host \"%s\" is not in the allowed http hosts", reqURL.Host)
+	}
+	// convert the body to a reader, tables are sent as json
+	var bodyRdr io.Reader
+	contentType := ""
+	switch lBody := body.(type) {
+	case nil, *lua.LNilType:
+	case lua.LString:
+		bodyRdr = strings.NewReader(string(lBody))
+	case *lua.LTable:
+		val, err := importValue(lBody, map[*lua.LTable]bool{})
+		if err != nil {
+			ls.ArgError(2, err.Error())
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			ls.RaiseError("Failed to encode json: %v", err)
+		}
+		bodyRdr = bytes.NewReader(b)
+		contentType = "application/json"
+	default:
+		ls.ArgError(2, "body must be a string or table")
+	}
+	// the url is not logged since webhook urls often include a secret
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"method":  method,
+		"host":    reqURL.Host,
+		"dry-run": s.dryRun && method != http.MethodGet,
+	}).Info("HTTP request")
+	a := Action{Action: "http." + strings.ToLower(method), Host: reqURL.Host}
+	skip := false
+	if method == http.MethodGet && s.recorder != nil {
+		// reads run with dry-run, but tests never send requests to the network
+		s.recorder(a)
+		skip = true
+	} else if method != http.MethodGet && s.record(a) {
+		skip = true
+	}
+	if skip {
+		// return an empty response so scripts run the same way when the request is not sent
+		lResp := ls.NewTable()
+		lResp.RawSetString("status", lua.LNumber(0))
+		lResp.RawSetString("body", lua.LString(""))
+		lResp.RawSetString("headers", ls.NewTable())
+		ls.Push(lResp)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), bodyRdr)
+	if err != nil {
+		ls.RaiseError("Failed to create request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range lOpts.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if !s.httpAllowed(req.URL) {
+				return fmt.Errorf("redirect to host \"%s\" is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		ls.RaiseError("Failed %s request to \"%s\": %v", method, reqURL.Host, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, httpBodyMax))
+	if err != nil {
+		ls.RaiseError("Failed reading response from \"%s\": %v", reqURL.Host, err)
+	}
+
+	lResp := ls.NewTable()
+	lResp.RawSetString("status", lua.LNumber(resp.StatusCode))
+	lResp.RawSetString("body", lua.LString(respBody))
+	lHeaders := ls.NewTable()
+	for k := range resp.Header {
+		lHeaders.RawSetString(k, lua.LString(resp.Header.Get(k)))
+	}
+	lResp.RawSetString("headers", lHeaders)
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var val interface{}
+		if err := json.Unmarshal(respBody, &val); err == nil {
+			lResp.RawSetString("json", go2lua.Export(ls, val))
+		}
+	}
+	ls.Push(lResp)
+	return 1
+}
+
+// httpAllowed verifies the url is http or https to a host in the allow list
+func (s *Sandbox) httpAllowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, host := range s.httpHosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,14 +3,19 @@ package sandbox
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/blob"
 	"github.com/regclient/regclient/types/manifest"
 	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
@@ -26,6 +31,7 @@ func setupImage(s *Sandbox) {
 	s.setupMod(
 		luaImageName,
 		map[string]lua.LGFunction{
+			"checkBase":     s.imageCheckBase,
 			"config":        s.configGet,
 			"copy":          s.imageCopy,
 			"exportTar":     s.imageExportTar,
@@ -33,12 +39,13 @@ func setupImage(s *Sandbox) {
 			"manifest":      s.manifestGet,
 			"manifestHead":  s.manifestHead,
 			"manifestList":  s.manifestGetList,
+			"mod":           s.imageMod,
+			"platforms":     s.imagePlatforms,
 			"ratelimitWait": s.imageRateLimitWait,
+			"referrers":     s.imageReferrers,
 		},
 		map[string]map[string]lua.LGFunction{
-			"__index": {
-				// "inspect": s.imageInspect,
-			},
+			"__index": {},
 		},
 	)
 	s.setupMod(
@@ -162,6 +169,69 @@ func (s *Sandbox) configJSON(ls *lua.LState) int {
 	return 1
 }
 
+// imageCheckBase returns true when the base image is unchanged, false when changed, and nil when unknown
+func (s *Sandbox) imageCheckBase(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	opts := []regclient.ImageOpts{}
+	lOpts := struct {
+		Base     string `json:"base"`
+		Digest   string `json:"digest"`
+		Platform string `json:"platform"`
+	}{}
+	if ls.GetTop() == 2 {
+		err := go2lua.Import(ls, ls.Get(2), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+		if lOpts.Base != "" {
+			opts = append(opts, regclient.ImageWithCheckBaseRef(lOpts.Base))
+		}
+		if lOpts.Digest != "" {
+			opts = append(opts, regclient.ImageWithCheckBaseDigest(lOpts.Digest))
+		}
+		if lOpts.Platform != "" {
+			opts = append(opts, regclient.ImageWithPlatform(lOpts.Platform))
+		}
+	}
+	if s.sem != nil {
+		s.sem.Acquire(s.ctx, 1)
+		defer s.sem.Release(1)
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":   s.name,
+		"image":    r.r.CommonName(),
+		"base":     lOpts.Base,
+		"digest":   lOpts.Digest,
+		"platform": lOpts.Platform,
+	}).Debug("Check base image")
+	err = s.rc.ImageCheckBase(s.ctx, r.r, opts...)
+	if errors.Is(err, types.ErrMismatch) {
+		s.log.WithFields(logrus.Fields{
+			"script": s.name,
+			"image":  r.r.CommonName(),
+			"error":  err,
+		}).Info("Base image changed")
+		ls.Push(lua.LBool(false))
+		return 1
+	} else if errors.Is(err, types.ErrMissingAnnotation) || errors.Is(err, types.ErrBaseUnavailable) {
+		s.log.WithFields(logrus.Fields{
+			"script": s.name,
+			"image":  r.r.CommonName(),
+			"error":  err,
+		}).Debug("Base image unknown")
+		ls.Push(lua.LNil)
+		return 1
+	} else if err != nil {
+		ls.RaiseError("Failed checking base of \"%s\": %v", r.r.CommonName(), err)
+	}
+	ls.Push(lua.LBool(true))
+	return 1
+}
+
 func (s *Sandbox) imageCopy(ls *lua.LState) int {
 	err := s.ctx.Err()
 	if err != nil {
@@ -207,7 +277,7 @@ func (s *Sandbox) imageCopy(ls *lua.LState) int {
 		"includeExternal": lOpts.IncludeExternal,
 		"dry-run":         s.dryRun,
 	}).Info("Copy image")
-	if s.dryRun {
+	if s.record(Action{Action: "image.copy", Ref: tgt.r.CommonName(), Source: src.r.CommonName()}) {
 		return 0
 	}
 	err = s.rc.ImageCopy(s.ctx, src.r, tgt.r, opts...)
@@ -228,6 +298,15 @@ func (s *Sandbox) imageExportTar(ls *lua.LState) int {
 	}
 	src := s.checkReference(ls, 1)
 	file := ls.CheckString(2)
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"source":  src.r.CommonName(),
+		"file":    file,
+		"dry-run": s.dryRun,
+	}).Info("Export image")
+	if s.record(Action{Action: "image.exportTar", Source: src.r.CommonName(), File: file}) {
+		return 0
+	}
 	if s.sem != nil {
 		s.sem.Acquire(s.ctx, 1)
 		defer s.sem.Release(1)
@@ -250,6 +329,15 @@ func (s *Sandbox) imageImportTar(ls *lua.LState) int {
 	}
 	tgt := s.checkReference(ls, 1)
 	file := ls.CheckString(2)
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"target":  tgt.r.CommonName(),
+		"file":    file,
+		"dry-run": s.dryRun,
+	}).Info("Import image")
+	if s.record(Action{Action: "image.importTar", Ref: tgt.r.CommonName(), File: file}) {
+		return 0
+	}
 	if s.sem != nil {
 		s.sem.Acquire(s.ctx, 1)
 		defer s.sem.Release(1)
@@ -336,3 +424,218 @@ func (s *Sandbox) imageRateLimitWait(ls *lua.LState) int {
 		}
 	}
 }
+
+// imageMod applies modifications to an image, returning a reference to the modified image
+func (s *Sandbox) imageMod(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	lOpts := struct {
+		Annotations       map[string]string `json:"annotations"`
+		LabelToAnnotation bool              `json:"labelToAnnotation"`
+		Labels            map[string]string `json:"labels"`
+		Platforms         []string          `json:"platforms"`
+		Target            string            `json:"target"`
+		ToDocker          bool              `json:"toDocker"`
+		ToOCI             bool              `json:"toOCI"`
+	}{}
+	if ls.GetTop() >= 2 {
+		err := go2lua.Import(ls, ls.Get(2), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+	}
+	opts := []mod.Opts{}
+	if len(lOpts.Platforms) > 0 {
+		pl := []platform.Platform{}
+		for _, pStr := range lOpts.Platforms {
+			p, err := platform.Parse(pStr)
+			if err != nil {
+				ls.RaiseError("Failed to parse platform \"%s\": %v", pStr, err)
+			}
+			pl = append(pl, p)
+		}
+		opts = append(opts, mod.WithPlatformKeep(pl))
+	}
+	if lOpts.ToDocker {
+		opts = append(opts, mod.WithManifestToDocker())
+	}
+	if lOpts.ToOCI {
+		opts = append(opts, mod.WithManifestToOCI())
+	}
+	for _, k := range sortedKeys(lOpts.Labels) {
+		opts = append(opts, mod.WithLabel(k, lOpts.Labels[k]))
+	}
+	if lOpts.LabelToAnnotation {
+		opts = append(opts, mod.WithLabelToAnnotation())
+	}
+	for _, k := range sortedKeys(lOpts.Annotations) {
+		opts = append(opts, mod.WithAnnotation(k, lOpts.Annotations[k]))
+	}
+	rTgt := r.r
+	if lOpts.Target != "" {
+		rTgt, err = ref.New(lOpts.Target)
+		if err != nil {
+			ls.RaiseError("Failed to parse target \"%s\": %v", lOpts.Target, err)
+		}
+	}
+	if s.sem != nil {
+		s.sem.Acquire(s.ctx, 1)
+		defer s.sem.Release(1)
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"image":   r.r.CommonName(),
+		"target":  lOpts.Target,
+		"dry-run": s.dryRun,
+	}).Info("Modify image")
+	if s.record(Action{Action: "image.mod", Ref: rTgt.CommonName(), Source: r.r.CommonName()}) {
+		// the modified digest is unknown without pushing the changes, the unmodified digest is returned instead
+		if lOpts.Target == "" {
+			mh, err := s.rc.ManifestHead(s.ctx, r.r)
+			if err != nil {
+				ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+			}
+			rTgt.Digest = mh.GetDescriptor().Digest.String()
+			rTgt.Tag = ""
+		}
+		s.pushReference(ls, rTgt)
+		return 1
+	}
+	rOut, err := mod.Apply(s.ctx, s.rc, r.r, opts...)
+	if err != nil {
+		ls.RaiseError("Failed to modify \"%s\": %v", r.r.CommonName(), err)
+	}
+	if lOpts.Target != "" {
+		err = s.rc.ImageCopy(s.ctx, rOut, rTgt)
+		if err != nil {
+			ls.RaiseError("Failed copying \"%s\" to \"%s\": %v", rOut.CommonName(), rTgt.CommonName(), err)
+		}
+		rOut = rTgt
+	}
+	err = s.rc.Close(s.ctx, rOut)
+	if err != nil {
+		ls.RaiseError("Failed closing reference \"%s\": %v", rOut.CommonName(), err)
+	}
+	s.pushReference(ls, rOut)
+	return 1
+}
+
+// imagePlatforms returns the list of platforms for an image
+func (s *Sandbox) imagePlatforms(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	s.log.WithFields(logrus.Fields{
+		"script": s.name,
+		"image":  r.r.CommonName(),
+	}).Debug("List platforms")
+	m, err := s.rc.ManifestGet(s.ctx, r.r)
+	if err != nil {
+		ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+	}
+	lPlats := ls.NewTable()
+	if m.IsList() {
+		pl, err := manifest.GetPlatformList(m)
+		if err != nil {
+			ls.RaiseError("Failed retrieving \"%s\" platforms: %v", r.r.CommonName(), err)
+		}
+		for _, p := range pl {
+			lPlats.Append(lua.LString(p.String()))
+		}
+	} else {
+		// a single platform image is read from the config
+		confDesc, err := m.GetConfig()
+		if err != nil {
+			ls.RaiseError("Failed looking up \"%s\" config digest: %v", r.r.CommonName(), err)
+		}
+		conf, err := s.rc.BlobGetOCIConfig(s.ctx, r.r, confDesc)
+		if err != nil {
+			ls.RaiseError("Failed retrieving \"%s\" config: %v", r.r.CommonName(), err)
+		}
+		oc := conf.GetConfig()
+		p := platform.Platform{OS: oc.OS, Architecture: oc.Architecture, Variant: oc.Variant}
+		lPlats.Append(lua.LString(p.String()))
+	}
+	ls.Push(lPlats)
+	return 1
+}
+
+// imageReferrers lists referrers using the OCI referrers tag schema,
+// an index tagged with the subject digest, "<alg>-<hex>", in the same repository
+func (s *Sandbox) imageReferrers(ls *lua.LState) int {
+	err := s.ctx.Err()
+	if err != nil {
+		ls.RaiseError("Context error: %v", err)
+	}
+	r := s.checkReference(ls, 1)
+	artifactType := ""
+	if ls.GetTop() >= 2 {
+		lOpts := ls.CheckTable(2)
+		if lv := lOpts.RawGetString("artifactType"); lv != lua.LNil {
+			artifactType = lv.String()
+		}
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":       s.name,
+		"image":        r.r.CommonName(),
+		"artifactType": artifactType,
+	}).Debug("List referrers")
+	dig := r.r.Digest
+	if dig == "" {
+		m, err := s.rc.ManifestHead(s.ctx, r.r)
+		if err != nil {
+			ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+		}
+		dig = m.GetDescriptor().Digest.String()
+		if dig == "" {
+			m, err = s.rc.ManifestGet(s.ctx, r.r)
+			if err != nil {
+				ls.RaiseError("Failed retrieving \"%s\" manifest: %v", r.r.CommonName(), err)
+			}
+			dig = m.GetDescriptor().Digest.String()
+		}
+	}
+	d, err := digest.Parse(dig)
+	if err != nil {
+		ls.RaiseError("Failed parsing \"%s\" digest: %v", r.r.CommonName(), err)
+	}
+	rReferrers := r.r
+	rReferrers.Digest = ""
+	rReferrers.Tag = d.Algorithm().String() + "-" + d.Encoded()
+	lRefs := ls.NewTable()
+	m, err := s.rc.ManifestGet(s.ctx, rReferrers)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			// no referrers have been pushed
+			ls.Push(lRefs)
+			return 1
+		}
+		ls.RaiseError("Failed retrieving \"%s\" referrers: %v", rReferrers.CommonName(), err)
+	}
+	if !m.IsList() {
+		ls.RaiseError("Referrers tag \"%s\" is not an index, media type: %s", rReferrers.CommonName(), manifest.GetMediaType(m))
+	}
+	dl, err := m.GetManifestList()
+	if err != nil {
+		ls.RaiseError("Failed retrieving \"%s\" referrers: %v", rReferrers.CommonName(), err)
+	}
+	for _, desc := range dl {
+		if artifactType != "" && desc.ArtifactType != artifactType {
+			continue
+		}
+		lDesc := ls.NewTable()
+		lDesc.RawSetString("mediaType", lua.LString(desc.MediaType))
+		lDesc.RawSetString("artifactType", lua.LString(desc.ArtifactType))
+		lDesc.RawSetString("digest", lua.LString(desc.Digest.String()))
+		lDesc.RawSetString("size", lua.LNumber(desc.Size))
+		lDesc.RawSetString("annotations", go2lua.Export(ls, desc.Annotations))
+		lRefs.Append(lDesc)
+	}
+	ls.Push(lRefs)
+	return 1
+}
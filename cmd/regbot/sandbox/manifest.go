@@ -111,7 +111,7 @@ func (s *Sandbox) manifestDelete(ls *lua.LState) int {
 		"image":   r.CommonName(),
 		"dry-run": s.dryRun,
 	}).Info("Delete manifest")
-	if s.dryRun {
+	if s.record(Action{Action: "manifest.delete", Ref: r.CommonName()}) {
 		return 0
 	}
 	err = s.rc.ManifestDelete(s.ctx, r)
@@ -249,14 +249,18 @@ func (s *Sandbox) manifestPut(ls *lua.LState) int {
 	sbm := s.checkManifest(ls, 1, true, false)
 	r := s.checkReference(ls, 2)
 	s.log.WithFields(logrus.Fields{
-		"script": s.name,
-		"image":  r.r.CommonName(),
+		"script":  s.name,
+		"image":   r.r.CommonName(),
+		"dry-run": s.dryRun,
 	}).Debug("Put manifest")
 
 	m, err := manifest.New(manifest.WithOrig(sbm.m.GetOrig()))
 	if err != nil {
 		ls.RaiseError("Failed to put manifest: %v", err)
 	}
+	if s.record(Action{Action: "manifest.put", Ref: r.r.CommonName()}) {
+		return 0
+	}
 
 	err = s.rc.ManifestPut(s.ctx, r.r, m)
 	if err != nil {
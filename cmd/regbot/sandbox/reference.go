@@ -35,11 +35,16 @@ func (s *Sandbox) newReference(ls *lua.LState) int {
 		ls.RaiseError("Context error: %v", err)
 	}
 	r := s.checkReference(ls, 1)
+	s.pushReference(ls, r.r)
+	return 1
+}
+
+// pushReference returns a reference object to Lua
+func (s *Sandbox) pushReference(ls *lua.LState, r ref.Ref) {
 	ud := ls.NewUserData()
-	ud.Value = &reference{r: r.r}
+	ud.Value = &reference{r: r}
 	ls.SetMetatable(ud, ls.GetTypeMetatable(luaReferenceName))
 	ls.Push(ud)
-	return 1
 }
 
 func (s *Sandbox) closeReference(ls *lua.LState) int {
@@ -1,6 +1,8 @@
 package sandbox
 
 import (
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/scheme"
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -24,11 +26,30 @@ func (s *Sandbox) repoLs(ls *lua.LState) int {
 		ls.ArgError(1, "Expected registry name (host and optional port)")
 	}
 	host := hostLVS.String()
+	opts := []scheme.RepoOpts{}
+	lOpts := struct {
+		Last  string `json:"last"`
+		Limit int    `json:"limit"`
+	}{}
+	if ls.GetTop() >= 2 {
+		err := go2lua.Import(ls, ls.Get(2), &lOpts, lOpts)
+		if err != nil {
+			ls.RaiseError("Failed to parse options: %v", err)
+		}
+		if lOpts.Last != "" {
+			opts = append(opts, scheme.WithRepoLast(lOpts.Last))
+		}
+		if lOpts.Limit > 0 {
+			opts = append(opts, scheme.WithRepoLimit(lOpts.Limit))
+		}
+	}
 	s.log.WithFields(logrus.Fields{
 		"script": s.name,
 		"host":   host,
+		"last":   lOpts.Last,
+		"limit":  lOpts.Limit,
 	}).Debug("Listing repositories")
-	repoList, err := s.rc.RepoList(s.ctx, host)
+	repoList, err := s.rc.RepoList(s.ctx, host, opts...)
 	if err != nil {
 		ls.RaiseError("Failed retrieving repo list: %v", err)
 	}
@@ -3,9 +3,12 @@ package sandbox
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/regclient/regclient/cmd/regbot/internal/state"
 	"github.com/sirupsen/logrus"
 	lua "github.com/yuin/gopher-lua"
 	"golang.org/x/sync/semaphore"
@@ -19,17 +22,41 @@ const (
 	luaImageName       = "image"
 	luaImageConfigName = "imageconfig"
 	luaBlobName        = "blob"
+	luaStateName       = "state"
+	luaHTTPName        = "http"
 )
 
 // Sandbox defines a lua sandbox
 type Sandbox struct {
-	name   string
-	ctx    context.Context
-	log    *logrus.Logger
-	ls     *lua.LState
-	rc     *regclient.RegClient
-	sem    *semaphore.Weighted
-	dryRun bool
+	name      string
+	ctx       context.Context
+	log       *logrus.Logger
+	ls        *lua.LState
+	rc        *regclient.RegClient
+	sem       *semaphore.Weighted
+	state     *state.Store
+	httpHosts []string
+	recorder  func(Action)
+	event     *Event
+	dryRun    bool
+}
+
+// Event describes the trigger that started a script
+type Event struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Repo   string `json:"repo"`
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
+}
+
+// Action is an external change requested by a script
+type Action struct {
+	Action string `yaml:"action" json:"action"`
+	Ref    string `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Source string `yaml:"source,omitempty" json:"source,omitempty"`
+	File   string `yaml:"file,omitempty" json:"file,omitempty"`
+	Host   string `yaml:"host,omitempty" json:"host,omitempty"`
 }
 
 // LuaMod defines a mod to add to Lua's sandbox
@@ -42,6 +69,8 @@ var luaMods = []LuaMod{
 	setupImage,
 	setupManifest,
 	setupBlob,
+	setupState,
+	setupHTTP,
 }
 
 // Opt function to process options on sandbox
@@ -70,6 +99,9 @@ func New(name string, opts ...Opt) *Sandbox {
 	if s.rc == nil {
 		s.rc = regclient.New()
 	}
+	if s.state == nil {
+		s.state = state.New("")
+	}
 
 	// setup modules for the sandbox
 	for _, mod := range luaMods {
@@ -79,6 +111,9 @@ func New(name string, opts ...Opt) *Sandbox {
 	// add other global functions to sandbox
 	fn := s.ls.NewFunction(s.sandboxLog)
 	s.ls.SetGlobal("log", fn)
+	if s.event != nil {
+		s.ls.SetGlobal("event", go2lua.Export(s.ls, s.event))
+	}
 
 	return s
 }
@@ -97,6 +132,20 @@ func WithDryRun() Opt {
 	}
 }
 
+// WithEvent passes the triggering event to the script in the "event" global
+func WithEvent(e Event) Opt {
+	return func(s *Sandbox) {
+		s.event = &e
+	}
+}
+
+// WithHTTPHosts allows http requests to the listed hosts, all requests are blocked by default
+func WithHTTPHosts(hosts []string) Opt {
+	return func(s *Sandbox) {
+		s.httpHosts = hosts
+	}
+}
+
 // WithLog specifies a logrus logger
 func WithLog(log *logrus.Logger) Opt {
 	return func(s *Sandbox) {
@@ -104,6 +153,13 @@ func WithLog(log *logrus.Logger) Opt {
 	}
 }
 
+// WithRecorder passes each external change to rec instead of running it, used to test scripts
+func WithRecorder(rec func(Action)) Opt {
+	return func(s *Sandbox) {
+		s.recorder = rec
+	}
+}
+
 // WithRegClient specifies a regclient interface
 func WithRegClient(rc *regclient.RegClient) Opt {
 	return func(s *Sandbox) {
@@ -118,6 +174,22 @@ func WithSemaphore(sem *semaphore.Weighted) Opt {
 	}
 }
 
+// WithState specifies the store for the state module, entries are namespaced by the sandbox name
+func WithState(st *state.Store) Opt {
+	return func(s *Sandbox) {
+		s.state = st
+	}
+}
+
+// record reports an action to the recorder, returning true when the action should be skipped
+func (s *Sandbox) record(a Action) bool {
+	if s.recorder != nil {
+		s.recorder(a)
+		return true
+	}
+	return s.dryRun
+}
+
 func (s *Sandbox) setupMod(name string, funcs map[string]lua.LGFunction, tables map[string]map[string]lua.LGFunction) {
 	mt := s.ls.NewTypeMetatable(name)
 	s.ls.SetGlobal(name, mt)
@@ -212,3 +284,65 @@ func unwrapUserData(ls *lua.LState, lv lua.LValue) (lua.LValue, error) {
 
 	return udMT, nil
 }
+
+// importValue converts a Lua value into a JSON compatible Go value.
+// Tables with only sequential integer keys become slices, other tables become maps.
+func importValue(lv lua.LValue, seen map[*lua.LTable]bool) (interface{}, error) {
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LTable:
+		if seen[v] {
+			return nil, fmt.Errorf("recursive table is not supported")
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		count := 0
+		v.ForEach(func(_, _ lua.LValue) { count++ })
+		if n := v.MaxN(); n > 0 && n == count {
+			l := make([]interface{}, n)
+			for i := 0; i < n; i++ {
+				item, err := importValue(v.RawGetInt(i+1), seen)
+				if err != nil {
+					return nil, err
+				}
+				l[i] = item
+			}
+			return l, nil
+		}
+		m := map[string]interface{}{}
+		var err error
+		v.ForEach(func(k, lvi lua.LValue) {
+			if err != nil {
+				return
+			}
+			if k.Type() != lua.LTString && k.Type() != lua.LTNumber {
+				err = fmt.Errorf("unsupported key type %s", k.Type().String())
+				return
+			}
+			m[k.String()], err = importValue(lvi, seen)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", lv.Type().String())
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
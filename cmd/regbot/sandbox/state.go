@@ -0,0 +1,92 @@
+package sandbox
+
+import (
+	"github.com/regclient/regclient/cmd/regbot/internal/go2lua"
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func setupState(s *Sandbox) {
+	s.setupMod(
+		luaStateName,
+		map[string]lua.LGFunction{
+			"delete": s.stateDelete,
+			"get":    s.stateGet,
+			"list":   s.stateList,
+			"set":    s.stateSet,
+		},
+		map[string]map[string]lua.LGFunction{
+			"__index": {},
+		},
+	)
+}
+
+func (s *Sandbox) stateDelete(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"key":     key,
+		"dry-run": s.dryRun,
+	}).Debug("Delete state")
+	if s.dryRun {
+		return 0
+	}
+	err := s.state.Delete(s.name, key)
+	if err != nil {
+		ls.RaiseError("Failed deleting state \"%s\": %v", key, err)
+	}
+	return 0
+}
+
+func (s *Sandbox) stateGet(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	val, ok, err := s.state.Get(s.name, key)
+	if err != nil {
+		ls.RaiseError("Failed reading state \"%s\": %v", key, err)
+	}
+	if !ok {
+		ls.Push(lua.LNil)
+		return 1
+	}
+	ls.Push(go2lua.Export(ls, val))
+	return 1
+}
+
+func (s *Sandbox) stateList(ls *lua.LState) int {
+	prefix := ls.OptString(1, "")
+	keys, err := s.state.List(s.name, prefix)
+	if err != nil {
+		ls.RaiseError("Failed listing state: %v", err)
+	}
+	lKeys := ls.NewTable()
+	for _, key := range keys {
+		lKeys.Append(lua.LString(key))
+	}
+	ls.Push(lKeys)
+	return 1
+}
+
+func (s *Sandbox) stateSet(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	val, err := importValue(ls.CheckAny(2), map[*lua.LTable]bool{})
+	if err != nil {
+		ls.ArgError(2, err.Error())
+	}
+	s.log.WithFields(logrus.Fields{
+		"script":  s.name,
+		"key":     key,
+		"dry-run": s.dryRun,
+	}).Debug("Set state")
+	if s.dryRun {
+		return 0
+	}
+	if val == nil {
+		err = s.state.Delete(s.name, key)
+	} else {
+		err = s.state.Set(s.name, key, val)
+	}
+	if err != nil {
+		ls.RaiseError("Failed setting state \"%s\": %v", key, err)
+	}
+	return 0
+}
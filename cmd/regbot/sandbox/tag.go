@@ -31,7 +31,7 @@ func (s *Sandbox) tagDelete(ls *lua.LState) int {
 		"image":   r.r.CommonName(),
 		"dry-run": s.dryRun,
 	}).Info("Delete tag")
-	if s.dryRun {
+	if s.record(Action{Action: "tag.delete", Ref: r.r.CommonName()}) {
 		return 0
 	}
 	err = s.rc.TagDelete(s.ctx, r.r)
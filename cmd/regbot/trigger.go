@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	watchInterval   = 5 * time.Minute
+	eventQueueMax   = 100
+	triggerBodyMax  = 1024 * 1024
+	triggerPathAPI  = "/trigger/"
+	triggerPathHook = "/webhook"
+)
+
+// notifyEnvelope is the registry notification format from the distribution project
+type notifyEnvelope struct {
+	Events []notifyEvent `json:"events"`
+}
+
+type notifyEvent struct {
+	Action string `json:"action"`
+	Target struct {
+		MediaType  string `json:"mediaType"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		Host string `json:"host"`
+	} `json:"request"`
+}
+
+// eventRunner runs triggered and scheduled scripts, one at a time for each script.
+// Events waiting on a script are queued, a newer event for the same tag replaces a pending event,
+// and events are dropped when the queue reaches eventQueueMax.
+type eventRunner struct {
+	ctx     context.Context
+	wg      *sync.WaitGroup
+	mu      sync.Mutex
+	locks   map[string]*sync.Mutex
+	queues  map[string][]sandbox.Event
+	active  map[string]bool
+	process func(context.Context, ConfigScript, *sandbox.Event) error
+}
+
+func newEventRunner(ctx context.Context, wg *sync.WaitGroup) *eventRunner {
+	return &eventRunner{
+		ctx:    ctx,
+		wg:     wg,
+		locks:  map[string]*sync.Mutex{},
+		queues: map[string][]sandbox.Event{},
+		active: map[string]bool{},
+		process: func(ctx context.Context, s ConfigScript, ev *sandbox.Event) error {
+			return s.processEvent(ctx, ev)
+		},
+	}
+}
+
+// lock returns the lock held while a script runs, shared by scheduled and triggered runs
+func (er *eventRunner) lock(name string) *sync.Mutex {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	lock, ok := er.locks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		er.locks[name] = lock
+	}
+	return lock
+}
+
+// run queues an event for the script, starting a worker when the script has none running
+func (er *eventRunner) run(s ConfigScript, ev sandbox.Event) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	queue := er.queues[s.Name]
+	for i, qEv := range queue {
+		if qEv.Type == ev.Type && qEv.Action == ev.Action && qEv.Repo == ev.Repo && qEv.Tag == ev.Tag {
+			queue[i] = ev
+			return
+		}
+	}
+	if len(queue) >= eventQueueMax {
+		log.WithFields(logrus.Fields{
+			"script": s.Name,
+			"type":   ev.Type,
+			"action": ev.Action,
+			"repo":   ev.Repo,
+			"tag":    ev.Tag,
+		}).Warn("Event queue is full, dropping event")
+		return
+	}
+	er.queues[s.Name] = append(queue, ev)
+	if er.active[s.Name] {
+		return
+	}
+	er.active[s.Name] = true
+	er.wg.Add(1)
+	go er.worker(s)
+}
+
+// worker runs the queued events for a script until the queue is empty
+func (er *eventRunner) worker(s ConfigScript) {
+	defer er.wg.Done()
+	lock := er.lock(s.Name)
+	for {
+		er.mu.Lock()
+		queue := er.queues[s.Name]
+		if len(queue) == 0 || er.ctx.Err() != nil {
+			delete(er.queues, s.Name)
+			er.active[s.Name] = false
+			er.mu.Unlock()
+			return
+		}
+		ev := queue[0]
+		er.queues[s.Name] = queue[1:]
+		er.mu.Unlock()
+
+		lock.Lock()
+		log.WithFields(logrus.Fields{
+			"script": s.Name,
+			"type":   ev.Type,
+			"action": ev.Action,
+			"repo":   ev.Repo,
+			"tag":    ev.Tag,
+			"digest": ev.Digest,
+		}).Info("Running triggered script")
+		// errors are logged by process
+		_ = er.process(er.ctx, s, &ev)
+		lock.Unlock()
+	}
+}
+
+// triggerServer receives registry notifications and manual trigger requests
+type triggerServer struct {
+	scripts []ConfigScript
+	token   string
+	run     func(ConfigScript, sandbox.Event)
+}
+
+func (ts *triggerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if ts.token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+ts.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	switch {
+	case r.URL.Path == triggerPathHook:
+		ts.serveWebhook(w, r)
+	case strings.HasPrefix(r.URL.Path, triggerPathAPI):
+		ts.serveManual(w, r, strings.TrimPrefix(r.URL.Path, triggerPathAPI))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (ts *triggerServer) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	env := notifyEnvelope{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, triggerBodyMax)).Decode(&env)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Failed to parse webhook")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, ne := range env.Events {
+		if !notifyIsManifest(ne.Target.MediaType) {
+			continue
+		}
+		ev := sandbox.Event{
+			Type:   TriggerWebhook,
+			Action: ne.Action,
+			Repo:   ne.Target.Repository,
+			Tag:    ne.Target.Tag,
+			Digest: ne.Target.Digest,
+		}
+		if ne.Request.Host != "" {
+			ev.Repo = ne.Request.Host + "/" + ne.Target.Repository
+		}
+		for _, s := range ts.scripts {
+			for _, t := range s.Triggers {
+				if t.Type == TriggerWebhook && t.matchWebhook(ne.Target.Repository, ev) {
+					ts.run(s, ev)
+					break
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ts *triggerServer) serveManual(w http.ResponseWriter, r *http.Request, name string) {
+	for _, s := range ts.scripts {
+		if s.Name != name {
+			continue
+		}
+		for _, t := range s.Triggers {
+			if t.Type != TriggerManual {
+				continue
+			}
+			// the optional body provides the event details
+			ev := sandbox.Event{}
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, triggerBodyMax)).Decode(&ev)
+			if err != nil && !errors.Is(err, io.EOF) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			ev.Type = TriggerManual
+			ts.run(s, ev)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// notifyIsManifest filters notifications for blobs, delete events do not include a media type
+func notifyIsManifest(mt string) bool {
+	switch mt {
+	case "", types.MediaTypeDocker1Manifest, types.MediaTypeDocker1ManifestSigned,
+		types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList,
+		types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
+		return true
+	}
+	return false
+}
+
+// matchWebhook checks the repository and tag patterns and the list of actions
+func (t ConfigTrigger) matchWebhook(repoPath string, ev sandbox.Event) bool {
+	if t.Repo != "" {
+		matchPath, _ := path.Match(t.Repo, repoPath)
+		matchFull, _ := path.Match(t.Repo, ev.Repo)
+		if !matchPath && !matchFull {
+			return false
+		}
+	}
+	if t.Tag != "" {
+		if match, _ := path.Match(t.Tag, ev.Tag); !match {
+			return false
+		}
+	}
+	if len(t.Actions) > 0 {
+		for _, a := range t.Actions {
+			if a == ev.Action {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// watchRepo polls a repository, running the script for each changed tag
+func watchRepo(ctx context.Context, s ConfigScript, t ConfigTrigger, run func(ConfigScript, sandbox.Event)) {
+	r, err := ref.New(t.Repo)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"script": s.Name,
+			"repo":   t.Repo,
+			"error":  err,
+		}).Error("Failed to parse watch repo")
+		return
+	}
+	interval := t.Interval
+	if interval <= 0 {
+		interval = watchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var prev map[string]string
+	for {
+		cur, err := watchPoll(ctx, r, t.Tag)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"script": s.Name,
+				"repo":   t.Repo,
+				"error":  err,
+			}).Warn("Failed to poll watch repo")
+		} else {
+			// the first poll sets the baseline
+			if prev != nil {
+				for _, ev := range watchDiff(r.CommonName(), prev, cur) {
+					run(s, ev)
+				}
+			}
+			prev = cur
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchPoll returns the digest of each tag matching the pattern
+func watchPoll(ctx context.Context, r ref.Ref, tagPattern string) (map[string]string, error) {
+	tl, err := rc.TagList(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := tl.GetTags()
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	for _, tag := range tags {
+		if tagPattern != "" {
+			if match, _ := path.Match(tagPattern, tag); !match {
+				continue
+			}
+		}
+		rTag := r
+		rTag.Tag = tag
+		rTag.Digest = ""
+		m, err := rc.ManifestHead(ctx, rTag)
+		if err != nil {
+			return nil, err
+		}
+		digests[tag] = manifest.GetDigest(m).String()
+	}
+	return digests, nil
+}
+
+// watchDiff returns push events for new or changed tags and delete events for removed tags
+func watchDiff(repo string, prev, cur map[string]string) []sandbox.Event {
+	events := []sandbox.Event{}
+	for tag, d := range cur {
+		if prevD, ok := prev[tag]; !ok || prevD != d {
+			events = append(events, sandbox.Event{Type: TriggerWatch, Action: "push", Repo: repo, Tag: tag, Digest: d})
+		}
+	}
+	for tag, d := range prev {
+		if _, ok := cur[tag]; !ok {
+			events = append(events, sandbox.Event{Type: TriggerWatch, Action: "delete", Repo: repo, Tag: tag, Digest: d})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Tag < events[j].Tag
+	})
+	return events
+}
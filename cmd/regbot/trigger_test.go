@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/cmd/regbot/sandbox"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestTriggerServer(t *testing.T) {
+	scripts := []ConfigScript{
+		{
+			Name: "hook-all",
+			Triggers: []ConfigTrigger{
+				{Type: TriggerWebhook},
+			},
+		},
+		{
+			Name: "hook-filtered",
+			Triggers: []ConfigTrigger{
+				{Type: TriggerWebhook, Repo: "library/*", Tag: "v*", Actions: []string{"push"}},
+			},
+		},
+		{
+			Name: "manual",
+			Triggers: []ConfigTrigger{
+				{Type: TriggerManual},
+			},
+		},
+		{
+			Name: "schedule-only",
+		},
+	}
+	mu := sync.Mutex{}
+	runs := map[string][]sandbox.Event{}
+	ts := httptest.NewServer(&triggerServer{
+		scripts: scripts,
+		token:   "secret",
+		run: func(s ConfigScript, ev sandbox.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[s.Name] = append(runs[s.Name], ev)
+		},
+	})
+	defer ts.Close()
+	hookPush := `{"events":[
+	  {"action":"push","target":{"mediaType":"` + types.MediaTypeOCI1Manifest + `","digest":"sha256:1234","repository":"library/app","tag":"v1"},"request":{"host":"registry.example.com"}},
+	  {"action":"push","target":{"mediaType":"` + types.MediaTypeOCI1Layer + `","digest":"sha256:5678","repository":"library/app"},"request":{"host":"registry.example.com"}},
+	  {"action":"pull","target":{"mediaType":"` + types.MediaTypeOCI1Manifest + `","digest":"sha256:1234","repository":"library/app","tag":"v1"},"request":{"host":"registry.example.com"}},
+	  {"action":"push","target":{"mediaType":"` + types.MediaTypeOCI1Manifest + `","digest":"sha256:9999","repository":"other/app","tag":"v1"},"request":{"host":"registry.example.com"}}
+	]}`
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		noAuth    bool
+		expStatus int
+		expRuns   map[string][]sandbox.Event
+	}{
+		{
+			name:      "unauthorized",
+			method:    "POST",
+			path:      "/webhook",
+			body:      hookPush,
+			noAuth:    true,
+			expStatus: http.StatusUnauthorized,
+			expRuns:   map[string][]sandbox.Event{},
+		},
+		{
+			name:      "get",
+			method:    "GET",
+			path:      "/webhook",
+			expStatus: http.StatusMethodNotAllowed,
+			expRuns:   map[string][]sandbox.Event{},
+		},
+		{
+			name:      "webhook",
+			method:    "POST",
+			path:      "/webhook",
+			body:      hookPush,
+			expStatus: http.StatusOK,
+			expRuns: map[string][]sandbox.Event{
+				"hook-all": {
+					{Type: TriggerWebhook, Action: "push", Repo: "registry.example.com/library/app", Tag: "v1", Digest: "sha256:1234"},
+					{Type: TriggerWebhook, Action: "pull", Repo: "registry.example.com/library/app", Tag: "v1", Digest: "sha256:1234"},
+					{Type: TriggerWebhook, Action: "push", Repo: "registry.example.com/other/app", Tag: "v1", Digest: "sha256:9999"},
+				},
+				"hook-filtered": {
+					{Type: TriggerWebhook, Action: "push", Repo: "registry.example.com/library/app", Tag: "v1", Digest: "sha256:1234"},
+				},
+			},
+		},
+		{
+			name:      "webhook invalid",
+			method:    "POST",
+			path:      "/webhook",
+			body:      "{",
+			expStatus: http.StatusBadRequest,
+			expRuns:   map[string][]sandbox.Event{},
+		},
+		{
+			name:      "manual",
+			method:    "POST",
+			path:      "/trigger/manual",
+			body:      `{"repo":"registry.example.com/app","tag":"v2"}`,
+			expStatus: http.StatusAccepted,
+			expRuns: map[string][]sandbox.Event{
+				"manual": {
+					{Type: TriggerManual, Repo: "registry.example.com/app", Tag: "v2"},
+				},
+			},
+		},
+		{
+			name:      "manual empty body",
+			method:    "POST",
+			path:      "/trigger/manual",
+			expStatus: http.StatusAccepted,
+			expRuns: map[string][]sandbox.Event{
+				"manual": {
+					{Type: TriggerManual},
+				},
+			},
+		},
+		{
+			name:      "manual not enabled",
+			method:    "POST",
+			path:      "/trigger/schedule-only",
+			expStatus: http.StatusNotFound,
+			expRuns:   map[string][]sandbox.Event{},
+		},
+		{
+			name:      "manual missing",
+			method:    "POST",
+			path:      "/trigger/missing",
+			expStatus: http.StatusNotFound,
+			expRuns:   map[string][]sandbox.Event{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			runs = map[string][]sandbox.Event{}
+			mu.Unlock()
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if !tt.noAuth {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expStatus {
+				t.Errorf("unexpected status, expected %d, received %d", tt.expStatus, resp.StatusCode)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(runs) != len(tt.expRuns) {
+				t.Errorf("unexpected runs, expected %v, received %v", tt.expRuns, runs)
+				return
+			}
+			for name, expEvents := range tt.expRuns {
+				if len(runs[name]) != len(expEvents) {
+					t.Errorf("unexpected events for %s, expected %v, received %v", name, expEvents, runs[name])
+					continue
+				}
+				for i := range expEvents {
+					if runs[name][i] != expEvents[i] {
+						t.Errorf("unexpected event for %s, expected %v, received %v", name, expEvents[i], runs[name][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEventRunner(t *testing.T) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	er := newEventRunner(ctx, &wg)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mu := sync.Mutex{}
+	running := 0
+	received := []sandbox.Event{}
+	er.process = func(ctx context.Context, s ConfigScript, ev *sandbox.Event) error {
+		mu.Lock()
+		running++
+		if running > 1 {
+			t.Errorf("concurrent runs of %s", s.Name)
+		}
+		first := len(received) == 0
+		received = append(received, *ev)
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	s := ConfigScript{Name: "queue"}
+	er.run(s, sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v1", Digest: "sha256:1111"})
+	<-started
+	// queued events for the same tag are merged
+	er.run(s, sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v1", Digest: "sha256:1112"})
+	er.run(s, sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v2", Digest: "sha256:2222"})
+	er.run(s, sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v1", Digest: "sha256:1113"})
+	// events beyond the queue limit are dropped
+	for i := 0; i < eventQueueMax; i++ {
+		er.run(s, sandbox.Event{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: fmt.Sprintf("q%d", i)})
+	}
+	close(release)
+	wg.Wait()
+	if len(received) != eventQueueMax+1 {
+		t.Fatalf("unexpected number of runs, expected %d, received %d", eventQueueMax+1, len(received))
+	}
+	expect := []sandbox.Event{
+		{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v1", Digest: "sha256:1111"},
+		{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v1", Digest: "sha256:1113"},
+		{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "v2", Digest: "sha256:2222"},
+		{Type: TriggerWebhook, Action: "push", Repo: "repo", Tag: "q0"},
+	}
+	for i := range expect {
+		if received[i] != expect[i] {
+			t.Errorf("unexpected event %d, expected %v, received %v", i, expect[i], received[i])
+		}
+	}
+	if last := received[len(received)-1].Tag; last != fmt.Sprintf("q%d", eventQueueMax-3) {
+		t.Errorf("unexpected last event, received %s", last)
+	}
+	if er.active[s.Name] || len(er.queues) != 0 {
+		t.Errorf("worker state not cleared, active %v, queues %v", er.active, er.queues)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(rwfs.OSNew(""), "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc = regclient.New(regclient.WithFS(fsMem))
+	r, err := ref.New("ocidir://testrepo")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	cur, err := watchPoll(ctx, r, "v[12]")
+	if err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+	if len(cur) != 2 || cur["v1"] != "sha256:94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694" || cur["v2"] == "" {
+		t.Errorf("unexpected poll result: %v", cur)
+	}
+
+	prev := map[string]string{
+		"v1": "sha256:1111",
+		"v2": "sha256:2222",
+		"v3": "sha256:3333",
+	}
+	next := map[string]string{
+		"v1": "sha256:1111",
+		"v2": "sha256:2223",
+		"v4": "sha256:4444",
+	}
+	expect := []sandbox.Event{
+		{Type: TriggerWatch, Action: "push", Repo: "ocidir://testrepo", Tag: "v2", Digest: "sha256:2223"},
+		{Type: TriggerWatch, Action: "delete", Repo: "ocidir://testrepo", Tag: "v3", Digest: "sha256:3333"},
+		{Type: TriggerWatch, Action: "push", Repo: "ocidir://testrepo", Tag: "v4", Digest: "sha256:4444"},
+	}
+	events := watchDiff("ocidir://testrepo", prev, next)
+	if len(events) != len(expect) {
+		t.Fatalf("unexpected events, expected %v, received %v", expect, events)
+	}
+	for i := range expect {
+		if events[i] != expect[i] {
+			t.Errorf("unexpected event, expected %v, received %v", expect[i], events[i])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/regclient/regclient/internal/blobcache"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/pkg/template"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache <cmd>",
+	Short: "manage the local blob cache",
+	Long: `The blob cache stores blobs and manifests pulled by digest in a local
+directory. Cached content is used instead of pulling from the registry.`,
+}
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove content from the cache",
+	Long: `Remove the least recently used content from the cache until it is under the
+maximum size. Abandoned temporary files are also removed.`,
+	Args: cobra.ExactArgs(0),
+	RunE: runCachePrune,
+}
+var cacheSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "configure the cache",
+	Long: `Set the directory and maximum size of the cache. The cache is disabled when
+the directory is empty. Sizes may include a unit, e.g. "512m" or "10g".`,
+	Args: cobra.ExactArgs(0),
+	RunE: runCacheSet,
+}
+
+var cacheOpts struct {
+	dir     string
+	maxSize string
+	format  string
+}
+
+func init() {
+	cachePruneCmd.Flags().StringVarP(&cacheOpts.maxSize, "max-size", "", "", "Maximum size of the cache, defaults to the configured size")
+	cachePruneCmd.Flags().StringVarP(&cacheOpts.format, "format", "", "{{printf \"%d entries, %d bytes removed\\n\" .Removed .Freed}}", "Format output with go template syntax")
+	cachePruneCmd.RegisterFlagCompletionFunc("max-size", completeArgNone)
+	cachePruneCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+
+	cacheSetCmd.Flags().StringVarP(&cacheOpts.dir, "dir", "", "", "Directory for the cache, empty to disable")
+	cacheSetCmd.Flags().StringVarP(&cacheOpts.maxSize, "max-size", "", "", "Maximum size of the cache, 0 for no limit")
+
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheSetCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	c, err := ConfigLoadDefault()
+	if err != nil {
+		return err
+	}
+	if c.BlobCache == nil || c.BlobCache.Dir == "" {
+		return fmt.Errorf("cache directory is not configured, see \"regctl cache set\": %w", ErrMissingInput)
+	}
+	maxSize := c.BlobCache.MaxSize
+	if flagChanged(cmd, "max-size") {
+		maxSize, err = units.RAMInBytes(cacheOpts.maxSize)
+		if err != nil {
+			return fmt.Errorf("failed to parse max size %s: %w", cacheOpts.maxSize, ErrInvalidInput)
+		}
+	}
+	bc := blobcache.New(rwfs.OSNew(""), c.BlobCache.Dir, c.BlobCache.MaxSize)
+	before, err := bc.Stats()
+	if err != nil {
+		return err
+	}
+	after, err := bc.Prune(maxSize)
+	if err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"dir":     c.BlobCache.Dir,
+		"maxSize": maxSize,
+		"count":   after.Count,
+		"size":    after.Size,
+	}).Info("Cache pruned")
+	result := struct {
+		Dir     string
+		Count   int
+		Size    int64
+		Removed int
+		Freed   int64
+	}{
+		Dir:     c.BlobCache.Dir,
+		Count:   after.Count,
+		Size:    after.Size,
+		Removed: before.Count - after.Count,
+		Freed:   before.Size - after.Size,
+	}
+	return template.Writer(os.Stdout, cacheOpts.format, result)
+}
+
+func runCacheSet(cmd *cobra.Command, args []string) error {
+	c, err := ConfigLoadDefault()
+	if err != nil {
+		return err
+	}
+	if c.BlobCache == nil {
+		c.BlobCache = &ConfigBlobCache{}
+	}
+	if flagChanged(cmd, "dir") {
+		c.BlobCache.Dir = cacheOpts.dir
+	}
+	if flagChanged(cmd, "max-size") {
+		maxSize, err := units.RAMInBytes(cacheOpts.maxSize)
+		if err != nil {
+			return fmt.Errorf("failed to parse max size %s: %w", cacheOpts.maxSize, ErrInvalidInput)
+		}
+		c.BlobCache.MaxSize = maxSize
+	}
+	if c.BlobCache.Dir == "" && c.BlobCache.MaxSize == 0 {
+		c.BlobCache = nil
+	}
+	err = c.ConfigSave()
+	if err != nil {
+		return err
+	}
+	log.Info("Cache configuration updated")
+	return nil
+}
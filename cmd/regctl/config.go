@@ -28,6 +28,13 @@ type Config struct {
 	Hosts         map[string]*config.Host `json:"hosts"`
 	IncDockerCred *bool                   `json:"incDockerCred,omitempty"`
 	IncDockerCert *bool                   `json:"incDockerCert,omitempty"`
+	BlobCache     *ConfigBlobCache        `json:"blobCache,omitempty"`
+}
+
+// ConfigBlobCache struct contains the settings for the local blob cache
+type ConfigBlobCache struct {
+	Dir     string `json:"dir,omitempty"`     // directory for cached content, the cache is disabled when empty
+	MaxSize int64  `json:"maxSize,omitempty"` // bytes before the least recently used content is removed, 0 for no limit
 }
 
 // ConfigHost struct contains host specific settings
@@ -2,6 +2,15 @@ package main
 
 import "errors"
 
+const (
+	// exitCodeBaseChanged is returned by "image check-base" when the base image has changed
+	exitCodeBaseChanged = 2
+	// exitCodeBaseUnknown is returned by "image check-base" when the base image cannot be determined
+	exitCodeBaseUnknown = 3
+	// exitCodePolicyFailed is returned by "image policy" when a rule fails
+	exitCodePolicyFailed = 4
+)
+
 var (
 	// ErrCredsNotFound returned when creds needed and cannot be found
 	ErrCredsNotFound = errors.New("auth creds not found")
@@ -17,3 +26,17 @@ var (
 	// ErrUnsupportedConfigVersion happens when config file version is greater than this command supports
 	ErrUnsupportedConfigVersion = errors.New("unsupported config version")
 )
+
+// exitError returns a specific exit code from the command
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,8 +18,12 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -23,6 +33,18 @@ var imageCmd = &cobra.Command{
 	Use:   "image <cmd>",
 	Short: "manage images",
 }
+var imageCheckBaseCmd = &cobra.Command{
+	Use:   "check-base <image_ref>",
+	Short: "check if the base image has changed",
+	Long: `Check the base image (found using annotations or an option).
+If the base name is not provided, annotations are checked in the image.
+If the base digest changed, the base layers must still be a prefix of the image layers.
+The exit code is 0 when the base is unchanged, 2 when it has changed,
+and 3 when the base image is unknown.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageCheckBase,
+}
 var imageCopyCmd = &cobra.Command{
 	Use:     "copy <src_image_ref> <dst_image_ref>",
 	Aliases: []string{"cp"},
@@ -35,6 +57,17 @@ sends the manifest with the new tag.`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageCopy,
 }
+var imageCreateCmd = &cobra.Command{
+	Use:   "create <image_ref>",
+	Short: "create an image from a rootfs directory",
+	Long: `Create an image from one or more root filesystem directories.
+Each directory is packaged as a single layer with a generated config and manifest.
+Repeat --rootfs and --platform to create a multi-platform index,
+each platform is paired with the rootfs in the same position.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageCreate,
+}
 var imageDeleteCmd = &cobra.Command{
 	Use:     "delete <image_ref>",
 	Aliases: []string{"del", "rm", "remove"},
@@ -60,11 +93,25 @@ var imageExportCmd = &cobra.Command{
 	Short: "export image",
 	Long: `Exports an image into a tar file that can be later loaded into a docker
 engine with "docker load". The tar file is output to stdout by default.
-Example usage: regctl image export registry:5000/yourimg:v1 >yourimg-v1.tar`,
+Example usage: regctl image export registry:5000/yourimg:v1 >yourimg-v1.tar
+With "--flatten", the layers are merged into a single root filesystem tar,
+or extracted when the filename is an existing directory.`,
 	Args:              cobra.RangeArgs(1, 2),
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageExport,
 }
+var imageGetFileCmd = &cobra.Command{
+	Use:     "get-file <image_ref> <filename> [out_file]",
+	Aliases: []string{"extract"},
+	Short:   "get a file from an image",
+	Long: `Go through each of the image layers searching for the requested file.
+Layers are merged with whiteouts applied, and symlinks in the filename and
+parent directories are followed. The file is output to stdout unless an output
+filename is provided.`,
+	Args:              cobra.RangeArgs(2, 3),
+	ValidArgsFunction: completeArgList([]completeFunc{completeArgTag, completeArgNone, completeArgDefault}),
+	RunE:              runImageGetFile,
+}
 var imageImportCmd = &cobra.Command{
 	Use:   "import <image_ref> <filename>",
 	Short: "import image",
@@ -85,6 +132,15 @@ in docker, and inspecting it, but without pulling any of the image layers.`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageInspect,
 }
+var imageLsFilesCmd = &cobra.Command{
+	Use:   "ls-files <image_ref>",
+	Short: "list files in an image",
+	Long: `List the files in an image, showing the layer each file came from.
+Layers are merged with whiteouts applied, unless a single layer is selected.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageLsFiles,
+}
 var imageManifestCmd = &cobra.Command{
 	Use:               "manifest <image_ref>",
 	Short:             "show manifest or manifest list, same as \"manifest get\"",
@@ -102,6 +158,16 @@ var imageModCmd = &cobra.Command{
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageMod,
 }
+var imageVerifyCmd = &cobra.Command{
+	Use:   "verify <image_ref>",
+	Short: "verify image blobs and manifests",
+	Long: `Verify every manifest and blob in an image, checking the digests and sizes
+against the descriptors and the config diffIDs against the decompressed layers.
+Use --repair-from to replace missing or corrupt content from another image.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageVerify,
+}
 var imageRateLimitCmd = &cobra.Command{
 	Use:   "ratelimit <image_ref>",
 	Short: "show the current rate limit",
@@ -112,24 +178,55 @@ The other values may be 0 if not provided by the registry.`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runImageRateLimit,
 }
+var imageSizeCmd = &cobra.Command{
+	Use:   "size <image_ref>",
+	Short: "show the size of an image",
+	Long: `Shows the compressed size of each layer and platform in an image. For a
+multi-platform image, the total only counts content shared between platforms
+once. With --uncompressed, each layer is pulled and decompressed to report the
+uncompressed size and the largest files in the layer.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImageSize,
+}
 
 var imageOpts struct {
+	checkBaseDigest string
+	checkBaseRef    string
 	create          string
+	createConfig    string
+	createPlatforms []string
+	createRootfs    []string
+	fileFormat      string
 	forceRecursive  bool
 	format          string
 	includeExternal bool
 	digestTags      bool
+	flatten         bool
+	layer           int
 	list            bool
+	modIndexAdd     []ref.Ref
 	modOpts         []mod.Opts
 	platform        string
 	platforms       []string
+	repairFrom      string
 	replace         bool
 	requireList     bool
+	sizeFormat      string
+	sizeTop         int
+	uncompressed    bool
 }
 
 func init() {
 	imageOpts.modOpts = []mod.Opts{}
 
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.checkBaseRef, "base", "", "", "Base image reference (including tag)")
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.checkBaseDigest, "digest", "", "", "Base image digest (checks if digest matches base)")
+	imageCheckBaseCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("base", completeArgTag)
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("digest", completeArgNone)
+	imageCheckBaseCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.forceRecursive, "force-recursive", "", false, "Force recursive copy of image, repairs missing nested blobs and manifests")
 	imageCopyCmd.Flags().BoolVarP(&imageOpts.includeExternal, "include-external", "", false, "Include external layers")
 	imageCopyCmd.Flags().StringArrayVarP(&imageOpts.platforms, "platforms", "", []string{}, "Copy only specific platforms, registry validation must be disabled")
@@ -137,6 +234,14 @@ func init() {
 	// platforms should be treated as experimental since it will break many registries
 	imageCopyCmd.Flags().MarkHidden("platforms")
 
+	imageCreateCmd.Flags().StringVarP(&imageOpts.createConfig, "config", "", "", "OCI image config json file used as the base config")
+	imageCreateCmd.Flags().StringArrayVarP(&imageOpts.createPlatforms, "platform", "p", []string{}, "Platform for each rootfs (e.g. linux/amd64 or local)")
+	imageCreateCmd.Flags().StringArrayVarP(&imageOpts.createRootfs, "rootfs", "", []string{}, "Directory containing the root filesystem")
+	imageCreateCmd.RegisterFlagCompletionFunc("config", completeArgDefault)
+	imageCreateCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+	imageCreateCmd.RegisterFlagCompletionFunc("rootfs", completeArgDefault)
+	imageCreateCmd.MarkFlagRequired("rootfs")
+
 	imageDeleteCmd.Flags().BoolVarP(&manifestOpts.forceTagDeref, "force-tag-dereference", "", false, "Dereference the a tag to a digest, this is unsafe")
 
 	imageDigestCmd.Flags().BoolVarP(&manifestOpts.list, "list", "", true, "Do not resolve platform from manifest list (enabled by default)")
@@ -145,11 +250,25 @@ func init() {
 	imageDigestCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
 	imageDigestCmd.Flags().MarkHidden("list")
 
+	imageExportCmd.Flags().BoolVarP(&imageOpts.flatten, "flatten", "", false, "Export the merged root filesystem")
+	imageExportCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform with --flatten (e.g. linux/amd64 or local)")
+	imageExportCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
+	imageGetFileCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageGetFileCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageInspectCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
 	imageInspectCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
 	imageInspectCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
 	imageInspectCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	imageLsFilesCmd.Flags().StringVarP(&imageOpts.fileFormat, "format", "", imageLsFilesFormat, "Format output with go template syntax")
+	imageLsFilesCmd.Flags().IntVarP(&imageOpts.layer, "layer", "", -1, "Only list files in a single layer, starting from 0")
+	imageLsFilesCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageLsFilesCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	imageLsFilesCmd.RegisterFlagCompletionFunc("layer", completeArgNone)
+	imageLsFilesCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+
 	imageManifestCmd.Flags().BoolVarP(&manifestOpts.list, "list", "", true, "Output manifest list if available (enabled by default)")
 	imageManifestCmd.Flags().StringVarP(&manifestOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
 	imageManifestCmd.Flags().BoolVarP(&manifestOpts.requireList, "require-list", "", false, "Fail if manifest list is not received")
@@ -286,6 +405,18 @@ func init() {
 		},
 	}, "external-urls-rm", "", `remove external url references from layers (first copy image with "--include-external")`)
 	flagExtURLsRm.NoOptDefVal = "true"
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			r, err := ref.New(val)
+			if err != nil {
+				return fmt.Errorf("invalid image reference: %w", err)
+			}
+			imageOpts.modIndexAdd = append(imageOpts.modIndexAdd, r)
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithIndexAdd(r))
+			return nil
+		},
+	}, "index-add", "", `add the platforms from another image to the index (the image is first copied into the repository)`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "stringArray",
 		f: func(val string) error {
@@ -314,6 +445,13 @@ func init() {
 		},
 	}, "label-to-annotation", "", `set annotations from labels`)
 	flagLabelAnnot.NoOptDefVal = "true"
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithLayerFileRemove(val))
+			return nil
+		},
+	}, "layer-file-rm", "", `delete files matching a glob pattern from all layers (e.g. "**/*.pyc"), zstd layers are not supported`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -355,6 +493,57 @@ func init() {
 			return nil
 		},
 	}, "layer-time-max", "", `max timestamp for a layer`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "string",
+		f: func(val string) error {
+			pl := []platform.Platform{}
+			for _, ps := range strings.Split(val, ",") {
+				p, err := platform.Parse(ps)
+				if err != nil {
+					return fmt.Errorf("failed to parse platform %s: %w", ps, err)
+				}
+				pl = append(pl, p)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithPlatformKeep(pl))
+			return nil
+		},
+	}, "platform-keep", "", `keep only the listed platforms in an index (comma separated)`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			p, err := platform.Parse(val)
+			if err != nil {
+				return fmt.Errorf("failed to parse platform %s: %w", val, err)
+			}
+			imageOpts.modOpts = append(imageOpts.modOpts, mod.WithPlatformRemove(p))
+			return nil
+		},
+	}, "platform-rm", "", `delete a platform from an index`)
+	imageModCmd.Flags().VarP(&modFlagFunc{
+		t: "stringArray",
+		f: func(val string) error {
+			fh, err := os.Open(val)
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			recipe, err := mod.RecipeRead(fh)
+			if err != nil {
+				return fmt.Errorf("failed to load recipe %s: %w", val, err)
+			}
+			opts, err := recipe.Opts()
+			if err != nil {
+				return fmt.Errorf("failed to load recipe %s: %w", val, err)
+			}
+			rl, err := recipe.IndexAddRefs()
+			if err != nil {
+				return fmt.Errorf("failed to load recipe %s: %w", val, err)
+			}
+			imageOpts.modIndexAdd = append(imageOpts.modIndexAdd, rl...)
+			imageOpts.modOpts = append(imageOpts.modOpts, opts...)
+			return nil
+		},
+	}, "recipe", "", `apply the modifications listed in a yaml or json recipe file`)
 	imageModCmd.Flags().VarP(&modFlagFunc{
 		t: "string",
 		f: func(val string) error {
@@ -368,6 +557,20 @@ func init() {
 			return nil
 		},
 	}, "time-max", "", `max timestamp for both the config and layers`)
+	flagDocker := imageModCmd.Flags().VarPF(&modFlagFunc{
+		t: "bool",
+		f: func(val string) error {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("unable to parse value %s: %w", val, err)
+			}
+			if b {
+				imageOpts.modOpts = append(imageOpts.modOpts, mod.WithManifestToDocker())
+			}
+			return nil
+		},
+	}, "to-docker", "", `convert to Docker schema2 media types`)
+	flagDocker.NoOptDefVal = "true"
 	flagOCI := imageModCmd.Flags().VarPF(&modFlagFunc{
 		t: "bool",
 		f: func(val string) error {
@@ -400,18 +603,72 @@ func init() {
 	imageRateLimitCmd.Flags().StringVarP(&imageOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
 	imageRateLimitCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	imageSizeCmd.Flags().StringVarP(&imageOpts.sizeFormat, "format", "", imageSizeFormat, "Format output with go template syntax")
+	imageSizeCmd.Flags().StringVarP(&imageOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imageSizeCmd.Flags().IntVarP(&imageOpts.sizeTop, "top", "", 5, "Number of largest files to show for each layer with --uncompressed")
+	imageSizeCmd.Flags().BoolVarP(&imageOpts.uncompressed, "uncompressed", "", false, "Pull each layer to compute the uncompressed size")
+	imageSizeCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	imageSizeCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+	imageSizeCmd.RegisterFlagCompletionFunc("top", completeArgNone)
+
+	imageVerifyCmd.Flags().StringVarP(&imageOpts.repairFrom, "repair-from", "", "", "Image reference used to replace missing or corrupt content")
+	imageVerifyCmd.RegisterFlagCompletionFunc("repair-from", completeArgTag)
+
+	imageCmd.AddCommand(imageCheckBaseCmd)
 	imageCmd.AddCommand(imageCopyCmd)
+	imageCmd.AddCommand(imageCreateCmd)
 	imageCmd.AddCommand(imageDeleteCmd)
 	imageCmd.AddCommand(imageDigestCmd)
 	imageCmd.AddCommand(imageExportCmd)
+	imageCmd.AddCommand(imageGetFileCmd)
 	imageCmd.AddCommand(imageImportCmd)
 	imageCmd.AddCommand(imageInspectCmd)
+	imageCmd.AddCommand(imageLsFilesCmd)
 	imageCmd.AddCommand(imageManifestCmd)
 	imageCmd.AddCommand(imageModCmd)
 	imageCmd.AddCommand(imageRateLimitCmd)
+	imageCmd.AddCommand(imageSizeCmd)
+	imageCmd.AddCommand(imageVerifyCmd)
 	rootCmd.AddCommand(imageCmd)
 }
 
+func runImageCheckBase(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"base":     imageOpts.checkBaseRef,
+		"digest":   imageOpts.checkBaseDigest,
+		"platform": imageOpts.platform,
+	}).Debug("Image check base")
+	opts := []regclient.ImageOpts{}
+	if imageOpts.checkBaseRef != "" {
+		opts = append(opts, regclient.ImageWithCheckBaseRef(imageOpts.checkBaseRef))
+	}
+	if imageOpts.checkBaseDigest != "" {
+		opts = append(opts, regclient.ImageWithCheckBaseDigest(imageOpts.checkBaseDigest))
+	}
+	if imageOpts.platform != "" {
+		opts = append(opts, regclient.ImageWithPlatform(imageOpts.platform))
+	}
+	err = rc.ImageCheckBase(ctx, r, opts...)
+	if errors.Is(err, types.ErrMismatch) {
+		return exitError{code: exitCodeBaseChanged, err: fmt.Errorf("base image has changed: %w", err)}
+	} else if errors.Is(err, types.ErrMissingAnnotation) || errors.Is(err, types.ErrBaseUnavailable) {
+		return exitError{code: exitCodeBaseUnknown, err: fmt.Errorf("base image is unknown: %w", err)}
+	} else if err != nil {
+		return err
+	}
+	log.Info("base image matches")
+	return nil
+}
+
 func runImageCopy(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	rSrc, err := ref.New(args[0])
@@ -445,30 +702,253 @@ func runImageCopy(cmd *cobra.Command, args []string) error {
 	if len(imageOpts.platforms) > 0 {
 		opts = append(opts, regclient.ImageWithPlatforms(imageOpts.platforms))
 	}
+	progressOpts, progressFinish := imageProgressOpts()
+	defer progressFinish()
+	opts = append(opts, progressOpts...)
 	return rc.ImageCopy(ctx, rSrc, rTgt, opts...)
 }
 
+func runImageCreate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	if len(imageOpts.createPlatforms) > len(imageOpts.createRootfs) || (len(imageOpts.createRootfs) > 1 && len(imageOpts.createPlatforms) != len(imageOpts.createRootfs)) {
+		return fmt.Errorf("a platform must be provided for each rootfs: %w", ErrInvalidInput)
+	}
+	conf := v1.Image{}
+	if imageOpts.createConfig != "" {
+		b, err := os.ReadFile(imageOpts.createConfig)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(b, &conf)
+		if err != nil {
+			return fmt.Errorf("failed to parse config %s: %w", imageOpts.createConfig, err)
+		}
+	}
+	plats := []regclient.ImageCreatePlatform{}
+	for i, rootfs := range imageOpts.createRootfs {
+		p := platform.Local()
+		if i < len(imageOpts.createPlatforms) && imageOpts.createPlatforms[i] != "local" {
+			p, err = platform.Parse(imageOpts.createPlatforms[i])
+			if err != nil {
+				return err
+			}
+		}
+		plats = append(plats, regclient.ImageCreatePlatform{
+			Platform: p,
+			Rootfs:   rootfs,
+			Config:   conf,
+		})
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":       r.CommonName(),
+		"rootfs":    imageOpts.createRootfs,
+		"platforms": imageOpts.createPlatforms,
+	}).Debug("Image create")
+	return rc.ImageCreate(ctx, r, plats)
+}
+
 func runImageExport(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
 	if err != nil {
 		return err
 	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+	if imageOpts.flatten && len(args) == 2 {
+		if fi, err := os.Stat(args[1]); err == nil && fi.IsDir() {
+			return runImageExportFlattenDir(cmd, rc, r, args[1])
+		}
+	}
 	var w io.Writer
 	if len(args) == 2 {
-		w, err = os.Create(args[1])
+		fh, err := os.Create(args[1])
 		if err != nil {
 			return err
 		}
+		defer fh.Close()
+		w = fh
 	} else {
 		w = os.Stdout
 	}
+	log.WithFields(logrus.Fields{
+		"ref":     r.CommonName(),
+		"flatten": imageOpts.flatten,
+	}).Debug("Image export")
+	if imageOpts.flatten {
+		opts := []regclient.ImageOpts{}
+		if imageOpts.platform != "" {
+			opts = append(opts, regclient.ImageWithPlatform(imageOpts.platform))
+		}
+		return rc.ImageFlatten(ctx, r, w, opts...)
+	}
+	opts := []regclient.ImageOpts{}
+	if w != os.Stdout {
+		// the progress bar would corrupt an export written to the terminal
+		progressOpts, progressFinish := imageProgressOpts()
+		defer progressFinish()
+		opts = append(opts, progressOpts...)
+	}
+	return rc.ImageExport(ctx, r, w, opts...)
+}
+
+// runImageExportFlattenDir extracts the flattened image into a directory
+func runImageExportFlattenDir(cmd *cobra.Command, rc *regclient.RegClient, r ref.Ref, dir string) error {
+	ctx := cmd.Context()
+	log.WithFields(logrus.Fields{
+		"ref":       r.CommonName(),
+		"directory": dir,
+	}).Debug("Image export flatten")
+	opts := []regclient.ImageOpts{}
+	if imageOpts.platform != "" {
+		opts = append(opts, regclient.ImageWithPlatform(imageOpts.platform))
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(rc.ImageFlatten(ctx, r, pw, opts...))
+	}()
+	err := archive.Extract(ctx, dir, pr)
+	pr.CloseWithError(err)
+	return err
+}
+
+func runImageGetFile(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	filename := imageFileName(args[1])
 	rc := newRegClient()
 	defer rc.Close(ctx, r)
+
 	log.WithFields(logrus.Fields{
-		"ref": r.CommonName(),
-	}).Debug("Image export")
-	return rc.ImageExport(ctx, r, w)
+		"ref":      r.CommonName(),
+		"filename": filename,
+		"platform": imageOpts.platform,
+	}).Debug("Image get file")
+	layers, err := imageLayers(ctx, rc, r, imageOpts.platform)
+	if err != nil {
+		return err
+	}
+	files, err := imageFiles(ctx, rc, r, layers, -1)
+	if err != nil {
+		return err
+	}
+	f, err := imageFileResolve(files, filename)
+	if err != nil {
+		return err
+	}
+	return imageGetFile(ctx, rc, r, layers[f.Layer], f, args[2:])
+}
+
+// imageFileResolve finds a file in the merged layers, following symlinks in the filename and parent directories
+func imageFileResolve(files map[string]*imageFile, filename string) (*imageFile, error) {
+	parts := imageFileParts(filename)
+	resolved := "."
+	links := 0
+	for len(parts) > 0 {
+		cur := path.Join(resolved, parts[0])
+		parts = parts[1:]
+		f, ok := files[cur]
+		if !ok {
+			if len(parts) > 0 {
+				// layers are not required to include an entry for each parent directory
+				resolved = cur
+				continue
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, filename)
+		}
+		switch f.Typeflag {
+		case tar.TypeSymlink:
+			links++
+			if links > imageMaxSymlinks {
+				return nil, fmt.Errorf("too many symlinks resolving %s", filename)
+			}
+			target := f.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(resolved, target)
+			}
+			log.WithFields(logrus.Fields{
+				"link":   cur,
+				"target": f.Linkname,
+			}).Debug("Following symlink")
+			// restart from the root with the link target followed by the remaining path
+			parts = append(imageFileParts(imageFileName(target)), parts...)
+			resolved = "."
+		case tar.TypeDir:
+			resolved = cur
+		default:
+			if len(parts) > 0 {
+				return nil, fmt.Errorf("%w: %s, %s is not a directory", ErrNotFound, filename, cur)
+			}
+			resolved = cur
+		}
+	}
+	f, ok := files[resolved]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, filename)
+	}
+	return f, nil
+}
+
+// imageFileParts splits a normalized filename into each path segment
+func imageFileParts(name string) []string {
+	if name == "." {
+		return []string{}
+	}
+	return strings.Split(name, "/")
+}
+
+// imageGetFile outputs the content of a regular file or hardlink from a layer
+func imageGetFile(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor, f *imageFile, out []string) error {
+	filename := f.Name
+	switch f.Typeflag {
+	case tar.TypeReg:
+	case tar.TypeLink:
+		// hardlinks refer to an earlier entry in the same layer
+		filename = imageFileName(f.Linkname)
+	default:
+		return fmt.Errorf("%s is not a regular file", f.Name)
+	}
+	tr, closer, err := imageLayerTar(ctx, rc, r, d)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%w: %s in layer %s", ErrNotFound, filename, d.Digest.String())
+		} else if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", d.Digest.String(), err)
+		}
+		if imageFileName(th.Name) == filename && th.Typeflag == tar.TypeReg {
+			return imageGetFileOut(tr, out)
+		}
+	}
+}
+
+// imageGetFileOut copies the file content to stdout or the output file
+func imageGetFileOut(rdr io.Reader, out []string) error {
+	var w io.Writer = os.Stdout
+	if len(out) > 0 {
+		fh, err := os.Create(out[0])
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		w = fh
+	}
+	_, err := io.Copy(w, rdr)
+	return err
 }
 
 func runImageImport(cmd *cobra.Command, args []string) error {
@@ -489,7 +969,9 @@ func runImageImport(cmd *cobra.Command, args []string) error {
 		"file": args[1],
 	}).Debug("Image import")
 
-	return rc.ImageImport(ctx, r, rs)
+	progressOpts, progressFinish := imageProgressOpts()
+	defer progressFinish()
+	return rc.ImageImport(ctx, r, rs, progressOpts...)
 }
 
 func runImageInspect(cmd *cobra.Command, args []string) error {
@@ -508,12 +990,7 @@ func runImageInspect(cmd *cobra.Command, args []string) error {
 		"platform": imageOpts.platform,
 	}).Debug("Image inspect")
 
-	manifestOpts.platform = imageOpts.platform
-	if !flagChanged(cmd, "list") {
-		manifestOpts.list = false
-	}
-
-	m, err := getManifest(ctx, rc, r)
+	m, err := getPlatformManifest(ctx, rc, r, imageOpts.platform)
 	if err != nil {
 		return err
 	}
@@ -537,6 +1014,46 @@ func runImageInspect(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, imageOpts.format, blobConfig)
 }
 
+func runImageLsFiles(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"layer":    imageOpts.layer,
+		"platform": imageOpts.platform,
+	}).Debug("Image list files")
+	layers, err := imageLayers(ctx, rc, r, imageOpts.platform)
+	if err != nil {
+		return err
+	}
+	if imageOpts.layer >= len(layers) {
+		return fmt.Errorf("layer %d not found, image has %d layers", imageOpts.layer, len(layers))
+	}
+	files, err := imageFiles(ctx, rc, r, layers, imageOpts.layer)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = template.Writer(os.Stdout, imageOpts.fileFormat, files[name])
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
 func runImageMod(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	r, err := ref.New(args[0])
@@ -569,6 +1086,13 @@ func runImageMod(cmd *cobra.Command, args []string) error {
 	}).Debug("Modifying image")
 
 	defer rc.Close(ctx, r)
+	// images added to an index are first copied into the repository
+	for _, rAdd := range imageOpts.modIndexAdd {
+		err = mod.IndexAddCopy(ctx, rc, r, rAdd)
+		if err != nil {
+			return err
+		}
+	}
 	rOut, err := mod.Apply(ctx, rc, r, imageOpts.modOpts...)
 	if err != nil {
 		return err
@@ -609,6 +1133,162 @@ func runImageRateLimit(cmd *cobra.Command, args []string) error {
 	return template.Writer(os.Stdout, imageOpts.format, manifest.GetRateLimit(m))
 }
 
+func runImageSize(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if imageOpts.sizeTop < 0 {
+		return fmt.Errorf("--top must not be negative: %w", ErrInvalidInput)
+	}
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":          r.CommonName(),
+		"platform":     imageOpts.platform,
+		"uncompressed": imageOpts.uncompressed,
+	}).Debug("Image size")
+
+	is, err := imageSizeGet(ctx, rc, r, imageOpts.platform, imageOpts.uncompressed, imageOpts.sizeTop)
+	if err != nil {
+		return err
+	}
+	return template.Writer(os.Stdout, imageOpts.sizeFormat, is)
+}
+
+// imageSizeGet returns the size of each platform and layer in an image.
+// With uncompressed, each layer is pulled to count the uncompressed size and the top largest files.
+func imageSizeGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, p string, uncompressed bool, top int) (imageSize, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return imageSize{}, err
+	}
+	is := imageSize{
+		Ref:       r.CommonName(),
+		Digest:    manifest.GetDigest(m),
+		MediaType: manifest.GetMediaType(m),
+		Platforms: []*imageSizePlatform{},
+	}
+	if !m.IsList() {
+		isp, err := imageSizeManifest(m)
+		if err != nil {
+			return is, err
+		}
+		// the platform of a single image is read from the config
+		blobConfig, err := rc.BlobGetOCIConfig(ctx, r, isp.Config)
+		if err != nil {
+			return is, err
+		}
+		conf := blobConfig.GetConfig()
+		isp.Platform = platform.Platform{OS: conf.OS, Architecture: conf.Architecture, Variant: conf.Variant}.String()
+		is.Platforms = append(is.Platforms, isp)
+	} else {
+		dl, err := m.GetManifestList()
+		if err != nil {
+			return is, err
+		}
+		if p != "" {
+			desc, err := getPlatformDesc(ctx, rc, m, p)
+			if err != nil {
+				return is, fmt.Errorf("failed to lookup platform specific digest: %w", err)
+			}
+			dl = []types.Descriptor{*desc}
+		}
+		for _, d := range dl {
+			mp, err := rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(d))
+			if err != nil {
+				return is, fmt.Errorf("failed to pull platform specific digest: %w", err)
+			}
+			if mp.IsList() {
+				log.WithFields(logrus.Fields{
+					"digest": d.Digest.String(),
+				}).Warn("Skipping nested index")
+				continue
+			}
+			isp, err := imageSizeManifest(mp)
+			if err != nil {
+				return is, err
+			}
+			if d.Platform != nil {
+				isp.Platform = d.Platform.String()
+			}
+			is.Platforms = append(is.Platforms, isp)
+		}
+	}
+
+	// count each blob once for the total, tracking blobs used by more than one platform
+	blobUse := map[digest.Digest]int{}
+	blobSize := map[digest.Digest]int64{}
+	ucLayers := map[digest.Digest]*imageSizeLayer{}
+	for _, isp := range is.Platforms {
+		blobUse[isp.Config.Digest]++
+		blobSize[isp.Config.Digest] = isp.Config.Size
+		for _, l := range isp.Layers {
+			blobUse[l.Digest]++
+			blobSize[l.Digest] = l.Size
+		}
+	}
+	for d, size := range blobSize {
+		is.Size += size
+		if blobUse[d] > 1 {
+			is.Shared += size
+		}
+	}
+	for _, isp := range is.Platforms {
+		for _, l := range isp.Layers {
+			l.Shared = blobUse[l.Digest] > 1
+			if !uncompressed {
+				continue
+			}
+			// shared layers are only pulled once
+			if prev, ok := ucLayers[l.Digest]; ok {
+				l.Uncompressed, l.Files = prev.Uncompressed, prev.Files
+			} else {
+				err = imageSizeLayerRead(ctx, rc, r, l, top)
+				if err != nil {
+					return is, err
+				}
+				ucLayers[l.Digest] = l
+				is.Uncompressed += l.Uncompressed
+			}
+			isp.Uncompressed += l.Uncompressed
+		}
+	}
+	return is, nil
+}
+
+func runImageVerify(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":         r.CommonName(),
+		"repair-from": imageOpts.repairFrom,
+	}).Debug("Image verify")
+	opts := []regclient.ImageOpts{}
+	if imageOpts.repairFrom != "" {
+		rSrc, err := ref.New(imageOpts.repairFrom)
+		if err != nil {
+			return err
+		}
+		defer rc.Close(ctx, rSrc)
+		opts = append(opts, regclient.ImageWithRepairFrom(imageOpts.repairFrom))
+	}
+	err = rc.ImageVerify(ctx, r, opts...)
+	if err != nil {
+		return err
+	}
+	log.Info("image verified")
+	return nil
+}
+
 type modFlagFunc struct {
 	f func(string) error
 	t string
@@ -629,3 +1309,243 @@ func (m *modFlagFunc) Set(val string) error {
 func (m *modFlagFunc) Type() string {
 	return m.t
 }
+
+const (
+	imageSizeFormat = `{{ range .Platforms }}{{ .Platform }} {{ .Digest }}: {{ humanSize .Size }}{{ if .Uncompressed }}, uncompressed {{ humanSize .Uncompressed }}{{ end }}
+{{ range $i, $l := .Layers }}  layer {{ $i }} {{ $l.Digest }}: {{ humanSize $l.Size }}{{ if $l.Uncompressed }}, uncompressed {{ humanSize $l.Uncompressed }}{{ end }}{{ if $l.Shared }} (shared){{ end }}
+{{ range $l.Files }}    {{ printf "%10s" (humanSize .Size) }} {{ .Name }}
+{{ end }}{{ end }}{{ end }}Total: {{ humanSize .Size }}{{ if .Uncompressed }}, uncompressed {{ humanSize .Uncompressed }}{{ end }}{{ if gt (len .Platforms) 1 }}, shared {{ humanSize .Shared }}{{ end }}
+`
+	imageLsFilesFormat  = `{{printf "%s %d/%d %9d %2d %s" .FileInfo.Mode .Uid .Gid .Size .Layer .Name}}{{if .Linkname}} -> {{.Linkname}}{{end}}`
+	imageMaxSymlinks    = 40
+	imageWhiteoutOpaque = ".wh..wh..opq"
+	imageWhiteoutPrefix = ".wh."
+)
+
+// imageFile is an entry in the image filesystem and the layer that provided it
+type imageFile struct {
+	tar.Header
+	Layer  int
+	Digest digest.Digest
+}
+
+// imageSize is the output of the size command
+type imageSize struct {
+	Ref          string
+	Digest       digest.Digest
+	MediaType    string
+	Platforms    []*imageSizePlatform
+	Size         int64 // compressed size of all blobs, counting shared blobs once
+	Shared       int64 // compressed size of blobs used by more than one platform
+	Uncompressed int64 // uncompressed size of all layers, counting shared layers once
+}
+
+// imageSizePlatform is the size of a single platform image
+type imageSizePlatform struct {
+	Platform     string
+	Digest       digest.Digest
+	Config       types.Descriptor
+	Layers       []*imageSizeLayer
+	Size         int64
+	Uncompressed int64
+}
+
+// imageSizeLayer is the size of a layer and the largest files it contains
+type imageSizeLayer struct {
+	Digest       digest.Digest
+	MediaType    string
+	Size         int64
+	Uncompressed int64
+	Shared       bool
+	Files        []imageSizeFile
+}
+
+type imageSizeFile struct {
+	Name string
+	Size int64
+}
+
+// imageSizeManifest returns the compressed sizes from an image manifest
+func imageSizeManifest(m manifest.Manifest) (*imageSizePlatform, error) {
+	cd, err := m.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		return nil, err
+	}
+	isp := &imageSizePlatform{
+		Platform: "unknown",
+		Digest:   manifest.GetDigest(m),
+		Config:   cd,
+		Layers:   []*imageSizeLayer{},
+		Size:     cd.Size,
+	}
+	for _, l := range layers {
+		isp.Layers = append(isp.Layers, &imageSizeLayer{
+			Digest:    l.Digest,
+			MediaType: l.MediaType,
+			Size:      l.Size,
+			Files:     []imageSizeFile{},
+		})
+		isp.Size += l.Size
+	}
+	return isp, nil
+}
+
+// imageSizeLayerRead pulls a layer to count the uncompressed bytes and find the top largest files
+func imageSizeLayerRead(ctx context.Context, rc *regclient.RegClient, r ref.Ref, l *imageSizeLayer, top int) error {
+	blob, err := rc.BlobGet(ctx, r, types.Descriptor{Digest: l.Digest, MediaType: l.MediaType, Size: l.Size})
+	if err != nil {
+		return fmt.Errorf("failed to get layer %s: %w", l.Digest.String(), err)
+	}
+	defer blob.Close()
+	rdr, err := archive.Decompress(blob)
+	if err != nil {
+		return fmt.Errorf("failed to decompress layer %s: %w", l.Digest.String(), err)
+	}
+	cr := &countReader{r: rdr}
+	tr := tar.NewReader(cr)
+	files := []imageSizeFile{}
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// layers that are not a tar are only counted
+			log.WithFields(logrus.Fields{
+				"digest": l.Digest.String(),
+				"err":    err,
+			}).Debug("Failed to read layer as tar")
+			break
+		}
+		if th.Typeflag == tar.TypeReg {
+			files = append(files, imageSizeFile{Name: imageFileName(th.Name), Size: th.Size})
+		}
+	}
+	// include any remaining padding after the tar
+	_, err = io.Copy(io.Discard, cr)
+	if err != nil {
+		return fmt.Errorf("failed to read layer %s: %w", l.Digest.String(), err)
+	}
+	l.Uncompressed = cr.n
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	if len(files) > top {
+		files = files[:top]
+	}
+	l.Files = files
+	return nil
+}
+
+// countReader counts the bytes read
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// imageFileName normalizes a filename from a tar header
+func imageFileName(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// imageLayers returns the layers of an image, resolving the platform from a manifest list
+func imageLayers(ctx context.Context, rc *regclient.RegClient, r ref.Ref, p string) ([]types.Descriptor, error) {
+	m, err := getPlatformManifest(ctx, rc, r, p)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetLayers()
+}
+
+// imageFiles merges the files from each layer, applying whiteouts and opaque directories to lower layers.
+// When layer is not negative, only that layer is read and whiteout entries are included in the result.
+func imageFiles(ctx context.Context, rc *regclient.RegClient, r ref.Ref, layers []types.Descriptor, layer int) (map[string]*imageFile, error) {
+	files := map[string]*imageFile{}
+	for i, d := range layers {
+		if layer >= 0 && i != layer {
+			continue
+		}
+		tr, closer, err := imageLayerTar(ctx, rc, r, d)
+		if err != nil {
+			return nil, err
+		}
+		// whiteouts only apply to lower layers, so changes are merged after reading the layer
+		added := map[string]*imageFile{}
+		whiteouts := []string{}
+		opaques := []string{}
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				closer.Close()
+				return nil, fmt.Errorf("failed to read layer %s: %w", d.Digest.String(), err)
+			}
+			name := imageFileName(th.Name)
+			if name == "." {
+				continue
+			}
+			dir, base := path.Dir(name), path.Base(name)
+			if layer < 0 && base == imageWhiteoutOpaque {
+				opaques = append(opaques, dir)
+				continue
+			} else if layer < 0 && strings.HasPrefix(base, imageWhiteoutPrefix) {
+				whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, imageWhiteoutPrefix)))
+				continue
+			}
+			th.Name = name
+			added[name] = &imageFile{Header: *th, Layer: i, Digest: d.Digest}
+		}
+		closer.Close()
+		for name := range files {
+			for _, wh := range whiteouts {
+				if name == wh || strings.HasPrefix(name, wh+"/") {
+					delete(files, name)
+				}
+			}
+			for _, dir := range opaques {
+				if dir == "." || strings.HasPrefix(name, dir+"/") {
+					delete(files, name)
+				}
+			}
+			// a parent directory replaced by a non-directory removes the lower layer contents
+			for parent := path.Dir(name); parent != "." && parent != "/"; parent = path.Dir(parent) {
+				if f, ok := added[parent]; ok && f.Typeflag != tar.TypeDir {
+					delete(files, name)
+					break
+				}
+			}
+		}
+		for name, f := range added {
+			files[name] = f
+		}
+	}
+	return files, nil
+}
+
+// imageLayerTar returns a tar reader of the uncompressed layer, the closer must be called when finished
+func imageLayerTar(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor) (*tar.Reader, io.Closer, error) {
+	blob, err := rc.BlobGet(ctx, r, d)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get layer %s: %w", d.Digest.String(), err)
+	}
+	rdr, err := archive.Decompress(blob)
+	if err != nil {
+		blob.Close()
+		return nil, nil, fmt.Errorf("failed to decompress layer %s: %w", d.Digest.String(), err)
+	}
+	return tar.NewReader(rdr), blob, nil
+}
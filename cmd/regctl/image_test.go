@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+// testTarEntry is a file in a generated test layer
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+// testImagePush creates an image in r from a list of layers, returning the layer descriptors
+func testImagePush(ctx context.Context, t *testing.T, rc *regclient.RegClient, r ref.Ref, p platform.Platform, layers [][]testTarEntry) []types.Descriptor {
+	t.Helper()
+	descs := []types.Descriptor{}
+	diffIDs := []digest.Digest{}
+	for _, entries := range layers {
+		ucBuf := &bytes.Buffer{}
+		tw := tar.NewWriter(ucBuf)
+		for _, e := range entries {
+			th := &tar.Header{
+				Name:     e.name,
+				Typeflag: e.typeflag,
+				Linkname: e.linkname,
+				Mode:     0644,
+				Size:     int64(len(e.content)),
+			}
+			if e.typeflag == tar.TypeDir {
+				th.Mode = 0755
+			}
+			if err := tw.WriteHeader(th); err != nil {
+				t.Fatalf("failed to write tar header: %v", err)
+			}
+			if e.content != "" {
+				if _, err := tw.Write([]byte(e.content)); err != nil {
+					t.Fatalf("failed to write tar content: %v", err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("failed to close tar: %v", err)
+		}
+		diffIDs = append(diffIDs, digest.FromBytes(ucBuf.Bytes()))
+		gzBuf := &bytes.Buffer{}
+		gw := gzip.NewWriter(gzBuf)
+		if _, err := gw.Write(ucBuf.Bytes()); err != nil {
+			t.Fatalf("failed to compress layer: %v", err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatalf("failed to compress layer: %v", err)
+		}
+		d := types.Descriptor{
+			MediaType: types.MediaTypeOCI1LayerGzip,
+			Digest:    digest.FromBytes(gzBuf.Bytes()),
+			Size:      int64(gzBuf.Len()),
+		}
+		if _, err := rc.BlobPut(ctx, r, d, bytes.NewReader(gzBuf.Bytes())); err != nil {
+			t.Fatalf("failed to push layer: %v", err)
+		}
+		descs = append(descs, d)
+	}
+	conf := v1.Image{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		RootFS: v1.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	}
+	confB, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	confD := types.Descriptor{
+		MediaType: types.MediaTypeOCI1ImageConfig,
+		Digest:    digest.FromBytes(confB),
+		Size:      int64(len(confB)),
+	}
+	if _, err := rc.BlobPut(ctx, r, confD, bytes.NewReader(confB)); err != nil {
+		t.Fatalf("failed to push config: %v", err)
+	}
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    confD,
+		Layers:    descs,
+	}))
+	if err != nil {
+		t.Fatalf("failed to create manifest: %v", err)
+	}
+	if err := rc.ManifestPut(ctx, r, m); err != nil {
+		t.Fatalf("failed to push manifest: %v", err)
+	}
+	return descs
+}
+
+// testIndexPush creates a multi-platform image in r from images previously pushed to each tag
+func testIndexPush(ctx context.Context, t *testing.T, rc *regclient.RegClient, r ref.Ref, tags []string, annotations map[string]string) {
+	t.Helper()
+	descs := []types.Descriptor{}
+	for _, tag := range tags {
+		rTag := r
+		rTag.Tag = tag
+		m, err := rc.ManifestGet(ctx, rTag)
+		if err != nil {
+			t.Fatalf("failed to get manifest %s: %v", tag, err)
+		}
+		mi, err := manifest.OCIManifestFromAny(m.GetOrig())
+		if err != nil {
+			t.Fatalf("failed to parse manifest %s: %v", tag, err)
+		}
+		conf, err := rc.BlobGetOCIConfig(ctx, rTag, mi.Config)
+		if err != nil {
+			t.Fatalf("failed to get config %s: %v", tag, err)
+		}
+		oc := conf.GetConfig()
+		d := m.GetDescriptor()
+		d.Platform = &platform.Platform{OS: oc.OS, Architecture: oc.Architecture, Variant: oc.Variant}
+		descs = append(descs, d)
+	}
+	m, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned:   v1.IndexSchemaVersion,
+		MediaType:   types.MediaTypeOCI1ManifestList,
+		Manifests:   descs,
+		Annotations: annotations,
+	}))
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	if err := rc.ManifestPut(ctx, r, m); err != nil {
+		t.Fatalf("failed to push index: %v", err)
+	}
+}
+
+func TestImageFiles(t *testing.T) {
+	ctx := context.Background()
+	rc := regclient.New(regclient.WithFS(rwfs.MemNew()))
+	r, err := ref.New("ocidir://testrepo:files")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	testImagePush(ctx, t, rc, r, platform.Platform{OS: "linux", Architecture: "amd64"}, [][]testTarEntry{
+		{
+			{name: "usr/", typeflag: tar.TypeDir},
+			{name: "usr/bin/", typeflag: tar.TypeDir},
+			{name: "usr/bin/sh", typeflag: tar.TypeReg, content: "shell"},
+			{name: "bin", typeflag: tar.TypeSymlink, linkname: "usr/bin"},
+			{name: "etc/", typeflag: tar.TypeDir},
+			{name: "etc/os-release", typeflag: tar.TypeReg, content: "v1"},
+			{name: "etc/hl", typeflag: tar.TypeLink, linkname: "etc/os-release"},
+			{name: "etc/keep", typeflag: tar.TypeReg, content: "keep"},
+			{name: "opt/app/a", typeflag: tar.TypeReg, content: "a"},
+			{name: "opt/app/b", typeflag: tar.TypeReg, content: "b"},
+			{name: "var/", typeflag: tar.TypeDir},
+			{name: "var/lib/", typeflag: tar.TypeDir},
+			{name: "var/lib/data", typeflag: tar.TypeReg, content: "data"},
+			{name: "var/log/", typeflag: tar.TypeDir},
+			{name: "var/log/app", typeflag: tar.TypeReg, content: "log"},
+		},
+		{
+			{name: "etc/.wh.os-release", typeflag: tar.TypeReg},
+			{name: "opt/app/.wh..wh..opq", typeflag: tar.TypeReg},
+			{name: "opt/app/c", typeflag: tar.TypeReg, content: "c"},
+			{name: "etc/motd", typeflag: tar.TypeSymlink, linkname: "keep"},
+			{name: "sh-abs", typeflag: tar.TypeSymlink, linkname: "/bin/sh"},
+			{name: "loop1", typeflag: tar.TypeSymlink, linkname: "loop2"},
+			{name: "loop2", typeflag: tar.TypeSymlink, linkname: "loop1"},
+			{name: "var/lib", typeflag: tar.TypeReg, content: "file"},
+			{name: "var/log/", typeflag: tar.TypeDir},
+		},
+	})
+	layers, err := imageLayers(ctx, rc, r, "")
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	if len(layers) != 2 {
+		t.Fatalf("unexpected number of layers: %d", len(layers))
+	}
+
+	t.Run("ls-files", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			layer  int
+			expect []string
+		}{
+			{
+				name:  "merged",
+				layer: -1,
+				expect: []string{
+					"bin", "etc", "etc/hl", "etc/keep", "etc/motd", "loop1", "loop2",
+					"opt/app/c", "sh-abs", "usr", "usr/bin", "usr/bin/sh",
+					"var", "var/lib", "var/log", "var/log/app",
+				},
+			},
+			{
+				name:  "layer 0",
+				layer: 0,
+				expect: []string{
+					"bin", "etc", "etc/hl", "etc/keep", "etc/os-release", "opt/app/a", "opt/app/b", "usr", "usr/bin", "usr/bin/sh",
+					"var", "var/lib", "var/lib/data", "var/log", "var/log/app",
+				},
+			},
+			{
+				name:  "layer 1",
+				layer: 1,
+				expect: []string{
+					"etc/.wh.os-release", "etc/motd", "loop1", "loop2",
+					"opt/app/.wh..wh..opq", "opt/app/c", "sh-abs", "var/lib", "var/log",
+				},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				files, err := imageFiles(ctx, rc, r, layers, tt.layer)
+				if err != nil {
+					t.Fatalf("failed to list files: %v", err)
+				}
+				names := []string{}
+				for name := range files {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				if strings.Join(names, ",") != strings.Join(tt.expect, ",") {
+					t.Errorf("unexpected files, expected %v, received %v", tt.expect, names)
+				}
+				if tt.layer < 0 {
+					if f := files["opt/app/c"]; f == nil || f.Layer != 1 || f.Digest != layers[1].Digest {
+						t.Errorf("unexpected layer for opt/app/c: %v", f)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("get-file", func(t *testing.T) {
+		files, err := imageFiles(ctx, rc, r, layers, -1)
+		if err != nil {
+			t.Fatalf("failed to list files: %v", err)
+		}
+		tests := []struct {
+			name     string
+			filename string
+			expect   string
+			expErr   error
+		}{
+			{name: "regular file", filename: "/usr/bin/sh", expect: "shell"},
+			{name: "symlink parent", filename: "/bin/sh", expect: "shell"},
+			{name: "relative symlink", filename: "/etc/motd", expect: "keep"},
+			{name: "absolute symlink through symlink parent", filename: "sh-abs", expect: "shell"},
+			{name: "hardlink to whiteout file", filename: "/etc/hl", expect: "v1"},
+			{name: "upper layer", filename: "/opt/app/c", expect: "c"},
+			{name: "whiteout", filename: "/etc/os-release", expErr: ErrNotFound},
+			{name: "opaque directory", filename: "/opt/app/a", expErr: ErrNotFound},
+			{name: "missing", filename: "/bin/bash", expErr: ErrNotFound},
+			{name: "file as directory", filename: "/etc/keep/file", expErr: ErrNotFound},
+			{name: "directory replaced by file", filename: "/var/lib/data", expErr: ErrNotFound},
+			{name: "file in directory replaced by directory", filename: "/var/log/app", expect: "log"},
+			{name: "directory", filename: "/usr/bin", expErr: errors.New("usr/bin is not a regular file")},
+			{name: "symlink loop", filename: "/loop1", expErr: errors.New("too many symlinks resolving loop1")},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				out := filepath.Join(t.TempDir(), "out")
+				f, err := imageFileResolve(files, imageFileName(tt.filename))
+				if err == nil {
+					err = imageGetFile(ctx, rc, r, layers[f.Layer], f, []string{out})
+				}
+				if tt.expErr != nil {
+					if err == nil {
+						t.Errorf("did not fail")
+					} else if !errors.Is(err, tt.expErr) && err.Error() != tt.expErr.Error() {
+						t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("failed to get file: %v", err)
+				}
+				b, err := os.ReadFile(out)
+				if err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+				if string(b) != tt.expect {
+					t.Errorf("unexpected content, expected %s, received %s", tt.expect, string(b))
+				}
+			})
+		}
+	})
+}
+
+func TestImageSize(t *testing.T) {
+	ctx := context.Background()
+	rc := regclient.New(regclient.WithFS(rwfs.MemNew()))
+	r, err := ref.New("ocidir://testrepo:multi")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rAmd64, rArm64 := r, r
+	rAmd64.Tag = "amd64"
+	rArm64.Tag = "arm64"
+	// the base layer is shared by both platforms
+	base := []testTarEntry{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/small", typeflag: tar.TypeReg, content: "small"},
+		{name: "etc/large", typeflag: tar.TypeReg, content: strings.Repeat("large", 20)},
+		{name: "etc/medium", typeflag: tar.TypeReg, content: strings.Repeat("medium", 5)},
+	}
+	amd64Layers := testImagePush(ctx, t, rc, rAmd64, platform.Platform{OS: "linux", Architecture: "amd64"}, [][]testTarEntry{
+		base,
+		{{name: "app", typeflag: tar.TypeReg, content: "amd64"}},
+	})
+	arm64Layers := testImagePush(ctx, t, rc, rArm64, platform.Platform{OS: "linux", Architecture: "arm64"}, [][]testTarEntry{
+		base,
+		{{name: "app", typeflag: tar.TypeReg, content: "arm64 app"}},
+	})
+	testIndexPush(ctx, t, rc, r, []string{"amd64", "arm64"}, nil)
+	if amd64Layers[0].Digest != arm64Layers[0].Digest {
+		t.Fatalf("base layer is not shared")
+	}
+	// each tar entry is a 512 byte header, file content is padded to 512 bytes, and the tar ends with 1024 bytes
+	baseUC := int64(512*4 + 512*3 + 1024)
+	appUC := int64(512 + 512 + 1024)
+
+	t.Run("multi-platform", func(t *testing.T) {
+		is, err := imageSizeGet(ctx, rc, r, "", false, 5)
+		if err != nil {
+			t.Fatalf("failed to get size: %v", err)
+		}
+		if len(is.Platforms) != 2 || is.Platforms[0].Platform != "linux/amd64" || is.Platforms[1].Platform != "linux/arm64" {
+			t.Fatalf("unexpected platforms: %v", is.Platforms)
+		}
+		expSize := amd64Layers[0].Size + amd64Layers[1].Size + arm64Layers[1].Size
+		for _, isp := range is.Platforms {
+			expSize += isp.Config.Size
+			if isp.Size != isp.Config.Size+isp.Layers[0].Size+isp.Layers[1].Size {
+				t.Errorf("unexpected platform size for %s: %d", isp.Platform, isp.Size)
+			}
+			if !isp.Layers[0].Shared || isp.Layers[1].Shared {
+				t.Errorf("unexpected shared layers for %s", isp.Platform)
+			}
+			if isp.Uncompressed != 0 || len(isp.Layers[0].Files) != 0 {
+				t.Errorf("uncompressed size computed without the flag")
+			}
+		}
+		if is.Size != expSize {
+			t.Errorf("unexpected total, expected %d, received %d", expSize, is.Size)
+		}
+		if is.Shared != amd64Layers[0].Size {
+			t.Errorf("unexpected shared, expected %d, received %d", amd64Layers[0].Size, is.Shared)
+		}
+	})
+	t.Run("platform", func(t *testing.T) {
+		is, err := imageSizeGet(ctx, rc, r, "linux/arm64", false, 5)
+		if err != nil {
+			t.Fatalf("failed to get size: %v", err)
+		}
+		if len(is.Platforms) != 1 || is.Platforms[0].Platform != "linux/arm64" {
+			t.Fatalf("unexpected platforms: %v", is.Platforms)
+		}
+		if is.Size != is.Platforms[0].Size || is.Shared != 0 {
+			t.Errorf("unexpected total %d or shared %d, platform size %d", is.Size, is.Shared, is.Platforms[0].Size)
+		}
+	})
+	t.Run("uncompressed", func(t *testing.T) {
+		is, err := imageSizeGet(ctx, rc, r, "", true, 2)
+		if err != nil {
+			t.Fatalf("failed to get size: %v", err)
+		}
+		if is.Uncompressed != baseUC+appUC*2 {
+			t.Errorf("unexpected uncompressed total, expected %d, received %d", baseUC+appUC*2, is.Uncompressed)
+		}
+		for _, isp := range is.Platforms {
+			if isp.Uncompressed != baseUC+appUC {
+				t.Errorf("unexpected uncompressed size for %s, expected %d, received %d", isp.Platform, baseUC+appUC, isp.Uncompressed)
+			}
+			if isp.Layers[0].Uncompressed != baseUC || isp.Layers[1].Uncompressed != appUC {
+				t.Errorf("unexpected uncompressed layers for %s: %d, %d", isp.Platform, isp.Layers[0].Uncompressed, isp.Layers[1].Uncompressed)
+			}
+			// the largest files are sorted and limited to the top 2, directories are excluded
+			files := isp.Layers[0].Files
+			if len(files) != 2 || files[0].Name != "etc/large" || files[0].Size != 100 || files[1].Name != "etc/medium" || files[1].Size != 30 {
+				t.Errorf("unexpected largest files for %s: %v", isp.Platform, files)
+			}
+		}
+		is, err = imageSizeGet(ctx, rc, r, "", true, 0)
+		if err != nil {
+			t.Fatalf("failed to get size: %v", err)
+		}
+		if len(is.Platforms[0].Layers[0].Files) != 0 {
+			t.Errorf("files listed with a top of 0: %v", is.Platforms[0].Layers[0].Files)
+		}
+	})
+	t.Run("top negative", func(t *testing.T) {
+		imageOpts.sizeTop = -1
+		defer func() { imageOpts.sizeTop = 5 }()
+		cmd := &cobra.Command{RunE: runImageSize, SilenceErrors: true, SilenceUsage: true}
+		cmd.SetArgs([]string{r.CommonName()})
+		err := cmd.ExecuteContext(ctx)
+		if err == nil || !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("unexpected error, expected %v, received %v", ErrInvalidInput, err)
+		}
+	})
+	t.Run("format defaults", func(t *testing.T) {
+		// commands with different defaults must not share a flag variable
+		if imageOpts.format != "{{printPretty .}}" {
+			t.Errorf("unexpected inspect format default: %s", imageOpts.format)
+		}
+		if imageOpts.sizeFormat != imageSizeFormat {
+			t.Errorf("unexpected size format default: %s", imageOpts.sizeFormat)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index <cmd>",
+	Short: "manage manifest lists and OCI indexes",
+}
+var indexCreateCmd = &cobra.Command{
+	Use:   "create <image_ref> <src_image_ref> [src_image_ref...]",
+	Short: "create an index",
+	Long: `Create an OCI index from a list of images. Each source image is copied into
+the target repository. When a source is an index, all of its platforms are
+added. Later sources replace earlier entries with the same platform.`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runIndexCreate,
+}
+
+func init() {
+	indexCmd.AddCommand(indexCreateCmd)
+	rootCmd.AddCommand(indexCmd)
+}
+
+func runIndexCreate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rSrcs := []ref.Ref{}
+	modOpts := []mod.Opts{}
+	for _, arg := range args[1:] {
+		rSrc, err := ref.New(arg)
+		if err != nil {
+			return err
+		}
+		rSrcs = append(rSrcs, rSrc)
+		modOpts = append(modOpts, mod.WithIndexAdd(rSrc))
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":     r.CommonName(),
+		"sources": args[1:],
+	}).Debug("Index create")
+
+	// copy each source into the target repository
+	for _, rSrc := range rSrcs {
+		err = mod.IndexAddCopy(ctx, rc, r, rSrc)
+		if err != nil {
+			return err
+		}
+	}
+	// start from an empty index in memory, and add each source with mod
+	mEmpty, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{},
+	}))
+	if err != nil {
+		return err
+	}
+	modOpts = append([]mod.Opts{mod.WithManifest(mEmpty)}, modOpts...)
+	rOut, err := mod.Apply(ctx, rc, r, modOpts...)
+	if err != nil {
+		return err
+	}
+	mOut, err := rc.ManifestGet(ctx, rOut)
+	if err != nil {
+		return err
+	}
+	err = rc.ManifestPut(ctx, r, mOut)
+	if err != nil {
+		return fmt.Errorf("failed to push index: %w", err)
+	}
+	fmt.Printf("%s\n", r.CommonName())
+	return nil
+}
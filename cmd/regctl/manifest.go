@@ -118,7 +118,7 @@ func getManifest(ctx context.Context, rc *regclient.RegClient, r ref.Ref) (manif
 
 	// retrieve the specified platform from the manifest list
 	if m.IsList() && !manifestOpts.list && !manifestOpts.requireList {
-		desc, err := getPlatformDesc(ctx, rc, m)
+		desc, err := getPlatformDesc(ctx, rc, m, manifestOpts.platform)
 		if err != nil {
 			return m, fmt.Errorf("failed to lookup platform specific digest: %w", err)
 		}
@@ -130,7 +130,31 @@ func getManifest(ctx context.Context, rc *regclient.RegClient, r ref.Ref) (manif
 	return m, nil
 }
 
-func getPlatformDesc(ctx context.Context, rc *regclient.RegClient, m manifest.Manifest) (*types.Descriptor, error) {
+// getPlatformManifest returns the manifest for a platform, resolving the platform from a manifest list
+func getPlatformManifest(ctx context.Context, rc *regclient.RegClient, r ref.Ref, p string) (manifest.Manifest, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return m, err
+	}
+	if !m.IsList() {
+		if p != "" {
+			log.Info("Manifest list unavailable, ignoring platform flag")
+		}
+		return m, nil
+	}
+	desc, err := getPlatformDesc(ctx, rc, m, p)
+	if err != nil {
+		return m, fmt.Errorf("failed to lookup platform specific digest: %w", err)
+	}
+	m, err = rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(*desc))
+	if err != nil {
+		return m, fmt.Errorf("failed to pull platform specific digest: %w", err)
+	}
+	return m, nil
+}
+
+// getPlatformDesc returns the descriptor for a platform from a manifest list, the local platform is used when p is empty
+func getPlatformDesc(ctx context.Context, rc *regclient.RegClient, m manifest.Manifest, p string) (*types.Descriptor, error) {
 	var desc *types.Descriptor
 	var err error
 	if !m.IsList() {
@@ -144,11 +168,11 @@ func getPlatformDesc(ctx context.Context, rc *regclient.RegClient, m manifest.Ma
 	}
 
 	var plat platform.Platform
-	if manifestOpts.platform != "" && manifestOpts.platform != "local" {
-		plat, err = platform.Parse(manifestOpts.platform)
+	if p != "" && p != "local" {
+		plat, err = platform.Parse(p)
 		if err != nil {
 			log.WithFields(logrus.Fields{
-				"platform": manifestOpts.platform,
+				"platform": p,
 				"err":      err,
 			}).Warn("Could not parse platform")
 		}
@@ -248,7 +272,7 @@ func runManifestDigest(cmd *cobra.Command, args []string) error {
 
 	// retrieve the specified platform from the manifest list
 	for m.IsList() && !manifestOpts.list && !manifestOpts.requireList {
-		desc, err := getPlatformDesc(ctx, rc, m)
+		desc, err := getPlatformDesc(ctx, rc, m, manifestOpts.platform)
 		if err != nil {
 			return fmt.Errorf("failed retrieving platform specific digest: %w", err)
 		}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	gotemplate "text/template"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/pkg/template"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var imagePolicyCmd = &cobra.Command{
+	Use:   "policy <image_ref>",
+	Short: "check an image against a policy",
+	Long: `Evaluates each rule in a policy file against the manifest, config, and
+annotations of an image. Each rule is a go template expression that must output
+"true" for the rule to pass. Every platform of a multi-platform image is
+evaluated unless a platform is specified. The exit code is 4 when any rule fails.`,
+	Example: `
+# policy.yaml
+rules:
+- name: non-root
+  description: image must not run as root
+  expr: and (ne .Config.Config.User "") (not (in .Config.Config.User "root" "0"))
+- name: no-remote-add
+  expr: not (regexMatchAny "ADD https?://" .CreatedBy)
+- name: max-size
+  expr: le .Size 500000000
+- name: platforms
+  expr: subset .Platforms "linux/amd64" "linux/arm64"
+
+regctl image policy registry.example.org/app:v1 --policy policy.yaml`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runImagePolicy,
+}
+
+var policyOpts struct {
+	file     string
+	format   string
+	platform string
+}
+
+// policyConfig is the parsed policy file
+type policyConfig struct {
+	Rules []policyRule `yaml:"rules" json:"rules"`
+}
+
+// policyRule is a named template expression
+type policyRule struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Expr        string `yaml:"expr" json:"expr"`
+}
+
+// policyData is the input to each rule expression
+type policyData struct {
+	Ref         string
+	Digest      string
+	MediaType   string
+	Annotations map[string]string
+	Labels      map[string]string
+	Manifest    interface{}
+	Config      v1.Image
+	CreatedBy   []string
+	Layers      []types.Descriptor
+	Platform    string
+	Platforms   []string
+	Size        int64
+}
+
+// policyResult is the output of the policy command
+type policyResult struct {
+	Ref    string             `json:"ref"`
+	Digest string             `json:"digest"`
+	Pass   bool               `json:"pass"`
+	Rules  []policyRuleResult `json:"rules"`
+}
+
+type policyRuleResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+	Pass        bool   `json:"pass"`
+	Output      string `json:"output"`
+	Error       string `json:"error,omitempty"`
+}
+
+var policyFuncs = gotemplate.FuncMap{
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"in": func(s string, list ...string) bool {
+		for _, l := range list {
+			if s == l {
+				return true
+			}
+		}
+		return false
+	},
+	"regexMatch": func(expr, s string) (bool, error) {
+		return regexp.MatchString(expr, s)
+	},
+	"regexMatchAny": func(expr string, list []string) (bool, error) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range list {
+			if re.MatchString(s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+	"subset": func(list []string, allowed ...string) bool {
+		for _, s := range list {
+			found := false
+			for _, a := range allowed {
+				if s == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+func init() {
+	imagePolicyCmd.Flags().StringVarP(&policyOpts.file, "policy", "", "", "Policy file")
+	imagePolicyCmd.Flags().StringVarP(&policyOpts.format, "format", "", "", "Format output with go template syntax (use \"json\" for json output)")
+	imagePolicyCmd.Flags().StringVarP(&policyOpts.platform, "platform", "p", "", "Specify platform (e.g. linux/amd64 or local)")
+	imagePolicyCmd.RegisterFlagCompletionFunc("policy", completeArgDefault)
+	imagePolicyCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	imagePolicyCmd.RegisterFlagCompletionFunc("platform", completeArgPlatform)
+	imagePolicyCmd.MarkFlagRequired("policy")
+
+	imageCmd.AddCommand(imagePolicyCmd)
+}
+
+func runImagePolicy(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	b, err := os.ReadFile(policyOpts.file)
+	if err != nil {
+		return err
+	}
+	pc := policyConfig{}
+	err = yaml.UnmarshalStrict(b, &pc)
+	if err != nil {
+		return fmt.Errorf("failed to parse policy %s: %w", policyOpts.file, err)
+	}
+	if len(pc.Rules) == 0 {
+		return fmt.Errorf("policy %s has no rules: %w", policyOpts.file, ErrMissingInput)
+	}
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	defer rc.Close(ctx, r)
+
+	log.WithFields(logrus.Fields{
+		"ref":      r.CommonName(),
+		"policy":   policyOpts.file,
+		"platform": policyOpts.platform,
+	}).Debug("Image policy")
+
+	result, err := policyCheck(ctx, rc, r, pc.Rules, policyOpts.platform)
+	if err != nil {
+		return err
+	}
+	format := policyOpts.format
+	switch format {
+	case "":
+		format = "{{ range .Rules }}{{ if .Pass }}PASS{{ else }}FAIL{{ end }}: {{ .Name }}{{ if .Platform }} [{{ .Platform }}]{{ end }}{{ if .Error }} ({{ .Error }}){{ else if and (not .Pass) .Description }} ({{ .Description }}){{ end }}\n{{ end }}"
+	case "json":
+		format = "{{ jsonPretty . }}"
+	}
+	err = template.Writer(os.Stdout, format, result)
+	if err != nil {
+		return err
+	}
+	if !result.Pass {
+		return exitError{code: exitCodePolicyFailed, err: fmt.Errorf("image %s failed policy %s", result.Ref, policyOpts.file)}
+	}
+	return nil
+}
+
+// policyCheck evaluates the rules against an image.
+// Every platform of a multi-platform image is evaluated unless a platform is specified.
+func policyCheck(ctx context.Context, rc *regclient.RegClient, r ref.Ref, rules []policyRule, p string) (policyResult, error) {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return policyResult{}, err
+	}
+	result := policyResult{
+		Ref:    r.CommonName(),
+		Digest: manifest.GetDigest(m).String(),
+		Pass:   true,
+		Rules:  []policyRuleResult{},
+	}
+	data := policyData{
+		Ref:         result.Ref,
+		Digest:      result.Digest,
+		MediaType:   manifest.GetMediaType(m),
+		Annotations: map[string]string{},
+		Platforms:   []string{},
+	}
+	if !m.IsList() {
+		err = policyImage(ctx, rc, r, m, &data)
+		if err != nil {
+			return result, err
+		}
+		data.Platforms = append(data.Platforms, data.Platform)
+		result.Rules = policyEval(rules, data)
+	} else {
+		// annotations on the index are included, and overridden by the image manifest
+		if mi, err := manifest.OCIIndexFromAny(m.GetOrig()); err == nil {
+			for k, v := range mi.Annotations {
+				data.Annotations[k] = v
+			}
+		}
+		pl, err := manifest.GetPlatformList(m)
+		if err != nil {
+			return result, err
+		}
+		for _, p := range pl {
+			// attestations and other artifacts are not platforms
+			if p == nil || p.OS == "unknown" {
+				continue
+			}
+			data.Platforms = append(data.Platforms, p.String())
+		}
+		descs := []types.Descriptor{}
+		if p != "" {
+			desc, err := getPlatformDesc(ctx, rc, m, p)
+			if err != nil {
+				return result, fmt.Errorf("failed to lookup platform specific digest: %w", err)
+			}
+			descs = append(descs, *desc)
+		} else {
+			dl, err := m.GetManifestList()
+			if err != nil {
+				return result, err
+			}
+			for _, d := range dl {
+				// attestations and other artifacts in the index are skipped
+				if d.Platform == nil || d.Platform.OS == "unknown" {
+					continue
+				}
+				descs = append(descs, d)
+			}
+		}
+		for _, desc := range descs {
+			mPlat, err := rc.ManifestGet(ctx, r, regclient.ManifestWithDesc(desc))
+			if err != nil {
+				return result, fmt.Errorf("failed to pull platform specific digest: %w", err)
+			}
+			dataPlat := data
+			dataPlat.Annotations = map[string]string{}
+			for k, v := range data.Annotations {
+				dataPlat.Annotations[k] = v
+			}
+			err = policyImage(ctx, rc, r, mPlat, &dataPlat)
+			if err != nil {
+				return result, err
+			}
+			rules := policyEval(rules, dataPlat)
+			if len(descs) > 1 {
+				for i := range rules {
+					rules[i].Platform = dataPlat.Platform
+				}
+			}
+			result.Rules = append(result.Rules, rules...)
+		}
+	}
+	for _, rr := range result.Rules {
+		if !rr.Pass {
+			result.Pass = false
+		}
+	}
+	return result, nil
+}
+
+// policyImage adds the manifest, config, and platform of a single platform image to the policy data
+func policyImage(ctx context.Context, rc *regclient.RegClient, r ref.Ref, m manifest.Manifest, data *policyData) error {
+	mi, err := manifest.OCIManifestFromAny(m.GetOrig())
+	if err != nil {
+		return err
+	}
+	for k, v := range mi.Annotations {
+		data.Annotations[k] = v
+	}
+	data.Manifest = m.GetOrig()
+	data.Layers = mi.Layers
+	data.Size = mi.Config.Size
+	for _, l := range mi.Layers {
+		data.Size += l.Size
+	}
+	blobConfig, err := rc.BlobGetOCIConfig(ctx, r, mi.Config)
+	if err != nil {
+		return err
+	}
+	data.Config = blobConfig.GetConfig()
+	data.Labels = data.Config.Config.Labels
+	data.CreatedBy = []string{}
+	for _, h := range data.Config.History {
+		data.CreatedBy = append(data.CreatedBy, h.CreatedBy)
+	}
+	data.Platform = fmt.Sprintf("%s/%s", data.Config.OS, data.Config.Architecture)
+	if data.Config.Variant != "" {
+		data.Platform += "/" + data.Config.Variant
+	}
+	return nil
+}
+
+// policyEval runs each rule, a rule passes when the expression outputs "true"
+func policyEval(rules []policyRule, data policyData) []policyRuleResult {
+	results := make([]policyRuleResult, len(rules))
+	for i, rule := range rules {
+		results[i] = policyRuleResult{
+			Name:        rule.Name,
+			Description: rule.Description,
+		}
+		expr := rule.Expr
+		if !strings.Contains(expr, "{{") {
+			expr = "{{ " + expr + " }}"
+		}
+		out, err := template.String(expr, data, template.WithFuncs(policyFuncs))
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Output = strings.TrimSpace(out)
+		results[i].Pass = results[i].Output == "true"
+	}
+	return results
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/spf13/cobra"
+)
+
+func TestPolicyEval(t *testing.T) {
+	data := policyData{
+		Ref:         "registry.example.org/app:v1",
+		Annotations: map[string]string{"org.opencontainers.image.base.name": "docker.io/library/alpine:3"},
+		CreatedBy:   []string{"ADD file:1234 in /", "RUN apk add curl"},
+		Platform:    "linux/amd64",
+		Platforms:   []string{"linux/amd64", "linux/arm64"},
+		Size:        1024,
+	}
+	data.Config.Config.User = "app"
+	tests := []struct {
+		name   string
+		expr   string
+		pass   bool
+		output string
+		err    bool
+	}{
+		{name: "in", expr: `in .Config.Config.User "app" "nobody"`, pass: true},
+		{name: "not in", expr: `in .Config.Config.User "root" "0"`, pass: false, output: "false"},
+		{name: "subset", expr: `subset .Platforms "linux/amd64" "linux/arm64" "linux/arm/v7"`, pass: true},
+		{name: "not subset", expr: `subset .Platforms "linux/amd64"`, pass: false},
+		{name: "regexMatch", expr: `regexMatch "^linux/" .Platform`, pass: true},
+		{name: "regexMatchAny", expr: `regexMatchAny "^RUN apk " .CreatedBy`, pass: true},
+		{name: "regexMatchAny no match", expr: `regexMatchAny "ADD https?://" .CreatedBy`, pass: false},
+		{name: "invalid regexp", expr: `regexMatchAny "(" .CreatedBy`, err: true},
+		{name: "hasPrefix", expr: `hasPrefix (index .Annotations "org.opencontainers.image.base.name") "docker.io/library/"`, pass: true},
+		{name: "contains", expr: `contains .Ref "example"`, pass: true},
+		{name: "size", expr: `le .Size 500`, pass: false},
+		{name: "template braces", expr: `{{ if eq .Platform "linux/amd64" }}true{{ end }}`, pass: true},
+		{name: "output not true", expr: `.Platform`, pass: false, output: "linux/amd64"},
+		{name: "invalid template", expr: `{{ .Platform`, err: true},
+	}
+	rules := make([]policyRule, len(tests))
+	for i, tt := range tests {
+		rules[i] = policyRule{Name: tt.name, Expr: tt.expr}
+	}
+	results := policyEval(rules, data)
+	if len(results) != len(tests) {
+		t.Fatalf("unexpected number of results, expected %d, received %d", len(tests), len(results))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := results[i]
+			if rr.Name != tt.name {
+				t.Errorf("unexpected name, expected %s, received %s", tt.name, rr.Name)
+			}
+			if tt.err {
+				if rr.Error == "" || rr.Pass {
+					t.Errorf("expected error, received %v", rr)
+				}
+				return
+			}
+			if rr.Error != "" {
+				t.Errorf("unexpected error: %s", rr.Error)
+			}
+			if rr.Pass != tt.pass {
+				t.Errorf("unexpected result, expected %t, received %t, output %s", tt.pass, rr.Pass, rr.Output)
+			}
+			if tt.output != "" && rr.Output != tt.output {
+				t.Errorf("unexpected output, expected %s, received %s", tt.output, rr.Output)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	ctx := context.Background()
+	rc := regclient.New(regclient.WithFS(rwfs.MemNew()))
+	r, err := ref.New("ocidir://testrepo:multi")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rAmd64, rArm64 := r, r
+	rAmd64.Tag = "amd64"
+	rArm64.Tag = "arm64"
+	testImagePush(ctx, t, rc, rAmd64, platform.Platform{OS: "linux", Architecture: "amd64"}, [][]testTarEntry{
+		{{name: "app", typeflag: tar.TypeReg, content: "amd64"}},
+	})
+	testImagePush(ctx, t, rc, rArm64, platform.Platform{OS: "linux", Architecture: "arm64"}, [][]testTarEntry{
+		{{name: "app", typeflag: tar.TypeReg, content: "arm64"}},
+	})
+	testIndexPush(ctx, t, rc, r, []string{"amd64", "arm64"}, map[string]string{"org.example.source": "index"})
+	// an index with an attestation entry, pushed with an unknown/unknown platform
+	rAttest, rAttestImg := r, r
+	rAttest.Tag = "attest"
+	rAttestImg.Tag = "attestation"
+	testImagePush(ctx, t, rc, rAttestImg, platform.Platform{OS: "unknown", Architecture: "unknown"}, [][]testTarEntry{
+		{{name: "attestation.json", typeflag: tar.TypeReg, content: "{}"}},
+	})
+	testIndexPush(ctx, t, rc, rAttest, []string{"amd64", "arm64", "attestation"}, map[string]string{"org.example.source": "index"})
+	rules := []policyRule{
+		{Name: "amd64", Expr: `eq .Platform "linux/amd64"`},
+		{Name: "platforms", Expr: `subset .Platforms "linux/amd64" "linux/arm64"`},
+		{Name: "annotation", Expr: `eq (index .Annotations "org.example.source") "index"`},
+	}
+
+	tests := []struct {
+		name     string
+		r        ref.Ref
+		rules    []policyRule
+		platform string
+		expPass  bool
+		expRules []policyRuleResult
+	}{
+		{
+			name:    "single platform",
+			r:       rAmd64,
+			rules:   rules[:2],
+			expPass: true,
+			expRules: []policyRuleResult{
+				{Name: "amd64", Pass: true, Output: "true"},
+				{Name: "platforms", Pass: true, Output: "true"},
+			},
+		},
+		{
+			name:    "all platforms",
+			r:       r,
+			rules:   rules,
+			expPass: false,
+			expRules: []policyRuleResult{
+				{Name: "amd64", Platform: "linux/amd64", Pass: true, Output: "true"},
+				{Name: "platforms", Platform: "linux/amd64", Pass: true, Output: "true"},
+				{Name: "annotation", Platform: "linux/amd64", Pass: true, Output: "true"},
+				{Name: "amd64", Platform: "linux/arm64", Pass: false, Output: "false"},
+				{Name: "platforms", Platform: "linux/arm64", Pass: true, Output: "true"},
+				{Name: "annotation", Platform: "linux/arm64", Pass: true, Output: "true"},
+			},
+		},
+		{
+			name:    "attestation",
+			r:       rAttest,
+			rules:   rules[1:],
+			expPass: true,
+			expRules: []policyRuleResult{
+				{Name: "platforms", Platform: "linux/amd64", Pass: true, Output: "true"},
+				{Name: "annotation", Platform: "linux/amd64", Pass: true, Output: "true"},
+				{Name: "platforms", Platform: "linux/arm64", Pass: true, Output: "true"},
+				{Name: "annotation", Platform: "linux/arm64", Pass: true, Output: "true"},
+			},
+		},
+		{
+			name:     "selected platform",
+			r:        r,
+			rules:    rules,
+			platform: "linux/amd64",
+			expPass:  true,
+			expRules: []policyRuleResult{
+				{Name: "amd64", Pass: true, Output: "true"},
+				{Name: "platforms", Pass: true, Output: "true"},
+				{Name: "annotation", Pass: true, Output: "true"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := policyCheck(ctx, rc, tt.r, tt.rules, tt.platform)
+			if err != nil {
+				t.Fatalf("failed to check policy: %v", err)
+			}
+			if result.Pass != tt.expPass {
+				t.Errorf("unexpected pass, expected %t, received %t", tt.expPass, result.Pass)
+			}
+			if len(result.Rules) != len(tt.expRules) {
+				t.Fatalf("unexpected rules, expected %v, received %v", tt.expRules, result.Rules)
+			}
+			for i := range tt.expRules {
+				if result.Rules[i] != tt.expRules[i] {
+					t.Errorf("unexpected rule %d, expected %v, received %v", i, tt.expRules[i], result.Rules[i])
+				}
+			}
+		})
+	}
+	t.Run("missing platform", func(t *testing.T) {
+		_, err := policyCheck(ctx, rc, r, rules, "linux/s390x")
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			t.Errorf("unexpected error, expected %v, received %v", ErrNotFound, err)
+		}
+	})
+}
+
+func TestImagePolicyExit(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	r, err := ref.New("ocidir://" + filepath.Join(dir, "repo") + ":v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rc := regclient.New()
+	testImagePush(ctx, t, rc, r, platform.Platform{OS: "linux", Architecture: "amd64"}, [][]testTarEntry{
+		{{name: "app", typeflag: tar.TypeReg, content: "app"}},
+	})
+	tests := []struct {
+		name    string
+		policy  string
+		expCode int
+		expErr  error
+	}{
+		{
+			name:   "pass",
+			policy: "rules:\n- name: os\n  expr: eq .Config.OS \"linux\"\n",
+		},
+		{
+			name:    "fail",
+			policy:  "rules:\n- name: arch\n  expr: eq .Config.Architecture \"arm64\"\n",
+			expCode: exitCodePolicyFailed,
+		},
+		{
+			name:   "no rules",
+			policy: "rules: []\n",
+			expErr: ErrMissingInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyFile := filepath.Join(dir, "policy.yaml")
+			if err := os.WriteFile(policyFile, []byte(tt.policy), 0644); err != nil {
+				t.Fatalf("failed to write policy: %v", err)
+			}
+			policyOpts.file = policyFile
+			policyOpts.format = "{{ .Pass }}"
+			defer func() {
+				policyOpts.file = ""
+				policyOpts.format = ""
+			}()
+			cmd := &cobra.Command{RunE: runImagePolicy, SilenceErrors: true, SilenceUsage: true}
+			cmd.SetArgs([]string{r.CommonName()})
+			err := cmd.ExecuteContext(ctx)
+			var ee exitError
+			switch {
+			case tt.expErr != nil:
+				if err == nil || !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+			case tt.expCode != 0:
+				if !errors.As(err, &ee) || ee.code != tt.expCode {
+					t.Errorf("unexpected exit code, expected %d, received %v", tt.expCode, err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
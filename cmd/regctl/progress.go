@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/types"
+	"golang.org/x/term"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// imageProgress renders a single line progress bar for image transfers
+type imageProgress struct {
+	mu        sync.Mutex
+	w         io.Writer
+	last      time.Time
+	lineLen   int
+	blobs     int
+	done      int
+	skipped   int
+	manifests int
+	cur       int64
+	total     int64
+}
+
+// imageProgressOpts returns the progress option and a finish function when stdout is a terminal
+func imageProgressOpts() ([]regclient.ImageOpts, func()) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return []regclient.ImageOpts{}, func() {}
+	}
+	ip := &imageProgress{w: os.Stdout}
+	return []regclient.ImageOpts{regclient.ImageWithProgress(ip.callback)}, ip.finish
+}
+
+func (ip *imageProgress) callback(p types.Progress) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	switch p.Kind {
+	case types.ProgressManifest:
+		if p.State == types.ProgressFinished {
+			ip.manifests++
+		}
+	case types.ProgressBlob:
+		switch p.State {
+		case types.ProgressStarted:
+			ip.blobs++
+		case types.ProgressSkipped:
+			ip.blobs++
+			ip.skipped++
+		case types.ProgressFinished:
+			ip.done++
+		}
+	}
+	ip.cur, ip.total = p.Overall, p.OverallSize
+	if p.State == types.ProgressActive && time.Since(ip.last) < progressInterval {
+		return
+	}
+	ip.render()
+}
+
+// finish renders the final state and ends the line
+func (ip *imageProgress) finish() {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	if ip.last.IsZero() {
+		return
+	}
+	ip.render()
+	fmt.Fprintln(ip.w)
+}
+
+func (ip *imageProgress) render() {
+	ip.last = time.Now()
+	filled := 0
+	if ip.total > 0 {
+		filled = int(ip.cur * progressWidth / ip.total)
+	}
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+	line := fmt.Sprintf("[%s] %s / %s, blobs %d/%d (%d skipped), manifests %d",
+		bar, units.HumanSize(float64(ip.cur)), units.HumanSize(float64(ip.total)),
+		ip.done+ip.skipped, ip.blobs, ip.skipped, ip.manifests)
+	pad := ""
+	if len(line) < ip.lineLen {
+		pad = strings.Repeat(" ", ip.lineLen-len(line))
+	}
+	ip.lineLen = len(line)
+	fmt.Fprintf(ip.w, "\r%s%s", line, pad)
+}
@@ -28,6 +28,19 @@ in the output.`,
 	ValidArgsFunction: registryArgListReg,
 	RunE:              runRegistryConfig,
 }
+var registryCopyCmd = &cobra.Command{
+	Use:     "copy <src_registry> <dst_registry>",
+	Aliases: []string{"cp"},
+	Short:   "copy every repository in a registry",
+	Long: `Copy every tag of every repository from the source registry to the target
+registry. The source registry must support listing repositories, which is not
+available on Docker Hub. Tags are filtered with --include and --exclude regular
+expressions, which are bound to the beginning and ending of each tag.
+A summary of the copied, unchanged, and failed images is output when finished.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: registryArgListReg,
+	RunE:              runRegistryCopy,
+}
 var registryLoginCmd = &cobra.Command{
 	Use:   "login <registry>",
 	Short: "login to a registry",
@@ -68,6 +81,8 @@ var registryOpts struct {
 }
 
 func init() {
+	repoCopyFlags(registryCopyCmd)
+
 	registryLoginCmd.Flags().StringVarP(&registryOpts.user, "user", "u", "", "Username")
 	registryLoginCmd.Flags().StringVarP(&registryOpts.pass, "pass", "p", "", "Password")
 	registryLoginCmd.RegisterFlagCompletionFunc("user", completeArgNone)
@@ -105,6 +120,7 @@ func init() {
 	registrySetCmd.Flags().MarkHidden("dns")
 
 	registryCmd.AddCommand(registryConfigCmd)
+	registryCmd.AddCommand(registryCopyCmd)
 	registryCmd.AddCommand(registryLoginCmd)
 	registryCmd.AddCommand(registryLogoutCmd)
 	registryCmd.AddCommand(registrySetCmd)
@@ -159,6 +175,29 @@ func runRegistryConfig(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runRegistryCopy(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	for _, host := range args {
+		if strings.ContainsRune(host, '/') {
+			log.WithFields(logrus.Fields{
+				"host": host,
+			}).Error("Hostname invalid")
+			return ErrInvalidInput
+		}
+	}
+	rc := newRegClient()
+	log.WithFields(logrus.Fields{
+		"source":   args[0],
+		"target":   args[1],
+		"include":  repoOpts.include,
+		"exclude":  repoOpts.exclude,
+		"parallel": repoOpts.parallel,
+	}).Debug("Registry copy")
+	rcs := repoCopySummary{rc: rc}
+	err := repoCopyWalker(rc).Registry(ctx, args[0], args[1], rcs.copy)
+	return rcs.output(err)
+}
+
 func runRegistryLogin(cmd *cobra.Command, args []string) error {
 	c, err := ConfigLoadDefault()
 	if err != nil {
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/tagwalk"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -14,11 +20,25 @@ var repoCmd = &cobra.Command{
 	Use:   "repo <cmd>",
 	Short: "manage repositories",
 }
+var repoCopyCmd = &cobra.Command{
+	Use:     "copy <src_repo> <dst_repo>",
+	Aliases: []string{"cp"},
+	Short:   "copy every tag in a repository",
+	Long: `Copy every tag from the source repository to the target repository.
+Tags are filtered with --include and --exclude regular expressions,
+which are bound to the beginning and ending of each tag.
+A summary of the copied, unchanged, and failed images is output when finished.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runRepoCopy,
+}
 var repoLsCmd = &cobra.Command{
 	Use:     "ls <registry>",
 	Aliases: []string{"list"},
 	Short:   "list repositories in a registry",
 	Long: `List repositories in a registry.
+Without --limit or --last, each page is requested by following the registry
+Link header until every repository is listed.
 Note: Docker Hub does not support this API request.`,
 	Args:              cobra.ExactArgs(1),
 	ValidArgsFunction: registryArgListReg,
@@ -29,9 +49,19 @@ var repoOpts struct {
 	last   string
 	limit  int
 	format string
+	// copy options are shared with registry copy
+	copyFormat      string
+	digestTags      bool
+	exclude         []string
+	forceRecursive  bool
+	include         []string
+	includeExternal bool
+	parallel        int
 }
 
 func init() {
+	repoCopyFlags(repoCopyCmd)
+
 	repoLsCmd.Flags().StringVarP(&repoOpts.last, "last", "", "", "Specify the last repo from a previous request for pagination")
 	repoLsCmd.Flags().IntVarP(&repoOpts.limit, "limit", "", 0, "Specify the number of repos to retrieve")
 	repoLsCmd.Flags().StringVarP(&repoOpts.format, "format", "", "{{printPretty .}}", "Format output with go template syntax")
@@ -39,10 +69,129 @@ func init() {
 	repoLsCmd.RegisterFlagCompletionFunc("limit", completeArgNone)
 	repoLsCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	repoCmd.AddCommand(repoCopyCmd)
 	repoCmd.AddCommand(repoLsCmd)
 	rootCmd.AddCommand(repoCmd)
 }
 
+// repoCopyFlags adds the flags used by repo copy and registry copy
+func repoCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&repoOpts.digestTags, "digest-tags", "", false, "Include digest tags (\"sha256-<digest>.*\") with each image instead of as separate tags")
+	cmd.Flags().StringArrayVarP(&repoOpts.exclude, "exclude", "", []string{}, "Regex of tags to exclude")
+	cmd.Flags().BoolVarP(&repoOpts.forceRecursive, "force-recursive", "", false, "Force recursive copy of each image, repairs missing nested blobs and manifests")
+	cmd.Flags().StringVarP(&repoOpts.copyFormat, "format", "", repoCopyFormat, "Format the summary with go template syntax")
+	cmd.Flags().StringArrayVarP(&repoOpts.include, "include", "", []string{}, "Regex of tags to include (default is all tags)")
+	cmd.Flags().BoolVarP(&repoOpts.includeExternal, "include-external", "", false, "Include external layers")
+	cmd.Flags().IntVarP(&repoOpts.parallel, "parallel", "", 1, "Number of images to copy concurrently")
+	cmd.RegisterFlagCompletionFunc("exclude", completeArgNone)
+	cmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	cmd.RegisterFlagCompletionFunc("include", completeArgNone)
+	cmd.RegisterFlagCompletionFunc("parallel", completeArgNone)
+}
+
+func runRepoCopy(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	rSrc, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rTgt, err := ref.New(args[1])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	log.WithFields(logrus.Fields{
+		"source":   rSrc.CommonName(),
+		"target":   rTgt.CommonName(),
+		"include":  repoOpts.include,
+		"exclude":  repoOpts.exclude,
+		"parallel": repoOpts.parallel,
+	}).Debug("Repo copy")
+	rcs := repoCopySummary{rc: rc}
+	err = repoCopyWalker(rc).Repo(ctx, rSrc, rTgt, rcs.copy)
+	return rcs.output(err)
+}
+
+const repoCopyFormat = `{{printf "%d copied, %d unchanged, %d failed\n" .Copied .Unchanged .Failed}}`
+
+// repoCopySummary tracks the results of copying each tag
+type repoCopySummary struct {
+	rc        *regclient.RegClient
+	mu        sync.Mutex
+	Copied    int
+	Unchanged int
+	Failed    int
+}
+
+// repoCopyWalker returns the tag walker configured from the copy flags
+func repoCopyWalker(rc *regclient.RegClient) tagwalk.Walker {
+	filter := tagwalk.Filter{
+		Allow: repoOpts.include,
+		Deny:  repoOpts.exclude,
+	}
+	if repoOpts.digestTags {
+		// digest tags are copied with the image they reference
+		filter.Deny = append(filter.Deny, tagwalk.DigestTagRegex)
+	}
+	return tagwalk.Walker{
+		RC:       rc,
+		Log:      log,
+		Filter:   filter,
+		Parallel: repoOpts.parallel,
+	}
+}
+
+func (rcs *repoCopySummary) copy(ctx context.Context, src, tgt ref.Ref) error {
+	if !repoOpts.forceRecursive {
+		mSrc, errS := rcs.rc.ManifestHead(ctx, src)
+		mTgt, errT := rcs.rc.ManifestHead(ctx, tgt)
+		if errS == nil && errT == nil && mSrc.GetDescriptor().Digest == mTgt.GetDescriptor().Digest {
+			rcs.result(src, tgt, "unchanged", &rcs.Unchanged)
+			return nil
+		}
+	}
+	opts := []regclient.ImageOpts{}
+	if repoOpts.digestTags {
+		opts = append(opts, regclient.ImageWithDigestTags())
+	}
+	if repoOpts.forceRecursive {
+		opts = append(opts, regclient.ImageWithForceRecursive())
+	}
+	if repoOpts.includeExternal {
+		opts = append(opts, regclient.ImageWithIncludeExternal())
+	}
+	err := rcs.rc.ImageCopy(ctx, src, tgt, opts...)
+	if err != nil {
+		rcs.result(src, tgt, "failed", &rcs.Failed)
+		return err
+	}
+	rcs.result(src, tgt, "copied", &rcs.Copied)
+	return nil
+}
+
+func (rcs *repoCopySummary) result(src, tgt ref.Ref, status string, count *int) {
+	rcs.mu.Lock()
+	defer rcs.mu.Unlock()
+	*count++
+	log.WithFields(logrus.Fields{
+		"source":    src.CommonName(),
+		"target":    tgt.CommonName(),
+		"status":    status,
+		"copied":    rcs.Copied,
+		"unchanged": rcs.Unchanged,
+		"failed":    rcs.Failed,
+	}).Info("Image copy")
+}
+
+// output writes the summary and returns an error if any images failed
+func (rcs *repoCopySummary) output(err error) error {
+	errT := template.Writer(os.Stdout, repoOpts.copyFormat, rcs)
+	if err != nil {
+		return fmt.Errorf("copy failed, %d images failed: %w", rcs.Failed, err)
+	}
+	return errT
+}
+
 func runRepoLs(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	host := args[0]
@@ -115,6 +115,7 @@ func newRegClient() *regclient.RegClient {
 
 	rcOpts := []regclient.Opt{
 		regclient.WithLog(log),
+		regclient.WithBlobLocationCache(),
 	}
 	if rootOpts.userAgent != "" {
 		rcOpts = append(rcOpts, regclient.WithUserAgent(rootOpts.userAgent))
@@ -132,6 +133,10 @@ func newRegClient() *regclient.RegClient {
 		rcOpts = append(rcOpts, regclient.WithDockerCerts())
 	}
 
+	if conf.BlobCache != nil && conf.BlobCache.Dir != "" {
+		rcOpts = append(rcOpts, regclient.WithBlobCache(conf.BlobCache.Dir, conf.BlobCache.MaxSize))
+	}
+
 	rcHosts := []config.Host{}
 	for name, host := range conf.Hosts {
 		rcHosts = append(rcHosts, configHostToRCHost(name, *host))
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/regclient/regclient/internal/proxy"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Second
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "run a read-only pull-through registry proxy",
+	Long: `Serve the read side of the registry API, pulling content from an upstream
+registry on a cache miss. Manifests and blobs are stored in an OCI Layout for
+each repository under the store directory. Tags are resolved again with the
+upstream registry after the tag TTL, and cached tags are served when the
+upstream registry is unavailable or rate limited. Push requests are rejected.`,
+	Example: `
+# proxy Docker Hub on port 5000
+regctl serve --store /var/lib/regproxy --upstream docker.io --listen :5000`,
+	Args: cobra.ExactArgs(0),
+	RunE: runServe,
+}
+
+var serveOpts struct {
+	listen   string
+	store    string
+	tagTTL   time.Duration
+	upstream string
+}
+
+func init() {
+	serveCmd.Flags().StringVarP(&serveOpts.listen, "listen", "", ":5000", "Address to listen on")
+	serveCmd.Flags().StringVarP(&serveOpts.store, "store", "", "", "Directory to store pulled content")
+	serveCmd.Flags().DurationVarP(&serveOpts.tagTTL, "tag-ttl", "", 5*time.Minute, "Duration before a tag is resolved again with the upstream registry")
+	serveCmd.Flags().StringVarP(&serveOpts.upstream, "upstream", "", "docker.io", "Upstream registry")
+	serveCmd.MarkFlagRequired("store")
+	serveCmd.RegisterFlagCompletionFunc("listen", completeArgNone)
+	serveCmd.RegisterFlagCompletionFunc("tag-ttl", completeArgNone)
+	serveCmd.RegisterFlagCompletionFunc("upstream", completeArgNone)
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if serveOpts.store == "" {
+		return fmt.Errorf("store directory is required: %w", ErrMissingInput)
+	}
+	if err := os.MkdirAll(serveOpts.store, 0755); err != nil {
+		return err
+	}
+	rc := newRegClient()
+	p := &proxy.Proxy{
+		RC:       rc,
+		Log:      log,
+		Upstream: serveOpts.upstream,
+		Store:    serveOpts.store,
+		TagTTL:   serveOpts.tagTTL,
+	}
+	// blobs may be large, so there is no write timeout
+	srv := &http.Server{
+		Addr:              serveOpts.listen,
+		Handler:           p,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- srv.ListenAndServe()
+	}()
+	log.WithFields(logrus.Fields{
+		"listen":   serveOpts.listen,
+		"upstream": serveOpts.upstream,
+		"store":    serveOpts.store,
+	}).Info("Proxy started")
+
+	// wait on interrupt signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errC:
+		return err
+	case <-sig:
+	}
+	log.Info("Interrupt received, stopping")
+	ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
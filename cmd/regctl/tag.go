@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/taghist"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/scheme"
+	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+const (
+	tagHistoryFilename = "tag-history.json"
+	tagHistoryFormat   = `{{ range . }}{{ printf "%s %s %s\n" .Digest (.FirstSeen.Format "2006-01-02T15:04:05Z07:00") (.LastSeen.Format "2006-01-02T15:04:05Z07:00") }}{{ end }}`
+)
+
 var tagCmd = &cobra.Command{
 	Use:   "tag <cmd>",
 	Short: "manage tags",
@@ -24,21 +38,54 @@ same manifest`,
 	ValidArgsFunction: completeArgTag,
 	RunE:              runTagDelete,
 }
+var tagHistoryCmd = &cobra.Command{
+	Use:   "history <image_ref>",
+	Short: "show the digests recorded for a tag",
+	Long: `Shows each digest recorded for a tag in the tag history journal, with the
+first and last time the digest was seen. Use --at to show the digest the tag
+pointed to at a given time. The journal is written by "tag watch" and by
+regsync with the tagHistory setting.`,
+	Example: `
+# show the history of the stable tag
+regctl tag history registry.example.org/app:stable
+
+# show the digest of the stable tag on a given date
+regctl tag history registry.example.org/app:stable --at 2022-05-03T09:00:00Z`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeArgTag,
+	RunE:              runTagHistory,
+}
 var tagLsCmd = &cobra.Command{
 	Use:     "ls <repository>",
 	Aliases: []string{"list"},
 	Short:   "list tags in a repo",
 	Long: `List tags in a repository.
+Without --limit or --last, each page is requested by following the registry
+Link header until every tag is listed.
 Note: most registries ignore the pagination options.`,
 	Args:      cobra.ExactArgs(1),
 	ValidArgs: []string{},
 	RunE:      runTagLs,
 }
+var tagWatchCmd = &cobra.Command{
+	Use:   "watch <repository>",
+	Short: "record the digest of each tag in a repo",
+	Long: `Polls the tags in a repository and records the digest of each tag in the
+tag history journal. Use "tag history" to query the journal.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{},
+	RunE:      runTagWatch,
+}
 
 var tagOpts struct {
-	Limit  int
-	Last   string
-	format string
+	Limit      int
+	Last       string
+	at         string
+	format     string
+	histFormat string
+	interval   time.Duration
+	journal    string
+	once       bool
 }
 
 func init() {
@@ -49,8 +96,23 @@ func init() {
 	tagLsCmd.RegisterFlagCompletionFunc("limit", completeArgNone)
 	tagLsCmd.RegisterFlagCompletionFunc("format", completeArgNone)
 
+	tagHistoryCmd.Flags().StringVarP(&tagOpts.at, "at", "", "", "Show the digest at a time (RFC3339 or YYYY-MM-DD)")
+	tagHistoryCmd.Flags().StringVarP(&tagOpts.histFormat, "format", "", tagHistoryFormat, "Format output with go template syntax")
+	tagHistoryCmd.Flags().StringVarP(&tagOpts.journal, "journal", "", "", "Tag history journal file (default $HOME/"+ConfigDir+"/"+tagHistoryFilename+")")
+	tagHistoryCmd.RegisterFlagCompletionFunc("at", completeArgNone)
+	tagHistoryCmd.RegisterFlagCompletionFunc("format", completeArgNone)
+	tagHistoryCmd.RegisterFlagCompletionFunc("journal", completeArgDefault)
+
+	tagWatchCmd.Flags().DurationVarP(&tagOpts.interval, "interval", "", 5*time.Minute, "Time between each poll of the repository")
+	tagWatchCmd.Flags().StringVarP(&tagOpts.journal, "journal", "", "", "Tag history journal file (default $HOME/"+ConfigDir+"/"+tagHistoryFilename+")")
+	tagWatchCmd.Flags().BoolVarP(&tagOpts.once, "once", "", false, "Poll the repository once and exit")
+	tagWatchCmd.RegisterFlagCompletionFunc("interval", completeArgNone)
+	tagWatchCmd.RegisterFlagCompletionFunc("journal", completeArgDefault)
+
 	tagCmd.AddCommand(tagDeleteCmd)
+	tagCmd.AddCommand(tagHistoryCmd)
 	tagCmd.AddCommand(tagLsCmd)
+	tagCmd.AddCommand(tagWatchCmd)
 	rootCmd.AddCommand(tagCmd)
 }
 
@@ -107,3 +169,119 @@ func runTagLs(cmd *cobra.Command, args []string) error {
 	}
 	return template.Writer(os.Stdout, tagOpts.format, tl)
 }
+
+func runTagHistory(cmd *cobra.Command, args []string) error {
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	if r.Tag == "" {
+		return fmt.Errorf("tag is required: %w", ErrMissingInput)
+	}
+	log.WithFields(logrus.Fields{
+		"ref":     r.CommonName(),
+		"journal": tagJournalFilename(),
+		"at":      tagOpts.at,
+	}).Debug("Tag history")
+	j := taghist.New(tagJournalFilename())
+	records, err := j.History(taghist.RepoName(r), r.Tag)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no history for %s: %w", r.CommonName(), ErrNotFound)
+	}
+	if tagOpts.at != "" {
+		at, err := time.Parse(time.RFC3339, tagOpts.at)
+		if err != nil {
+			at, err = time.ParseInLocation("2006-01-02", tagOpts.at, time.Local)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse time %s: %w", tagOpts.at, ErrInvalidInput)
+		}
+		rec, ok := taghist.At(records, at)
+		if !ok {
+			return fmt.Errorf("no history for %s at %s: %w", r.CommonName(), tagOpts.at, ErrNotFound)
+		}
+		records = []taghist.Record{rec}
+	}
+	return template.Writer(os.Stdout, tagOpts.histFormat, records)
+}
+
+func runTagWatch(cmd *cobra.Command, args []string) error {
+	r, err := ref.New(args[0])
+	if err != nil {
+		return err
+	}
+	rc := newRegClient()
+	j := taghist.New(tagJournalFilename())
+	log.WithFields(logrus.Fields{
+		"repo":     taghist.RepoName(r),
+		"journal":  tagJournalFilename(),
+		"interval": tagOpts.interval,
+	}).Debug("Tag watch")
+
+	ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ticker := time.NewTicker(tagOpts.interval)
+	defer ticker.Stop()
+	for {
+		err = tagWatchPoll(ctx, rc, j, r)
+		if err != nil {
+			if tagOpts.once {
+				return err
+			}
+			log.WithFields(logrus.Fields{
+				"repo":  taghist.RepoName(r),
+				"error": err,
+			}).Warn("Failed to poll tags")
+		}
+		if tagOpts.once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tagWatchPoll records the current digest of each tag and saves the journal
+func tagWatchPoll(ctx context.Context, rc *regclient.RegClient, j *taghist.Journal, r ref.Ref) error {
+	defer rc.Close(ctx, r)
+	tl, err := rc.TagList(ctx, r)
+	if err != nil {
+		return err
+	}
+	tags, err := tl.GetTags()
+	if err != nil {
+		return err
+	}
+	repo := taghist.RepoName(r)
+	for _, tag := range tags {
+		rTag := r
+		rTag.Tag = tag
+		rTag.Digest = ""
+		m, err := rc.ManifestHead(ctx, rTag)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"ref":   rTag.CommonName(),
+				"error": err,
+			}).Warn("Failed to lookup tag")
+			continue
+		}
+		err = j.Observe(repo, tag, manifest.GetDigest(m).String(), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return j.Save()
+}
+
+func tagJournalFilename() string {
+	if tagOpts.journal != "" {
+		return tagOpts.journal
+	}
+	return filepath.Join(getHomeDir(), ConfigDir, tagHistoryFilename)
+}
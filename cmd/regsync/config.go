@@ -2,11 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"time"
 
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/mod"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/types"
 	"gopkg.in/yaml.v2"
@@ -76,6 +78,7 @@ func credsToRCHost(c ConfigCreds) config.Host {
 // ConfigDefaults is uses for general options and defaults for ConfigSync entries
 type ConfigDefaults struct {
 	Backup          string          `yaml:"backup" json:"backup"`
+	BlobLocCache    bool            `yaml:"blobLocationCache" json:"blobLocationCache"`
 	Interval        time.Duration   `yaml:"interval" json:"interval"`
 	Schedule        string          `yaml:"schedule" json:"schedule"`
 	RateLimit       ConfigRateLimit `yaml:"ratelimit" json:"ratelimit"`
@@ -84,8 +87,10 @@ type ConfigDefaults struct {
 	ForceRecursive  *bool           `yaml:"forceRecursive" json:"forceRecursive"`
 	IncludeExternal *bool           `yaml:"includeExternal" json:"includeExternal"`
 	MediaTypes      []string        `yaml:"mediaTypes" json:"mediaTypes"`
+	Mod             *mod.Recipe     `yaml:"mod" json:"mod"`
 	SkipDockerConf  bool            `yaml:"skipDockerConfig" json:"skipDockerConfig"`
 	Hooks           ConfigHooks     `yaml:"hooks" json:"hooks"`
+	TagHistory      string          `yaml:"tagHistory" json:"tagHistory"`
 	UserAgent       string          `yaml:"userAgent" json:"userAgent"`
 }
 
@@ -111,6 +116,7 @@ type ConfigSync struct {
 	Schedule        string          `yaml:"schedule" json:"schedule"`
 	RateLimit       ConfigRateLimit `yaml:"ratelimit" json:"ratelimit"`
 	MediaTypes      []string        `yaml:"mediaTypes" json:"mediaTypes"`
+	Mod             *mod.Recipe     `yaml:"mod" json:"mod"`
 	Hooks           ConfigHooks     `yaml:"hooks" json:"hooks"`
 }
 
@@ -164,6 +170,15 @@ func ConfigLoadReader(r io.Reader) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// validate mod recipes before any sync is run
+	for i := range c.Sync {
+		if c.Sync[i].Mod == nil {
+			continue
+		}
+		if _, err := c.Sync[i].Mod.Opts(); err != nil {
+			return nil, fmt.Errorf("invalid mod for sync %s: %w", c.Sync[i].Source, err)
+		}
+	}
 	return c, nil
 }
 
@@ -267,6 +282,9 @@ func syncSetDefaults(s *ConfigSync, d ConfigDefaults) {
 		b := (d.IncludeExternal != nil && *d.IncludeExternal)
 		s.IncludeExternal = &b
 	}
+	if s.Mod == nil && d.Mod != nil {
+		s.Mod = d.Mod
+	}
 	if s.Hooks.Pre == nil && d.Hooks.Pre != nil {
 		s.Hooks.Pre = d.Hooks.Pre
 	}
@@ -10,6 +10,10 @@ import (
 
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/internal/taghist"
+	"github.com/regclient/regclient/mod"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
 	"golang.org/x/sync/semaphore"
 )
@@ -214,6 +218,46 @@ func TestRegsync(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name: "ImageMod",
+			sync: ConfigSync{
+				Source: "ocidir://testrepo:v1",
+				Target: "ocidir://test6:v1",
+				Type:   "image",
+				Mod: &mod.Recipe{
+					Steps: []mod.RecipeStep{
+						{Annotation: &mod.RecipeKV{Name: "org.example.test", Value: "mod"}},
+					},
+				},
+			},
+			exists: []string{"ocidir://test6:v1"},
+			desired: []string{
+				"test6/index.json",
+				"test6/oci-layout",
+				"test6/blobs/sha256/aa962da1b4176a25590e0daad1117723ad155486bffea9f3f1360d312b9aa832", // amd64
+			},
+			expErr: nil,
+		},
+		{
+			name: "ImageModDocker",
+			sync: ConfigSync{
+				Source:   "ocidir://testrepo:v1",
+				Target:   "ocidir://test10:v1",
+				Type:     "image",
+				Platform: "linux/amd64",
+				Mod: &mod.Recipe{
+					Steps: []mod.RecipeStep{
+						{ToDocker: true},
+					},
+				},
+			},
+			exists: []string{"ocidir://test10:v1"},
+			desired: []string{
+				"test10/index.json",
+				"test10/oci-layout",
+			},
+			expErr: nil,
+		},
 		{
 			name: "MissingImage",
 			sync: ConfigSync{
@@ -329,6 +373,115 @@ func TestRegsync(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("ImageModSourceDigest", func(t *testing.T) {
+		r, err := ref.New("ocidir://test6:v1")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		s := ConfigSync{Mod: &mod.Recipe{}}
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		srcDigest := "sha256:94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694"
+		if m.GetDescriptor().Digest.String() == srcDigest {
+			t.Errorf("target was not modified")
+		}
+		if d := s.syncedDigest(m); d != srcDigest {
+			t.Errorf("source digest annotation mismatch, expected %s, received %s", srcDigest, d)
+		}
+	})
+
+	t.Run("ImageModDockerNoAnnotation", func(t *testing.T) {
+		r, err := ref.New("ocidir://test10:v1")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		if mt := m.GetDescriptor().MediaType; mt != types.MediaTypeDocker2Manifest {
+			t.Errorf("unexpected media type: %s", mt)
+		}
+		body, err := m.RawBody()
+		if err != nil {
+			t.Fatalf("failed to get body: %v", err)
+		}
+		if bytes.Contains(body, []byte("annotations")) {
+			t.Errorf("annotations added to Docker manifest: %s", string(body))
+		}
+	})
+
+	t.Run("TagHistory", func(t *testing.T) {
+		hist = taghist.New("")
+		defer func() { hist = nil }()
+		srcDigest := "sha256:94ec59b4c55eb2341b63ea9a0abab63590a923e7cb5cd682217ca209ef362694"
+		tests := []struct {
+			name string
+			s    ConfigSync
+		}{
+			{
+				name: "copy",
+				s: ConfigSync{
+					Source: "ocidir://testrepo:v1",
+					Target: "ocidir://test9:v1",
+					Type:   "image",
+				},
+			},
+			{
+				name: "mod",
+				s: ConfigSync{
+					Source: "ocidir://testrepo:v1",
+					Target: "ocidir://test9:mod",
+					Type:   "image",
+					Mod: &mod.Recipe{
+						Steps: []mod.RecipeStep{
+							{Annotation: &mod.RecipeKV{Name: "org.example.test", Value: "history"}},
+						},
+					},
+				},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s := tt.s
+				syncSetDefaults(&s, conf.Defaults)
+				// the target is recorded after the first sync updates it
+				if err := s.process(ctx, "once"); err != nil {
+					t.Fatalf("failed to process: %v", err)
+				}
+				rSrc, err := ref.New(s.Source)
+				if err != nil {
+					t.Fatalf("failed to parse ref: %v", err)
+				}
+				records, err := hist.History(taghist.RepoName(rSrc), rSrc.Tag)
+				if err != nil {
+					t.Fatalf("failed to get history: %v", err)
+				}
+				if len(records) != 1 || records[0].Digest != srcDigest {
+					t.Errorf("unexpected history for %s: %v", s.Source, records)
+				}
+				rTgt, err := ref.New(s.Target)
+				if err != nil {
+					t.Fatalf("failed to parse ref: %v", err)
+				}
+				mTgt, err := rc.ManifestHead(ctx, rTgt)
+				if err != nil {
+					t.Fatalf("failed to get target: %v", err)
+				}
+				tgtDigest := manifest.GetDigest(mTgt).String()
+				records, err = hist.History(taghist.RepoName(rTgt), rTgt.Tag)
+				if err != nil {
+					t.Fatalf("failed to get history: %v", err)
+				}
+				if len(records) != 1 || records[0].Digest != tgtDigest {
+					t.Errorf("unexpected history for %s, expected %s, received %v", s.Target, tgtDigest, records)
+				}
+			})
+		}
+	})
 }
 
 func TestConfigRead(t *testing.T) {
@@ -345,6 +498,7 @@ func TestConfigRead(t *testing.T) {
       parallel: 2
       interval: 60m
       backup: "bkup-{{.Ref.Tag}}"
+      blobLocationCache: true
     x-sync-hub: &sync-hub
       target: registry:5000/hub/{{ .Sync.Source }}
     x-sync-gcr: &sync-gcr
@@ -375,6 +529,9 @@ func TestConfigRead(t *testing.T) {
 		t.Errorf("Filed to load reader: %v", err)
 		return
 	}
+	if !c.Defaults.BlobLocCache {
+		t.Errorf("blobLocationCache not enabled in defaults")
+	}
 	if c.Sync[1].Target != "registry:5000/hub/alpine" {
 		t.Errorf("template sync-hub mismatch, expected: %s, received: %s", "registry:5000/hub/alpine", c.Sync[1].Target)
 	}
@@ -383,3 +540,52 @@ func TestConfigRead(t *testing.T) {
 	}
 	// TODO: test remainder of templates and parsing
 }
+
+func TestConfigReadMod(t *testing.T) {
+	cRead := bytes.NewReader([]byte(`
+    version: 1
+    defaults:
+      mod:
+        steps:
+        - labelToAnnotation: true
+    sync:
+      - source: busybox:latest
+        target: registry:5000/library/busybox:latest
+        type: image
+      - source: alpine:latest
+        target: registry:5000/library/alpine:latest
+        type: image
+        mod:
+          steps:
+          - toOCI: true
+          - annotation:
+              name: org.example.mirror
+              value: "true"
+  `))
+	c, err := ConfigLoadReader(cRead)
+	if err != nil {
+		t.Fatalf("failed to load reader: %v", err)
+	}
+	if c.Sync[0].Mod == nil || len(c.Sync[0].Mod.Steps) != 1 || !c.Sync[0].Mod.Steps[0].LabelToAnnotation {
+		t.Errorf("default mod not applied: %v", c.Sync[0].Mod)
+	}
+	if c.Sync[1].Mod == nil || len(c.Sync[1].Mod.Steps) != 2 || !c.Sync[1].Mod.Steps[0].ToOCI {
+		t.Errorf("sync mod not parsed: %v", c.Sync[1].Mod)
+	}
+
+	cRead = bytes.NewReader([]byte(`
+    version: 1
+    sync:
+      - source: busybox:latest
+        target: registry:5000/library/busybox:latest
+        type: image
+        mod:
+          steps:
+          - toOCI: true
+            toDocker: true
+  `))
+	_, err = ConfigLoadReader(cRead)
+	if err == nil {
+		t.Errorf("invalid mod recipe did not fail")
+	}
+}
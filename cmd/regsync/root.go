@@ -5,11 +5,9 @@ import (
 	"embed"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/fs"
 	"os"
 	"os/signal"
-	"regexp"
 	"strings"
 	"sync"
 	"syscall"
@@ -22,6 +20,9 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/taghist"
+	"github.com/regclient/regclient/internal/tagwalk"
+	"github.com/regclient/regclient/mod"
 	"github.com/regclient/regclient/pkg/template"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/manifest"
@@ -38,6 +39,8 @@ const (
 More details at https://github.com/regclient/regclient`
 	// UserAgent sets the header on http requests
 	UserAgent = "regclient/regsync"
+	// annotationSourceDigest records the unmodified source digest on images changed by a mod recipe
+	annotationSourceDigest = "org.regclient.regsync.source.digest"
 )
 
 var rootOpts struct {
@@ -56,6 +59,7 @@ var (
 	VCSRef = ""
 	VCSTag = ""
 	conf   *Config
+	hist   *taghist.Journal
 	log    *logrus.Logger
 	rc     *regclient.RegClient
 	sem    *semaphore.Weighted
@@ -315,6 +319,9 @@ func loadConf() error {
 	rcOpts := []regclient.Opt{
 		regclient.WithLog(log),
 	}
+	if conf.Defaults.BlobLocCache {
+		rcOpts = append(rcOpts, regclient.WithBlobLocationCache())
+	}
 	if conf.Defaults.UserAgent != "" {
 		rcOpts = append(rcOpts, regclient.WithUserAgent(conf.Defaults.UserAgent))
 	} else if VCSTag != "" {
@@ -340,6 +347,9 @@ func loadConf() error {
 		rcOpts = append(rcOpts, regclient.WithConfigHosts(rcHosts))
 	}
 	rc = regclient.New(rcOpts...)
+	if conf.Defaults.TagHistory != "" {
+		hist = taghist.New(conf.Defaults.TagHistory)
+	}
 	return nil
 }
 
@@ -348,103 +358,9 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 	var retErr error
 	switch s.Type {
 	case "registry":
-		sRepos, err := rc.RepoList(ctx, s.Source)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": s.Source,
-				"error":  err,
-			}).Error("Failed to list source repositories")
-			return err
-		}
-		sRepoList, err := sRepos.GetRepos()
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": s.Source,
-				"error":  err,
-			}).Error("Failed to list source repositories")
-			return err
-		}
-		for _, repo := range sRepoList {
-			sRepoRef, err := ref.New(fmt.Sprintf("%s/%s", s.Source, repo))
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"source": s.Source,
-					"repo":   repo,
-					"error":  err,
-				}).Error("Failed to define source reference")
-				return err
-			}
-			sTags, err := rc.TagList(ctx, sRepoRef)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"source": sRepoRef.CommonName(),
-					"error":  err,
-				}).Error("Failed getting source tags")
-				retErr = err
-				continue
-			}
-			sTagsList, err := sTags.GetTags()
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"source": sRepoRef.CommonName(),
-					"error":  err,
-				}).Error("Failed getting source tags")
-				retErr = err
-				continue
-			}
-			sTagList, err := s.filterTags(sTagsList)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"source": sRepoRef.CommonName(),
-					"allow":  s.Tags.Allow,
-					"deny":   s.Tags.Deny,
-					"error":  err,
-				}).Error("Failed processing tag filters")
-				retErr = err
-				continue
-			}
-			if len(sTagList) == 0 {
-				log.WithFields(logrus.Fields{
-					"source":    sRepoRef.CommonName(),
-					"allow":     s.Tags.Allow,
-					"deny":      s.Tags.Deny,
-					"available": sTagsList,
-				}).Info("No matching tags found")
-				retErr = err
-				continue
-			}
-			tRepoRef, err := ref.New(fmt.Sprintf("%s/%s", s.Target, repo))
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"target": s.Target,
-					"repo":   repo,
-					"error":  err,
-				}).Error("Failed parsing target")
-				return err
-			}
-			for _, tag := range sTagList {
-				sRef := sRepoRef
-				sRef.Tag = tag
-				tRef := tRepoRef
-				tRef.Tag = tag
-				err = s.processRef(ctx, sRef, tRef, action)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"target": tRef.CommonName(),
-						"source": sRef.CommonName(),
-						"error":  err,
-					}).Error("Failed to sync")
-					retErr = err
-				}
-				err = rc.Close(ctx, tRef)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"ref":   tRef.CommonName(),
-						"error": err,
-					}).Error("Error closing ref")
-				}
-			}
-		}
+		retErr = s.walker().Registry(ctx, s.Source, s.Target, func(ctx context.Context, src, tgt ref.Ref) error {
+			return s.processRef(ctx, src, tgt, action)
+		})
 	case "repository":
 		sRepoRef, err := ref.New(s.Source)
 		if err != nil {
@@ -454,41 +370,6 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed parsing source")
 			return err
 		}
-		sTags, err := rc.TagList(ctx, sRepoRef)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": sRepoRef.CommonName(),
-				"error":  err,
-			}).Error("Failed getting source tags")
-			return err
-		}
-		sTagsList, err := sTags.GetTags()
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": sRepoRef.CommonName(),
-				"error":  err,
-			}).Error("Failed getting source tags")
-			return err
-		}
-		sTagList, err := s.filterTags(sTagsList)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"source": sRepoRef.CommonName(),
-				"allow":  s.Tags.Allow,
-				"deny":   s.Tags.Deny,
-				"error":  err,
-			}).Error("Failed processing tag filters")
-			return err
-		}
-		if len(sTagList) == 0 {
-			log.WithFields(logrus.Fields{
-				"source":    sRepoRef.CommonName(),
-				"allow":     s.Tags.Allow,
-				"deny":      s.Tags.Deny,
-				"available": sTagsList,
-			}).Warn("No matching tags found")
-			return nil
-		}
 		tRepoRef, err := ref.New(s.Target)
 		if err != nil {
 			log.WithFields(logrus.Fields{
@@ -497,28 +378,9 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 			}).Error("Failed parsing target")
 			return err
 		}
-		for _, tag := range sTagList {
-			sRef := sRepoRef
-			sRef.Tag = tag
-			tRef := tRepoRef
-			tRef.Tag = tag
-			err = s.processRef(ctx, sRef, tRef, action)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"target": tRef.CommonName(),
-					"source": sRef.CommonName(),
-					"error":  err,
-				}).Error("Failed to sync")
-				retErr = err
-			}
-			err = rc.Close(ctx, tRef)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"ref":   tRef.CommonName(),
-					"error": err,
-				}).Error("Error closing ref")
-			}
-		}
+		retErr = s.walker().Repo(ctx, sRepoRef, tRepoRef, func(ctx context.Context, src, tgt ref.Ref) error {
+			return s.processRef(ctx, src, tgt, action)
+		})
 
 	case "image":
 		sRef, err := ref.New(s.Source)
@@ -561,6 +423,15 @@ func (s ConfigSync) process(ctx context.Context, action string) error {
 		}).Error("Type not recognized, must be one of: registry, repository, or image")
 		return ErrInvalidInput
 	}
+	if hist != nil {
+		err := hist.Save()
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"file":  conf.Defaults.TagHistory,
+				"error": err,
+			}).Error("Failed to save tag history")
+		}
+	}
 	return retErr
 }
 
@@ -577,9 +448,18 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		}).Error("Failed to lookup source manifest")
 		return err
 	}
+	srcDigest := manifest.GetDigest(mSrc).String()
+	observeTag(src, srcDigest)
 	mTgt, err := rc.ManifestHead(ctx, tgt)
+	if err == nil {
+		observeTag(tgt, manifest.GetDigest(mTgt).String())
+	}
+	if err == nil && s.Mod != nil {
+		// modified images record the source digest in an annotation
+		mTgt, err = rc.ManifestGet(ctx, tgt)
+	}
 	tgtMatches := false
-	if err == nil && manifest.GetDigest(mSrc).String() == manifest.GetDigest(mTgt).String() {
+	if err == nil && srcDigest == s.syncedDigest(mTgt) {
 		tgtMatches = true
 	}
 	if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
@@ -616,7 +496,8 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 			return err
 		}
 		src.Digest = platDigest.String()
-		if tgtExists && platDigest.String() == manifest.GetDigest(mTgt).String() {
+		srcDigest = platDigest.String()
+		if tgtExists && srcDigest == s.syncedDigest(mTgt) {
 			tgtMatches = true
 		}
 		if tgtMatches && (s.ForceRecursive == nil || !*s.ForceRecursive) {
@@ -771,6 +652,9 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		"source": src.CommonName(),
 		"target": tgt.CommonName(),
 	}).Debug("Image sync running")
+	if s.Mod != nil {
+		return s.processMod(ctx, src, tgt, srcDigest, opts)
+	}
 	err = rc.ImageCopy(ctx, src, tgt, opts...)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -780,54 +664,148 @@ func (s ConfigSync) processRef(ctx context.Context, src, tgt ref.Ref, action str
 		}).Error("Failed to copy image")
 		return err
 	}
+	observeTarget(ctx, tgt)
 	return nil
 }
 
-func (s ConfigSync) filterTags(in []string) ([]string, error) {
-	var result []string
-	// apply allow list
-	if len(s.Tags.Allow) > 0 {
-		result = make([]string, len(in))
-		for _, filter := range s.Tags.Allow {
-			exp, err := regexp.Compile("^" + filter + "$")
-			if err != nil {
-				return result, err
-			}
-			for i := range in {
-				if result[i] == "" && exp.MatchString(in[i]) {
-					result[i] = in[i]
-				}
-			}
+// observeTarget records the digest of a target after it is updated, the digest may differ from the source when platforms are filtered
+func observeTarget(ctx context.Context, tgt ref.Ref) {
+	if hist == nil || tgt.Tag == "" {
+		return
+	}
+	mTgt, err := rc.ManifestHead(ctx, tgt)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"ref":   tgt.CommonName(),
+			"error": err,
+		}).Warn("Failed to record tag history")
+		return
+	}
+	observeTag(tgt, manifest.GetDigest(mTgt).String())
+}
+
+// observeTag records the digest of a tag when the tag history is enabled
+func observeTag(r ref.Ref, d string) {
+	if hist == nil || r.Tag == "" {
+		return
+	}
+	err := hist.Observe(taghist.RepoName(r), r.Tag, d, time.Now().UTC())
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"ref":   r.CommonName(),
+			"error": err,
+		}).Warn("Failed to record tag history")
+	}
+}
+
+// processMod copies the source by digest, applies the mod recipe, and then tags the modified image
+func (s ConfigSync) processMod(ctx context.Context, src, tgt ref.Ref, srcDigest string, opts []regclient.ImageOpts) error {
+	modOpts, err := s.Mod.Opts()
+	if err != nil {
+		return err
+	}
+	if !s.modToDocker() {
+		// Docker media types do not support annotations, so those targets are modified on every sync
+		modOpts = append(modOpts, mod.WithAnnotation(annotationSourceDigest, srcDigest))
+	}
+	tgtDig := tgt
+	tgtDig.Tag = ""
+	tgtDig.Digest = srcDigest
+	err = rc.ImageCopy(ctx, src, tgtDig, opts...)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"target": tgtDig.CommonName(),
+			"error":  err,
+		}).Error("Failed to copy image")
+		return err
+	}
+	indexAdd, err := s.Mod.IndexAddRefs()
+	if err != nil {
+		return err
+	}
+	for _, rAdd := range indexAdd {
+		err = mod.IndexAddCopy(ctx, rc, tgt, rAdd)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": rAdd.CommonName(),
+				"target": tgt.CommonName(),
+				"error":  err,
+			}).Error("Failed to copy image for index add")
+			return err
 		}
-	} else {
-		// by default, everything is allowed
-		result = in
 	}
+	rMod, err := mod.Apply(ctx, rc, tgtDig, modOpts...)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"target": tgtDig.CommonName(),
+			"error":  err,
+		}).Error("Failed to modify image")
+		return err
+	}
+	err = rc.ImageCopy(ctx, rMod, tgt, opts...)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": rMod.CommonName(),
+			"target": tgt.CommonName(),
+			"error":  err,
+		}).Error("Failed to tag modified image")
+		return err
+	}
+	observeTag(tgt, rMod.Digest)
+	return nil
+}
 
-	// apply deny list
-	if len(s.Tags.Deny) > 0 {
-		for _, filter := range s.Tags.Deny {
-			exp, err := regexp.Compile("^" + filter + "$")
-			if err != nil {
-				return result, err
-			}
-			for i := range result {
-				if result[i] != "" && exp.MatchString(result[i]) {
-					result[i] = ""
-				}
-			}
+// modToDocker indicates the mod recipe converts the image to Docker media types
+func (s ConfigSync) modToDocker() bool {
+	toDocker := false
+	if s.Mod == nil {
+		return toDocker
+	}
+	for _, step := range s.Mod.Steps {
+		if step.ToDocker {
+			toDocker = true
+		} else if step.ToOCI {
+			toDocker = false
 		}
 	}
+	return toDocker
+}
 
-	// compress result list, removing empty elements
-	var compressed = make([]string, 0, len(in))
-	for i := range result {
-		if result[i] != "" {
-			compressed = append(compressed, result[i])
+// syncedDigest returns the source digest that was copied to the target.
+// When a mod recipe is used, this is read from the target annotations.
+func (s ConfigSync) syncedDigest(mTgt manifest.Manifest) string {
+	if s.Mod == nil {
+		return manifest.GetDigest(mTgt).String()
+	}
+	var annotations map[string]string
+	if mTgt.IsList() {
+		ociI, err := manifest.OCIIndexFromAny(mTgt.GetOrig())
+		if err != nil {
+			return ""
 		}
+		annotations = ociI.Annotations
+	} else {
+		ociM, err := manifest.OCIManifestFromAny(mTgt.GetOrig())
+		if err != nil {
+			return ""
+		}
+		annotations = ociM.Annotations
 	}
+	return annotations[annotationSourceDigest]
+}
 
-	return compressed, nil
+// walker lists the filtered tags for registry and repository sync steps
+func (s ConfigSync) walker() tagwalk.Walker {
+	return tagwalk.Walker{
+		RC:  rc,
+		Log: log,
+		Filter: tagwalk.Filter{
+			Allow: s.Tags.Allow,
+			Deny:  s.Tags.Deny,
+		},
+	}
 }
 
 var manifestCache struct {
@@ -2,13 +2,18 @@ package regclient
 
 import (
 	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +22,7 @@ import (
 	_ "crypto/sha512"
 
 	digest "github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/wraperr"
 	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
@@ -35,6 +41,10 @@ const (
 	ociLayoutFilename      = "oci-layout"
 	annotationRefName      = "org.opencontainers.image.ref.name"
 	annotationImageName    = "io.containerd.image.name"
+	annotationBaseName     = "org.opencontainers.image.base.name"
+	annotationBaseDigest   = "org.opencontainers.image.base.digest"
+	whiteoutOpaque         = ".wh..wh..opq"
+	whiteoutPrefix         = ".wh."
 )
 
 // used by import/export to match docker tar expected format
@@ -60,6 +70,7 @@ type tarReadData struct {
 	dockerManifestFound bool
 	dockerManifestList  []dockerTarManifest
 	dockerManifest      schema2.Manifest
+	progress            *progress
 }
 type tarWriteData struct {
 	tw    *tar.Writer
@@ -68,19 +79,41 @@ type tarWriteData struct {
 	// uid, gid  int
 	mode      int64
 	timestamp time.Time
+	progress  *progress
 }
 
 type imageOpt struct {
+	checkBaseDigest string
+	checkBaseRef    string
 	forceRecursive  bool
 	includeExternal bool
 	digestTags      bool
+	platform        string
 	platforms       []string
+	progress        func(types.Progress)
+	repairFrom      string
 	tagList         []string
+	tracker         *progress
 }
 
 // ImageOpts define options for the Image* commands
 type ImageOpts func(*imageOpt)
 
+// ImageWithCheckBaseDigest provides a base digest to compare in ImageCheckBase.
+func ImageWithCheckBaseDigest(d string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.checkBaseDigest = d
+	}
+}
+
+// ImageWithCheckBaseRef provides a base reference to use in ImageCheckBase.
+// This overrides the base image annotations.
+func ImageWithCheckBaseRef(r string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.checkBaseRef = r
+	}
+}
+
 // ImageWithForceRecursive attempts to copy every manifest and blob even if parent manifests already exist.
 func ImageWithForceRecursive() ImageOpts {
 	return func(opts *imageOpt) {
@@ -103,6 +136,13 @@ func ImageWithDigestTags() ImageOpts {
 	}
 }
 
+// ImageWithPlatform selects the platform used to resolve a manifest list, e.g. "linux/amd64" or "local".
+func ImageWithPlatform(p string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.platform = p
+	}
+}
+
 // ImageWithPlatforms only copies specific platforms from a manifest list.
 // This will result in a failure on many registries that validate manifests.
 // Use the empty string to indicate images without a platform definition should be copied.
@@ -112,6 +152,161 @@ func ImageWithPlatforms(p []string) ImageOpts {
 	}
 }
 
+// ImageWithProgress calls cb with the bytes transferred for each blob, blobs that are skipped
+// because they already exist or were mounted, and each manifest pushed.
+// This is supported by ImageCopy, ImageExport, and ImageImport.
+func ImageWithProgress(cb func(types.Progress)) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.progress = cb
+	}
+}
+
+// ImageWithRepairFrom provides a source image used by ImageVerify to replace missing or corrupt content.
+func ImageWithRepairFrom(r string) ImageOpts {
+	return func(opts *imageOpt) {
+		opts.repairFrom = r
+	}
+}
+
+// ImageCheckBase returns nil when the base image of r has not changed.
+// The base image is read from the "org.opencontainers.image.base.name" and
+// "org.opencontainers.image.base.digest" annotations, or from the ImageWithCheckBase options.
+// When the base digest differs, the layers of the base image must be a prefix of the image layers.
+// types.ErrMismatch is returned when the base image has changed, and
+// types.ErrMissingAnnotation is returned when the base image is unknown.
+func (rc *RegClient) ImageCheckBase(ctx context.Context, r ref.Ref, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	baseName, baseDigest := opt.checkBaseRef, opt.checkBaseDigest
+
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return err
+	}
+	if baseName == "" {
+		baseName, baseDigest = imageBaseAnnotations(m)
+	}
+	var plat platform.Platform
+	if opt.platform != "" && opt.platform != "local" {
+		plat, err = platform.Parse(opt.platform)
+		if err != nil {
+			return fmt.Errorf("failed to parse platform %s: %w", opt.platform, err)
+		}
+	} else if opt.platform == "local" || m.IsList() {
+		plat = platform.Local()
+	}
+	if m.IsList() {
+		d, err := manifest.GetPlatformDesc(m, &plat)
+		if err != nil {
+			return fmt.Errorf("failed to find platform %s in %s: %w", plat.String(), r.CommonName(), err)
+		}
+		r.Digest = d.Digest.String()
+		m, err = rc.ManifestGet(ctx, r)
+		if err != nil {
+			return err
+		}
+		if baseName == "" {
+			baseName, baseDigest = imageBaseAnnotations(m)
+		}
+	} else if opt.platform == "" {
+		// use the platform of the image when selecting a platform from the base
+		cd, err := m.GetConfig()
+		if err != nil {
+			return err
+		}
+		conf, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err != nil {
+			return err
+		}
+		oc := conf.GetConfig()
+		plat = platform.Platform{OS: oc.OS, Architecture: oc.Architecture, Variant: oc.Variant}
+	}
+	if baseName == "" {
+		return fmt.Errorf("%w: %s", types.ErrMissingAnnotation, annotationBaseName)
+	}
+	rBase, err := ref.New(baseName)
+	if err != nil {
+		return wraperr.New(fmt.Errorf("failed to parse base image %s: %w", baseName, err), types.ErrBaseUnavailable)
+	}
+
+	// compare the base digest
+	mBase, err := rc.ManifestGet(ctx, rBase)
+	if err != nil {
+		return wraperr.New(fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err), types.ErrBaseUnavailable)
+	}
+	if baseDigest != "" && mBase.GetDescriptor().Digest.String() == baseDigest {
+		rc.log.WithFields(logrus.Fields{
+			"base":   rBase.CommonName(),
+			"digest": baseDigest,
+		}).Debug("base image digest matches")
+		return nil
+	}
+	if mBase.IsList() {
+		d, err := manifest.GetPlatformDesc(mBase, &plat)
+		if err != nil {
+			return wraperr.New(fmt.Errorf("failed to find platform %s in %s: %w", plat.String(), rBase.CommonName(), err), types.ErrBaseUnavailable)
+		}
+		if baseDigest != "" && d.Digest.String() == baseDigest {
+			rc.log.WithFields(logrus.Fields{
+				"base":     rBase.CommonName(),
+				"digest":   baseDigest,
+				"platform": plat.String(),
+			}).Debug("base image digest matches")
+			return nil
+		}
+		rBase.Digest = d.Digest.String()
+		mBase, err = rc.ManifestGet(ctx, rBase)
+		if err != nil {
+			return wraperr.New(fmt.Errorf("failed to get base image %s: %w", rBase.CommonName(), err), types.ErrBaseUnavailable)
+		}
+	}
+
+	// verify the base layers are a prefix of the image layers
+	layers, err := m.GetLayers()
+	if err != nil {
+		return err
+	}
+	baseLayers, err := mBase.GetLayers()
+	if err != nil {
+		return err
+	}
+	if len(baseLayers) > len(layers) {
+		return fmt.Errorf("%w: base image %s has more layers than %s", types.ErrMismatch, rBase.CommonName(), r.CommonName())
+	}
+	for i := range baseLayers {
+		if baseLayers[i].Digest != layers[i].Digest {
+			return fmt.Errorf("%w: base image %s layer %d changed, expected %s, found %s",
+				types.ErrMismatch, rBase.CommonName(), i, baseLayers[i].Digest.String(), layers[i].Digest.String())
+		}
+	}
+	rc.log.WithFields(logrus.Fields{
+		"base":   rBase.CommonName(),
+		"layers": len(baseLayers),
+	}).Debug("base image layers match")
+	return nil
+}
+
+// imageBaseAnnotations returns the base image name and digest from the manifest annotations
+func imageBaseAnnotations(m manifest.Manifest) (string, string) {
+	var annotations map[string]string
+	if m.IsList() {
+		ociI, err := manifest.OCIIndexFromAny(m.GetOrig())
+		if err != nil {
+			return "", ""
+		}
+		annotations = ociI.Annotations
+	} else {
+		ociM, err := manifest.OCIManifestFromAny(m.GetOrig())
+		if err != nil {
+			return "", ""
+		}
+		annotations = ociM.Annotations
+	}
+	return annotations[annotationBaseName], annotations[annotationBaseDigest]
+}
+
 // ImageCopy copies an image
 // This will retag an image in the same repository, only pushing and pulling the top level manifest
 // On the same registry, it will attempt to use cross-repository blob mounts to avoid pulling blobs
@@ -121,6 +316,7 @@ func (rc *RegClient) ImageCopy(ctx context.Context, refSrc ref.Ref, refTgt ref.R
 	for _, optFn := range opts {
 		optFn(&opt)
 	}
+	opt.tracker = newProgress(opt.progress)
 	return rc.imageCopyOpt(ctx, refSrc, refTgt, types.Descriptor{}, false, &opt)
 }
 
@@ -147,6 +343,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			"target": refTgt.Reference,
 			"digest": mdh.GetDescriptor().Digest.String(),
 		}).Info("Copy not needed, target already up to date")
+		opt.tracker.manifest(mdh.GetDescriptor(), true)
 		return nil
 	} else if errD == nil && refTgt.Digest == "" {
 		msh, errS := rc.ManifestHead(ctx, refSrc)
@@ -156,6 +353,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 				"target": refTgt.Reference,
 				"digest": mdh.GetDescriptor().Digest.String(),
 			}).Info("Copy not needed, target already up to date")
+			opt.tracker.manifest(mdh.GetDescriptor(), true)
 			return nil
 		}
 	}
@@ -180,6 +378,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			}).Warn("Failed to push manifest")
 			return err
 		}
+		opt.tracker.manifest(m.GetDescriptor(), false)
 	}
 
 	if !ref.EqualRepository(refSrc, refTgt) {
@@ -224,13 +423,13 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1Layer, types.MediaTypeOCI1LayerGzip,
 					types.MediaTypeBuildkitCacheConfig:
 					// known blob media type
-					err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
+					err = rc.blobCopy(ctx, entrySrc, entryTgt, entry, opt.tracker)
 				default:
 					// unknown media type, first try an image copy
 					err = rc.imageCopyOpt(ctx, entrySrc, entryTgt, entry, true, opt)
 					if err != nil {
 						// fall back to trying to copy a blob
-						err = rc.BlobCopy(ctx, entrySrc, entryTgt, entry)
+						err = rc.blobCopy(ctx, entrySrc, entryTgt, entry, opt.tracker)
 					}
 				}
 				if err != nil {
@@ -256,7 +455,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					"target": refTgt.Reference,
 					"digest": cd.Digest.String(),
 				}).Info("Copy config")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, cd); err != nil {
+				if err := rc.blobCopy(ctx, refSrc, refTgt, cd, opt.tracker); err != nil {
 					rc.log.WithFields(logrus.Fields{
 						"source": refSrc.Reference,
 						"target": refTgt.Reference,
@@ -288,7 +487,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 					"target": refTgt.Reference,
 					"layer":  layerSrc.Digest.String(),
 				}).Info("Copy layer")
-				if err := rc.BlobCopy(ctx, refSrc, refTgt, layerSrc); err != nil {
+				if err := rc.blobCopy(ctx, refSrc, refTgt, layerSrc, opt.tracker); err != nil {
 					rc.log.WithFields(logrus.Fields{
 						"source": refSrc.Reference,
 						"target": refTgt.Reference,
@@ -311,6 +510,7 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 			}).Warn("Failed to push manifest")
 			return err
 		}
+		opt.tracker.manifest(m.GetDescriptor(), false)
 	}
 
 	// lookup digest tags to include artifacts with image
@@ -359,6 +559,144 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 	return nil
 }
 
+// ImageCreatePlatform defines the root filesystem and config for one platform in ImageCreate
+type ImageCreatePlatform struct {
+	// Platform is set in the image config and index descriptor
+	Platform platform.Platform
+	// Rootfs is a directory packaged as the single layer of the image
+	Rootfs string
+	// Config is the base image config, the platform, rootfs, and history are replaced
+	Config v1.Image
+}
+
+// ImageCreate builds an image from one or more root filesystem directories and pushes it to r.
+// Each directory is packaged into a single gzip compressed layer with an OCI config and manifest.
+// When more than one platform is provided, each manifest is pushed by digest and an OCI index is pushed to r.
+func (rc *RegClient) ImageCreate(ctx context.Context, r ref.Ref, plats []ImageCreatePlatform) error {
+	if len(plats) == 0 {
+		return fmt.Errorf("at least one platform is required to create an image")
+	}
+	if len(plats) == 1 {
+		m, err := rc.imageCreatePlatform(ctx, r, plats[0])
+		if err != nil {
+			return err
+		}
+		return rc.ManifestPut(ctx, r, m)
+	}
+	descs := []types.Descriptor{}
+	for _, p := range plats {
+		m, err := rc.imageCreatePlatform(ctx, r, p)
+		if err != nil {
+			return err
+		}
+		d := m.GetDescriptor()
+		rDig := r
+		rDig.Tag = ""
+		rDig.Digest = d.Digest.String()
+		err = rc.ManifestPut(ctx, rDig, m, scheme.WithManifestChild())
+		if err != nil {
+			return err
+		}
+		plat := p.Platform
+		descs = append(descs, types.Descriptor{
+			MediaType: d.MediaType,
+			Digest:    d.Digest,
+			Size:      d.Size,
+			Platform:  &plat,
+		})
+	}
+	mi, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: descs,
+	}))
+	if err != nil {
+		return err
+	}
+	return rc.ManifestPut(ctx, r, mi)
+}
+
+// imageCreatePlatform pushes the layer and config for a single platform and returns the manifest
+func (rc *RegClient) imageCreatePlatform(ctx context.Context, r ref.Ref, p ImageCreatePlatform) (manifest.Manifest, error) {
+	fi, err := os.Stat(p.Rootfs)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("rootfs must be a directory: %s", p.Rootfs)
+	}
+	// the layer is written to a temp file to compute the digests before the push
+	fh, err := os.CreateTemp("", "regclient-layer-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+	diffDigester := digest.Canonical.Digester()
+	layerDigester := digest.Canonical.Digester()
+	gzw := gzip.NewWriter(io.MultiWriter(fh, layerDigester.Hash()))
+	err = archive.Tar(ctx, p.Rootfs, io.MultiWriter(gzw, diffDigester.Hash()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to package rootfs %s: %w", p.Rootfs, err)
+	}
+	err = gzw.Close()
+	if err != nil {
+		return nil, err
+	}
+	size, err := fh.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fh.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	layerDesc := types.Descriptor{
+		MediaType: types.MediaTypeOCI1LayerGzip,
+		Digest:    layerDigester.Digest(),
+		Size:      size,
+	}
+	_, err = rc.BlobPut(ctx, r, layerDesc, fh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push layer: %w", err)
+	}
+
+	conf := p.Config
+	conf.OS = p.Platform.OS
+	conf.Architecture = p.Platform.Architecture
+	conf.Variant = p.Platform.Variant
+	conf.OSVersion = p.Platform.OSVersion
+	conf.OSFeatures = p.Platform.OSFeatures
+	if conf.Created == nil {
+		now := time.Now().UTC()
+		conf.Created = &now
+	}
+	conf.RootFS = v1.RootFS{
+		Type:    "layers",
+		DiffIDs: []digest.Digest{diffDigester.Digest()},
+	}
+	conf.History = []v1.History{{Created: conf.Created, Comment: "rootfs"}}
+	confBytes, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	confDesc := types.Descriptor{
+		MediaType: types.MediaTypeOCI1ImageConfig,
+		Digest:    digest.FromBytes(confBytes),
+		Size:      int64(len(confBytes)),
+	}
+	_, err = rc.BlobPut(ctx, r, confDesc, bytes.NewReader(confBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to push config: %w", err)
+	}
+	return manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    confDesc,
+		Layers:    []types.Descriptor{layerDesc},
+	}))
+}
+
 // ImageExport exports an image to an output stream.
 // The format is compatible with "docker load" if a single image is selected and not a manifest list.
 // The ref must include a tag for exporting to docker (defaults to latest), and may also include a digest.
@@ -371,17 +709,22 @@ func (rc *RegClient) imageCopyOpt(ctx context.Context, refSrc ref.Ref, refTgt re
 // index.json: created at top level, single descriptor with org.opencontainers.image.ref.name annotation pointing to the tag
 // manifest.json: created at top level, based on every layer added, only works for a single arch image
 // blobs/$algo/$hash: each content addressable object (manifest, config, or layer), created recursively
-func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.Writer) error {
+func (rc *RegClient) ImageExport(ctx context.Context, ref ref.Ref, outStream io.Writer, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
 	var ociIndex v1.Index
 
 	// create tar writer object
 	tw := tar.NewWriter(outStream)
 	defer tw.Close()
 	twd := &tarWriteData{
-		tw:    tw,
-		dirs:  map[string]bool{},
-		files: map[string]bool{},
-		mode:  0644,
+		tw:       tw,
+		dirs:     map[string]bool{},
+		files:    map[string]bool{},
+		mode:     0644,
+		progress: newProgress(opt.progress),
 	}
 
 	// retrieve image manifest
@@ -486,6 +829,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		if err != nil {
 			return err
 		}
+		twd.progress.manifest(m.GetDescriptor(), false)
 
 		// add config
 		confD, err := m.GetConfig()
@@ -535,6 +879,7 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		if err != nil {
 			return err
 		}
+		twd.progress.manifest(m.GetDescriptor(), false)
 		// recurse over entries in the list/index
 		mdl, err := m.GetManifestList()
 		if err != nil {
@@ -559,25 +904,254 @@ func (rc *RegClient) imageExportDescriptor(ctx context.Context, ref ref.Ref, des
 		if err != nil {
 			return err
 		}
-		size, err := io.Copy(twd.tw, blobR)
+		pr := twd.progress.reader(desc, blobR)
+		size, err := io.Copy(twd.tw, pr)
 		if err != nil {
 			return fmt.Errorf("failed to export blob %s: %w", desc.Digest.String(), err)
 		}
 		if size != desc.Size {
 			return fmt.Errorf("blob size mismatch, descriptor %d, received %d", desc.Size, size)
 		}
+		pr.finish()
 	}
 
 	return nil
 }
 
+// ImageFlatten writes the merged filesystem of an image to w as a single tar.
+// Layers are applied in order with whiteouts removed, and hardlinks to removed files are replaced with the file content.
+// Each layer is read twice, first to merge the headers and then to output the content.
+// A manifest list is resolved with ImageWithPlatform, defaulting to the local platform.
+func (rc *RegClient) ImageFlatten(ctx context.Context, r ref.Ref, w io.Writer, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return err
+	}
+	if m.IsList() {
+		plat := platform.Local()
+		if opt.platform != "" && opt.platform != "local" {
+			plat, err = platform.Parse(opt.platform)
+			if err != nil {
+				return fmt.Errorf("failed to parse platform %s: %w", opt.platform, err)
+			}
+		}
+		d, err := manifest.GetPlatformDesc(m, &plat)
+		if err != nil {
+			return fmt.Errorf("failed to find platform %s in %s: %w", plat.String(), r.CommonName(), err)
+		}
+		m, err = rc.ManifestGet(ctx, r, ManifestWithDesc(*d))
+		if err != nil {
+			return err
+		}
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		return err
+	}
+
+	// merge the headers from each layer, whiteouts only apply to lower layers
+	files := map[string]flattenEntry{}
+	layerFiles := make([]map[string]bool, len(layers))
+	for i, d := range layers {
+		added := map[string]flattenEntry{}
+		whiteouts := []string{}
+		opaques := []string{}
+		layerFiles[i] = map[string]bool{}
+		entry := 0
+		err = rc.imageLayerTar(ctx, r, d, func(th *tar.Header, tr *tar.Reader) error {
+			entry++
+			name := flattenName(th.Name)
+			if name == "" {
+				return nil
+			}
+			dir, base := path.Dir(name), path.Base(name)
+			if base == whiteoutOpaque {
+				opaques = append(opaques, dir)
+				return nil
+			} else if strings.HasPrefix(base, whiteoutPrefix) {
+				whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+				return nil
+			}
+			if th.Typeflag == tar.TypeReg {
+				layerFiles[i][name] = true
+			}
+			added[name] = flattenEntry{layer: i, entry: entry, th: *th}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for name := range files {
+			for _, wh := range whiteouts {
+				if name == wh || strings.HasPrefix(name, wh+"/") {
+					delete(files, name)
+				}
+			}
+			for _, dir := range opaques {
+				if dir == "." || strings.HasPrefix(name, dir+"/") {
+					delete(files, name)
+				}
+			}
+		}
+		for name, fe := range added {
+			files[name] = fe
+		}
+	}
+
+	// hardlinks to a file that was replaced or removed are promoted to a regular file
+	promote := make([]map[string][]string, len(layers))
+	promoted := map[string]bool{}
+	for i := range promote {
+		promote[i] = map[string][]string{}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fe := files[name]
+		if fe.th.Typeflag != tar.TypeLink {
+			continue
+		}
+		target := flattenName(fe.th.Linkname)
+		if tfe, ok := files[target]; ok && tfe.layer == fe.layer {
+			continue
+		} else if layerFiles[fe.layer][target] {
+			promote[fe.layer][target] = append(promote[fe.layer][target], name)
+			promoted[name] = true
+		} else if !ok {
+			return fmt.Errorf("hardlink %s target %s not found", name, target)
+		}
+	}
+
+	// output directories first, then the remaining entries from each layer
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		fe := files[name]
+		if fe.th.Typeflag != tar.TypeDir {
+			continue
+		}
+		th := fe.th
+		th.Name = name + "/"
+		err = tw.WriteHeader(&th)
+		if err != nil {
+			return err
+		}
+	}
+	for i, d := range layers {
+		entry := 0
+		err = rc.imageLayerTar(ctx, r, d, func(th *tar.Header, tr *tar.Reader) error {
+			entry++
+			name := flattenName(th.Name)
+			if links, ok := promote[i][name]; ok && th.Typeflag == tar.TypeReg {
+				// output the content with the first link name, and remaining links to that file
+				thLink := *th
+				thLink.Name = links[0]
+				err := tw.WriteHeader(&thLink)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(tw, tr)
+				if err != nil {
+					return err
+				}
+				for _, link := range links[1:] {
+					err = tw.WriteHeader(&tar.Header{
+						Name:     link,
+						Typeflag: tar.TypeLink,
+						Linkname: links[0],
+						Mode:     th.Mode,
+						Uid:      th.Uid,
+						Gid:      th.Gid,
+						ModTime:  th.ModTime,
+					})
+					if err != nil {
+						return err
+					}
+				}
+				delete(promote[i], name)
+				return nil
+			}
+			fe, ok := files[name]
+			if name == "" || !ok || fe.layer != i || fe.entry != entry || promoted[name] || th.Typeflag == tar.TypeDir {
+				return nil
+			}
+			thOut := *th
+			thOut.Name = name
+			if thOut.Typeflag == tar.TypeLink {
+				thOut.Linkname = flattenName(thOut.Linkname)
+			}
+			err := tw.WriteHeader(&thOut)
+			if err != nil {
+				return err
+			}
+			if thOut.Typeflag == tar.TypeReg {
+				_, err = io.Copy(tw, tr)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// flattenEntry tracks the layer and position of a file in the merged filesystem
+type flattenEntry struct {
+	layer int
+	entry int
+	th    tar.Header
+}
+
+// flattenName normalizes a filename from a tar header, the root directory is returned as an empty string
+func flattenName(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// imageLayerTar runs fn on each entry of an uncompressed layer
+func (rc *RegClient) imageLayerTar(ctx context.Context, r ref.Ref, d types.Descriptor, fn func(*tar.Header, *tar.Reader) error) error {
+	blob, err := rc.BlobGet(ctx, r, d)
+	if err != nil {
+		return fmt.Errorf("failed to get layer %s: %w", d.Digest.String(), err)
+	}
+	defer blob.Close()
+	rdr, err := archive.Decompress(blob)
+	if err != nil {
+		return fmt.Errorf("failed to decompress layer %s: %w", d.Digest.String(), err)
+	}
+	tr := tar.NewReader(rdr)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", d.Digest.String(), err)
+		}
+		err = fn(th, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
 // ImageImport pushes an image from a tar file to a registry
-func (rc *RegClient) ImageImport(ctx context.Context, ref ref.Ref, rs io.ReadSeeker) error {
+func (rc *RegClient) ImageImport(ctx context.Context, ref ref.Ref, rs io.ReadSeeker, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
 	trd := &tarReadData{
 		handlers:  map[string]tarFileHandler{},
 		processed: map[string]bool{},
 		finish:    []func() error{},
 		manifests: map[digest.Digest]manifest.Manifest{},
+		progress:  newProgress(opt.progress),
 	}
 
 	// add handler for oci-layout, index.json, and manifest.json
@@ -605,6 +1179,7 @@ func (rc *RegClient) ImageImport(ctx context.Context, ref ref.Ref, rs io.ReadSee
 		if err != nil {
 			return err
 		}
+		trd.progress.manifest(m.GetDescriptor(), false)
 	} else if err != nil {
 		// unhandled error from tar read
 		return err
@@ -622,13 +1197,16 @@ func (rc *RegClient) imageImportBlob(ctx context.Context, ref ref.Ref, desc type
 	// skip if blob already exists
 	_, err := rc.BlobHead(ctx, ref, desc)
 	if err == nil {
+		trd.progress.blobSkipped(desc)
 		return nil
 	}
 	// upload blob
-	_, err = rc.BlobPut(ctx, ref, desc, trd.tr)
+	pr := trd.progress.reader(desc, trd.tr)
+	_, err = rc.BlobPut(ctx, ref, desc, pr)
 	if err != nil {
 		return err
 	}
+	pr.finish()
 	return nil
 }
 
@@ -658,10 +1236,13 @@ func (rc *RegClient) imageImportDockerAddLayerHandlers(ctx context.Context, ref
 	// add handler for config
 	trd.handlers[trd.dockerManifestList[0].Config] = func(header *tar.Header, trd *tarReadData) error {
 		// upload blob, digest is unknown
-		d, err := rc.BlobPut(ctx, ref, types.Descriptor{Size: header.Size}, trd.tr)
+		pr := trd.progress.reader(types.Descriptor{Size: header.Size}, trd.tr)
+		d, err := rc.BlobPut(ctx, ref, types.Descriptor{Size: header.Size}, pr)
 		if err != nil {
 			return err
 		}
+		pr.d = d
+		pr.finish()
 		// save the resulting descriptor to the manifest
 		if od, ok := trd.dockerManifestList[0].LayerSources[d.Digest]; ok {
 			trd.dockerManifest.Config = od
@@ -681,10 +1262,12 @@ func (rc *RegClient) imageImportDockerAddLayerHandlers(ctx context.Context, ref
 					return err
 				}
 				// upload blob, digest and size is unknown
-				d, err := rc.BlobPut(ctx, ref, types.Descriptor{}, gzipR)
+				pr := trd.progress.reader(types.Descriptor{}, gzipR)
+				d, err := rc.BlobPut(ctx, ref, types.Descriptor{}, pr)
 				if err != nil {
 					return err
 				}
+				pr.finish()
 				// save the resulting descriptor in the appropriate layer
 				if od, ok := trd.dockerManifestList[0].LayerSources[d.Digest]; ok {
 					trd.dockerManifest.Layers[i] = od
@@ -834,7 +1417,12 @@ func (rc *RegClient) imageImportOCIHandleManifest(ctx context.Context, ref ref.R
 			if !ok {
 				return fmt.Errorf("could not find manifest to tag, ref: %s, digest: %s", ref.CommonName(), d.Digest)
 			}
-			return rc.ManifestPut(ctx, ref, mRef)
+			err := rc.ManifestPut(ctx, ref, mRef)
+			if err != nil {
+				return err
+			}
+			trd.progress.manifest(mRef.GetDescriptor(), false)
+			return nil
 		})
 	} else if m.IsList() {
 		// for index/manifest lists, add handlers for each embedded manifest
@@ -882,13 +1470,19 @@ func (rc *RegClient) imageImportOCIHandleManifest(ctx context.Context, ref ref.R
 			mRef.Digest = string(m.GetDescriptor().Digest)
 			_, err := rc.ManifestHead(ctx, mRef)
 			if err == nil {
+				trd.progress.manifest(m.GetDescriptor(), true)
 				return nil
 			}
 			opts := []scheme.ManifestOpts{}
 			if child {
 				opts = append(opts, scheme.WithManifestChild())
 			}
-			return rc.ManifestPut(ctx, mRef, m, opts...)
+			err = rc.ManifestPut(ctx, mRef, m, opts...)
+			if err != nil {
+				return err
+			}
+			trd.progress.manifest(m.GetDescriptor(), false)
+			return nil
 		})
 	}
 	trd.handleAdded = true
@@ -907,6 +1501,214 @@ func (rc *RegClient) imageImportOCIPushManifests(ctx context.Context, ref ref.Re
 	return nil
 }
 
+// ImageVerify walks every manifest and blob in an image, verifying the digests and sizes against the descriptors.
+// The config diffIDs are compared to the digests of the decompressed layers,
+// and each child manifest of an index must exist.
+// With ImageWithRepairFrom, corrupt blobs are pushed again from the source
+// and missing content is copied with ImageWithForceRecursive before verifying again.
+func (rc *RegClient) ImageVerify(ctx context.Context, r ref.Ref, opts ...ImageOpts) error {
+	var opt imageOpt
+	for _, optFn := range opts {
+		optFn(&opt)
+	}
+	iv := imageVerify{seen: map[digest.Digest]bool{}}
+	rc.imageVerifyManifest(ctx, r, types.Descriptor{}, &iv)
+	if len(iv.errs) == 0 {
+		return nil
+	}
+	for _, err := range iv.errs {
+		rc.log.WithFields(logrus.Fields{
+			"ref": r.CommonName(),
+			"err": err,
+		}).Warn("Verify failed")
+	}
+	if opt.repairFrom == "" {
+		return fmt.Errorf("%d problems found in %s, first problem: %w", len(iv.errs), r.CommonName(), iv.errs[0])
+	}
+
+	rSrc, err := ref.New(opt.repairFrom)
+	if err != nil {
+		return fmt.Errorf("failed to parse repair source %s: %w", opt.repairFrom, err)
+	}
+	// only repair from the same content when the target manifest is readable
+	if iv.top != "" {
+		rSrc.Digest = iv.top.String()
+	}
+	for _, d := range iv.blobs {
+		rc.log.WithFields(logrus.Fields{
+			"source": rSrc.CommonName(),
+			"target": r.CommonName(),
+			"digest": d.Digest.String(),
+		}).Info("Repair blob")
+		br, err := rc.BlobGet(ctx, rSrc, d)
+		if err != nil {
+			return fmt.Errorf("failed to get blob %s from %s: %w", d.Digest.String(), rSrc.CommonName(), err)
+		}
+		_, err = rc.BlobPut(ctx, r, d, br)
+		br.Close()
+		if err != nil {
+			return fmt.Errorf("failed to repair blob %s: %w", d.Digest.String(), err)
+		}
+	}
+	copyOpt := imageOpt{forceRecursive: true, includeExternal: opt.includeExternal}
+	err = rc.imageCopyOpt(ctx, rSrc, r, types.Descriptor{}, false, &copyOpt)
+	if err != nil {
+		return fmt.Errorf("failed to repair %s from %s: %w", r.CommonName(), rSrc.CommonName(), err)
+	}
+	iv = imageVerify{seen: map[digest.Digest]bool{}}
+	rc.imageVerifyManifest(ctx, r, types.Descriptor{}, &iv)
+	if len(iv.errs) > 0 {
+		return fmt.Errorf("%d problems remain in %s after repair, first problem: %w", len(iv.errs), r.CommonName(), iv.errs[0])
+	}
+	return nil
+}
+
+// imageVerify tracks the problems found by ImageVerify
+type imageVerify struct {
+	top   digest.Digest
+	seen  map[digest.Digest]bool
+	blobs []types.Descriptor // missing or corrupt blobs that can be replaced
+	errs  []error
+}
+
+func (iv *imageVerify) problem(err error) {
+	iv.errs = append(iv.errs, err)
+}
+
+func (rc *RegClient) imageVerifyManifest(ctx context.Context, r ref.Ref, d types.Descriptor, iv *imageVerify) {
+	if d.Digest != "" {
+		if iv.seen[d.Digest] {
+			return
+		}
+		iv.seen[d.Digest] = true
+	}
+	m, err := rc.ManifestGet(ctx, r, ManifestWithDesc(d))
+	if err != nil {
+		iv.problem(fmt.Errorf("failed to get manifest %s: %w", r.CommonName(), err))
+		return
+	}
+	if d.Digest == "" {
+		iv.top = m.GetDescriptor().Digest
+	}
+	if d.Size > 0 {
+		raw, err := m.RawBody()
+		if err != nil {
+			iv.problem(fmt.Errorf("failed to read manifest %s: %w", r.CommonName(), err))
+			return
+		}
+		if int64(len(raw)) != d.Size {
+			iv.problem(fmt.Errorf("manifest %s size mismatch, expected %d, received %d: %w", r.CommonName(), d.Size, len(raw), types.ErrMismatch))
+		}
+	}
+	rc.log.WithFields(logrus.Fields{
+		"ref": r.CommonName(),
+	}).Debug("Verify manifest")
+
+	if m.IsList() {
+		dl, err := m.GetManifestList()
+		if err != nil {
+			iv.problem(fmt.Errorf("failed to get manifest list %s: %w", r.CommonName(), err))
+			return
+		}
+		for _, entry := range dl {
+			rChild := r
+			rChild.Tag = ""
+			rChild.Digest = entry.Digest.String()
+			rc.imageVerifyManifest(ctx, rChild, entry, iv)
+		}
+		return
+	}
+
+	var diffIDs []digest.Digest
+	cd, err := m.GetConfig()
+	if err != nil && !errors.Is(err, types.ErrUnsupportedMediaType) {
+		iv.problem(fmt.Errorf("failed to get config for %s: %w", r.CommonName(), err))
+	} else if err == nil {
+		rc.imageVerifyBlob(ctx, r, cd, iv, func(rdr io.Reader) error {
+			if cd.MediaType != types.MediaTypeOCI1ImageConfig && cd.MediaType != types.MediaTypeDocker2ImageConfig {
+				_, err := io.Copy(io.Discard, rdr)
+				return err
+			}
+			conf := v1.Image{}
+			err := json.NewDecoder(rdr).Decode(&conf)
+			if err != nil {
+				return err
+			}
+			diffIDs = conf.RootFS.DiffIDs
+			// read to the end so the digest is verified
+			_, err = io.Copy(io.Discard, rdr)
+			return err
+		})
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		iv.problem(fmt.Errorf("failed to get layers for %s: %w", r.CommonName(), err))
+		return
+	}
+	if diffIDs != nil && len(diffIDs) != len(layers) {
+		iv.problem(fmt.Errorf("config for %s has %d diffIDs for %d layers: %w", r.CommonName(), len(diffIDs), len(layers), types.ErrMismatch))
+		diffIDs = nil
+	}
+	for i, ld := range layers {
+		if len(ld.URLs) > 0 {
+			// external layers are not hosted by the registry
+			continue
+		}
+		var diffID digest.Digest
+		if diffIDs != nil {
+			diffID = diffIDs[i]
+		}
+		rc.imageVerifyBlob(ctx, r, ld, iv, func(rdr io.Reader) error {
+			if diffID == "" {
+				_, err := io.Copy(io.Discard, rdr)
+				return err
+			}
+			dr, err := archive.Decompress(rdr)
+			if err != nil {
+				return err
+			}
+			digester := diffID.Algorithm().Digester()
+			_, err = io.Copy(digester.Hash(), dr)
+			if err != nil {
+				return err
+			}
+			// read any trailing data so the digest is verified
+			_, err = io.Copy(io.Discard, rdr)
+			if err != nil {
+				return err
+			}
+			if digester.Digest() != diffID {
+				iv.problem(fmt.Errorf("layer %s diffID mismatch, expected %s, computed %s: %w", ld.Digest.String(), diffID.String(), digester.Digest().String(), types.ErrDigestMismatch))
+			}
+			return nil
+		})
+	}
+}
+
+// imageVerifyBlob reads a blob with fn, any read errors mark the blob for repair
+func (rc *RegClient) imageVerifyBlob(ctx context.Context, r ref.Ref, d types.Descriptor, iv *imageVerify, fn func(io.Reader) error) {
+	if iv.seen[d.Digest] {
+		return
+	}
+	iv.seen[d.Digest] = true
+	rc.log.WithFields(logrus.Fields{
+		"ref":    r.CommonName(),
+		"digest": d.Digest.String(),
+	}).Debug("Verify blob")
+	br, err := rc.BlobGet(ctx, r, d)
+	if err != nil {
+		iv.blobs = append(iv.blobs, d)
+		iv.problem(fmt.Errorf("failed to get blob %s: %w", d.Digest.String(), err))
+		return
+	}
+	defer br.Close()
+	err = fn(br)
+	if err != nil {
+		iv.blobs = append(iv.blobs, d)
+		iv.problem(fmt.Errorf("failed to verify blob %s: %w", d.Digest.String(), err))
+	}
+}
+
 func imagePlatformInList(target *platform.Platform, list []string) (bool, error) {
 	// special case for an unset platform
 	if target == nil || target.OS == "" {
@@ -0,0 +1,621 @@
+package regclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestImageCheckBase(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := New(WithFS(fsMem))
+	rb1, err := ref.New("ocidir://testrepo:v1")
+	if err != nil {
+		t.Errorf("failed to parse ref: %v", err)
+		return
+	}
+	m1, err := rc.ManifestHead(ctx, rb1)
+	if err != nil {
+		t.Errorf("failed to get base manifest: %v", err)
+		return
+	}
+	d1 := m1.GetDescriptor().Digest.String()
+	tests := []struct {
+		name   string
+		r      string
+		opts   []ImageOpts
+		expErr error
+	}{
+		{
+			name:   "missing annotation",
+			r:      "ocidir://testrepo:v2",
+			opts:   []ImageOpts{ImageWithPlatform("linux/amd64")},
+			expErr: types.ErrMissingAnnotation,
+		},
+		{
+			name: "base digest match",
+			r:    "ocidir://testrepo:v2",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/amd64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v1"),
+				ImageWithCheckBaseDigest(d1),
+			},
+		},
+		{
+			name: "base layers match",
+			r:    "ocidir://testrepo:v3",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/arm64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v2"),
+			},
+		},
+		{
+			name: "base digest changed with matching layers",
+			r:    "ocidir://testrepo:v3",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/amd64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v1"),
+				ImageWithCheckBaseDigest("sha256:0000000000000000000000000000000000000000000000000000000000000000"),
+			},
+		},
+		{
+			name: "base layers not a prefix",
+			r:    "ocidir://testrepo:v1",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/amd64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v3"),
+			},
+			expErr: types.ErrMismatch,
+		},
+		{
+			name: "missing platform",
+			r:    "ocidir://testrepo:v3",
+			opts: []ImageOpts{
+				ImageWithPlatform("windows/amd64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v1"),
+			},
+			expErr: types.ErrNotFound,
+		},
+		{
+			name: "missing base",
+			r:    "ocidir://testrepo:v3",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/amd64"),
+				ImageWithCheckBaseRef("ocidir://testrepo:missing"),
+			},
+			expErr: types.ErrBaseUnavailable,
+		},
+		{
+			name: "missing base platform",
+			r:    "ocidir://testrepo:v3",
+			opts: []ImageOpts{
+				ImageWithPlatform("linux/arm/v6"),
+				ImageWithCheckBaseRef("ocidir://testrepo:v1"),
+			},
+			expErr: types.ErrBaseUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ref.New(tt.r)
+			if err != nil {
+				t.Errorf("failed to parse ref: %v", err)
+				return
+			}
+			err = rc.ImageCheckBase(ctx, r, tt.opts...)
+			if tt.expErr != nil {
+				if err == nil {
+					t.Errorf("check base did not fail")
+				} else if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("check base failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestImageFlatten(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	rc := New(WithFS(fsMem))
+	r, err := ref.New("ocidir://testflatten:latest")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	type entry struct {
+		name     string
+		typeflag byte
+		linkname string
+		content  string
+	}
+	layers := [][]entry{
+		{
+			{name: "dir/", typeflag: tar.TypeDir},
+			{name: "dir/a", typeflag: tar.TypeReg, content: "a0"},
+			{name: "dir/b", typeflag: tar.TypeReg, content: "b0"},
+			{name: "keep", typeflag: tar.TypeReg, content: "keep"},
+			{name: "target", typeflag: tar.TypeReg, content: "target0"},
+			{name: "link", typeflag: tar.TypeLink, linkname: "target"},
+			{name: "del", typeflag: tar.TypeReg, content: "del"},
+			{name: "sym", typeflag: tar.TypeSymlink, linkname: "/keep"},
+		},
+		{
+			{name: ".wh.del", typeflag: tar.TypeReg},
+			{name: "dir/.wh..wh..opq", typeflag: tar.TypeReg},
+			{name: "dir/c", typeflag: tar.TypeReg, content: "c1"},
+			{name: "target", typeflag: tar.TypeReg, content: "target1"},
+			{name: "x", typeflag: tar.TypeReg, content: "x1"},
+			{name: "x-link", typeflag: tar.TypeLink, linkname: "x"},
+			{name: "y", typeflag: tar.TypeReg, content: "y1"},
+			{name: "y-link", typeflag: tar.TypeLink, linkname: "y"},
+		},
+		{
+			{name: ".wh.x", typeflag: tar.TypeReg},
+		},
+	}
+	descs := []types.Descriptor{}
+	for _, l := range layers {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, e := range l {
+			err = tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.content))})
+			if err != nil {
+				t.Fatalf("failed to write header: %v", err)
+			}
+			_, err = tw.Write([]byte(e.content))
+			if err != nil {
+				t.Fatalf("failed to write content: %v", err)
+			}
+		}
+		tw.Close()
+		d, err := rc.BlobPut(ctx, r, types.Descriptor{MediaType: types.MediaTypeOCI1Layer, Digest: digest.FromBytes(buf.Bytes()), Size: int64(buf.Len())}, buf)
+		if err != nil {
+			t.Fatalf("failed to put layer: %v", err)
+		}
+		d.MediaType = types.MediaTypeOCI1Layer
+		descs = append(descs, d)
+	}
+	confBytes := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	confDesc, err := rc.BlobPut(ctx, r, types.Descriptor{MediaType: types.MediaTypeOCI1ImageConfig, Digest: digest.FromBytes(confBytes), Size: int64(len(confBytes))}, bytes.NewReader(confBytes))
+	if err != nil {
+		t.Fatalf("failed to put config: %v", err)
+	}
+	confDesc.MediaType = types.MediaTypeOCI1ImageConfig
+	m, err := manifest.New(manifest.WithOrig(v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+		Config:    confDesc,
+		Layers:    descs,
+	}))
+	if err != nil {
+		t.Fatalf("failed to create manifest: %v", err)
+	}
+	err = rc.ManifestPut(ctx, r, m)
+	if err != nil {
+		t.Fatalf("failed to put manifest: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = rc.ImageFlatten(ctx, r, buf)
+	if err != nil {
+		t.Fatalf("failed to flatten: %v", err)
+	}
+	expect := map[string]entry{
+		"dir/":   {typeflag: tar.TypeDir},
+		"dir/c":  {typeflag: tar.TypeReg, content: "c1"},
+		"keep":   {typeflag: tar.TypeReg, content: "keep"},
+		"target": {typeflag: tar.TypeReg, content: "target1"},
+		"link":   {typeflag: tar.TypeReg, content: "target0"},
+		"sym":    {typeflag: tar.TypeSymlink, linkname: "/keep"},
+		"x-link": {typeflag: tar.TypeReg, content: "x1"},
+		"y":      {typeflag: tar.TypeReg, content: "y1"},
+		"y-link": {typeflag: tar.TypeLink, linkname: "y"},
+	}
+	tr := tar.NewReader(buf)
+	found := map[string]bool{}
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read flattened tar: %v", err)
+		}
+		e, ok := expect[th.Name]
+		if !ok {
+			t.Errorf("unexpected entry: %s", th.Name)
+			continue
+		}
+		if found[th.Name] {
+			t.Errorf("duplicate entry: %s", th.Name)
+		}
+		found[th.Name] = true
+		if th.Typeflag != e.typeflag {
+			t.Errorf("type mismatch for %s, expected %c, received %c", th.Name, e.typeflag, th.Typeflag)
+		}
+		if th.Linkname != e.linkname {
+			t.Errorf("link mismatch for %s, expected %s, received %s", th.Name, e.linkname, th.Linkname)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Errorf("failed to read %s: %v", th.Name, err)
+		} else if string(b) != e.content {
+			t.Errorf("content mismatch for %s, expected %s, received %s", th.Name, e.content, string(b))
+		}
+	}
+	for name := range expect {
+		if !found[name] {
+			t.Errorf("missing entry: %s", name)
+		}
+	}
+}
+
+func TestImageCreate(t *testing.T) {
+	ctx := context.Background()
+	fsMem := rwfs.MemNew()
+	rc := New(WithFS(fsMem))
+	dirAMD64 := t.TempDir()
+	dirARM64 := t.TempDir()
+	for dir, content := range map[string]string{dirAMD64: "amd64", dirARM64: "arm64"} {
+		err := os.MkdirAll(filepath.Join(dir, "etc"), 0755)
+		if err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "etc", "arch"), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+		err = os.Symlink("etc/arch", filepath.Join(dir, "arch"))
+		if err != nil {
+			t.Fatalf("failed to create symlink: %v", err)
+		}
+	}
+	pAMD64, _ := platform.Parse("linux/amd64")
+	pARM64, _ := platform.Parse("linux/arm64")
+	conf := v1.Image{Config: v1.ImageConfig{Entrypoint: []string{"/bin/sh"}}}
+
+	t.Run("single", func(t *testing.T) {
+		r, err := ref.New("ocidir://testcreate:single")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		err = rc.ImageCreate(ctx, r, []ImageCreatePlatform{{Platform: pARM64, Rootfs: dirARM64, Config: conf}})
+		if err != nil {
+			t.Fatalf("failed to create image: %v", err)
+		}
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		if m.IsList() {
+			t.Fatalf("single platform created an index")
+		}
+		cd, err := m.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config descriptor: %v", err)
+		}
+		c, err := rc.BlobGetOCIConfig(ctx, r, cd)
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		oc := c.GetConfig()
+		if oc.OS != "linux" || oc.Architecture != "arm64" {
+			t.Errorf("unexpected platform: %s/%s", oc.OS, oc.Architecture)
+		}
+		if len(oc.RootFS.DiffIDs) != 1 {
+			t.Errorf("unexpected diff ids: %v", oc.RootFS.DiffIDs)
+		}
+		if len(oc.Config.Entrypoint) != 1 || oc.Config.Entrypoint[0] != "/bin/sh" {
+			t.Errorf("config entrypoint not preserved: %v", oc.Config.Entrypoint)
+		}
+	})
+
+	t.Run("multi-platform", func(t *testing.T) {
+		r, err := ref.New("ocidir://testcreate:multi")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		err = rc.ImageCreate(ctx, r, []ImageCreatePlatform{
+			{Platform: pAMD64, Rootfs: dirAMD64, Config: conf},
+			{Platform: pARM64, Rootfs: dirARM64, Config: conf},
+		})
+		if err != nil {
+			t.Fatalf("failed to create image: %v", err)
+		}
+		m, err := rc.ManifestGet(ctx, r)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		pl, err := manifest.GetPlatformList(m)
+		if err != nil {
+			t.Fatalf("failed to get platform list: %v", err)
+		}
+		if len(pl) != 2 || pl[0].String() != pAMD64.String() || pl[1].String() != pARM64.String() {
+			t.Errorf("unexpected platforms: %v", pl)
+		}
+		for p, expect := range map[string]string{"linux/amd64": "amd64", "linux/arm64": "arm64"} {
+			buf := &bytes.Buffer{}
+			err = rc.ImageFlatten(ctx, r, buf, ImageWithPlatform(p))
+			if err != nil {
+				t.Fatalf("failed to flatten %s: %v", p, err)
+			}
+			tr := tar.NewReader(buf)
+			found := map[string]bool{}
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("failed to read tar: %v", err)
+				}
+				found[th.Name] = true
+				switch th.Name {
+				case "etc/arch":
+					b, _ := io.ReadAll(tr)
+					if string(b) != expect {
+						t.Errorf("content mismatch for %s, expected %s, received %s", p, expect, string(b))
+					}
+				case "arch":
+					if th.Typeflag != tar.TypeSymlink || th.Linkname != "etc/arch" {
+						t.Errorf("symlink mismatch for %s: %c %s", p, th.Typeflag, th.Linkname)
+					}
+				}
+			}
+			if !found["etc/"] || !found["etc/arch"] || !found["arch"] {
+				t.Errorf("missing entries for %s: %v", p, found)
+			}
+		}
+	})
+
+	t.Run("missing rootfs", func(t *testing.T) {
+		r, err := ref.New("ocidir://testcreate:missing")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		err = rc.ImageCreate(ctx, r, []ImageCreatePlatform{{Platform: pAMD64, Rootfs: filepath.Join(dirAMD64, "missing")}})
+		if err == nil {
+			t.Errorf("create did not fail")
+		}
+	})
+}
+
+func TestImageVerify(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("ocidir://testverify:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	err = rc.ImageCopy(ctx, rSrc, rTgt)
+	if err != nil {
+		t.Fatalf("failed to copy image: %v", err)
+	}
+	err = rc.ImageVerify(ctx, rTgt)
+	if err != nil {
+		t.Fatalf("verify failed on a valid image: %v", err)
+	}
+
+	// corrupt a layer, and remove a config and child manifest
+	m, err := rc.ManifestGet(ctx, rTgt)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	dl, err := m.GetManifestList()
+	if err != nil || len(dl) < 2 {
+		t.Fatalf("failed to get manifest list: %v", err)
+	}
+	rPlat := rTgt
+	rPlat.Digest = dl[0].Digest.String()
+	mPlat, err := rc.ManifestGet(ctx, rPlat)
+	if err != nil {
+		t.Fatalf("failed to get platform manifest: %v", err)
+	}
+	cd, err := mPlat.GetConfig()
+	if err != nil {
+		t.Fatalf("failed to get config: %v", err)
+	}
+	layers, err := mPlat.GetLayers()
+	if err != nil || len(layers) == 0 {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	blobFile := func(d digest.Digest) string {
+		return filepath.Join("testverify", "blobs", d.Algorithm().String(), d.Encoded())
+	}
+	err = rwfs.WriteFile(fsMem, blobFile(layers[0].Digest), []byte("corrupt"), 0644)
+	if err != nil {
+		t.Fatalf("failed to corrupt layer: %v", err)
+	}
+	err = fsMem.Remove(blobFile(cd.Digest))
+	if err != nil {
+		t.Fatalf("failed to remove config: %v", err)
+	}
+	err = fsMem.Remove(blobFile(dl[1].Digest))
+	if err != nil {
+		t.Fatalf("failed to remove child manifest: %v", err)
+	}
+
+	err = rc.ImageVerify(ctx, rTgt)
+	if err == nil {
+		t.Fatalf("verify did not detect corruption")
+	}
+	err = rc.ImageVerify(ctx, rTgt, ImageWithRepairFrom("ocidir://testrepo:v3"))
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	err = rc.ImageVerify(ctx, rTgt)
+	if err != nil {
+		t.Errorf("verify failed after repair: %v", err)
+	}
+	err = rc.ImageVerify(ctx, rTgt, ImageWithRepairFrom("ocidir://testrepo:v3"))
+	if err != nil {
+		t.Errorf("repair failed on a valid image: %v", err)
+	}
+}
+
+func TestImageProgress(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := New(WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("ocidir://testprogress:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rImport, err := ref.New("ocidir://testprogressimport:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	type counts struct {
+		started, finished, skipped, manifests int
+		last                                  types.Progress
+	}
+	track := func(c *counts) func(types.Progress) {
+		return func(p types.Progress) {
+			if p.Overall > p.OverallSize {
+				t.Errorf("overall bytes %d exceeds overall size %d", p.Overall, p.OverallSize)
+			}
+			switch {
+			case p.Kind == types.ProgressManifest && p.State == types.ProgressFinished:
+				c.manifests++
+			case p.Kind == types.ProgressBlob && p.State == types.ProgressStarted:
+				c.started++
+			case p.Kind == types.ProgressBlob && p.State == types.ProgressFinished:
+				if p.Current != p.Desc.Size {
+					t.Errorf("blob %s finished with %d of %d bytes", p.Desc.Digest, p.Current, p.Desc.Size)
+				}
+				c.finished++
+			case p.Kind == types.ProgressBlob && p.State == types.ProgressSkipped:
+				c.skipped++
+			}
+			c.last = p
+		}
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		c := counts{}
+		err := rc.ImageCopy(ctx, rSrc, rTgt, ImageWithProgress(track(&c)))
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if c.started == 0 || c.started != c.finished {
+			t.Errorf("unexpected blob counts, started %d, finished %d", c.started, c.finished)
+		}
+		if c.manifests < 2 {
+			t.Errorf("expected index and platform manifests, received %d", c.manifests)
+		}
+		if c.last.Overall != c.last.OverallSize || c.last.Overall == 0 {
+			t.Errorf("overall progress incomplete, %d of %d", c.last.Overall, c.last.OverallSize)
+		}
+	})
+	t.Run("copy skipped", func(t *testing.T) {
+		c := counts{}
+		err := rc.ImageCopy(ctx, rSrc, rTgt, ImageWithForceRecursive(), ImageWithProgress(track(&c)))
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if c.started != 0 || c.skipped == 0 {
+			t.Errorf("unexpected blob counts, started %d, skipped %d", c.started, c.skipped)
+		}
+	})
+	t.Run("export and import", func(t *testing.T) {
+		cExport := counts{}
+		buf := &bytes.Buffer{}
+		err := rc.ImageExport(ctx, rSrc, buf, ImageWithProgress(track(&cExport)))
+		if err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+		if cExport.started == 0 || cExport.started != cExport.finished || cExport.manifests == 0 {
+			t.Errorf("unexpected export counts: %+v", cExport)
+		}
+		cImport := counts{}
+		err = rc.ImageImport(ctx, rImport, bytes.NewReader(buf.Bytes()), ImageWithProgress(track(&cImport)))
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		// the index is pushed by digest and then tagged
+		if cImport.finished != cExport.finished || cImport.manifests < cExport.manifests {
+			t.Errorf("import counts do not match export, export %+v, import %+v", cExport, cImport)
+		}
+	})
+	t.Run("blob copy", func(t *testing.T) {
+		m, err := rc.ManifestGet(ctx, rSrc, ManifestWithDesc(types.Descriptor{}))
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		rPlat := rSrc
+		rPlat.Digest = dl[0].Digest.String()
+		mPlat, err := rc.ManifestGet(ctx, rPlat)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		cd, err := mPlat.GetConfig()
+		if err != nil {
+			t.Fatalf("failed to get config: %v", err)
+		}
+		rBlob, err := ref.New("ocidir://testprogressblob")
+		if err != nil {
+			t.Fatalf("failed to parse ref: %v", err)
+		}
+		c := counts{}
+		err = rc.BlobCopy(ctx, rSrc, rBlob, cd, BlobWithProgress(track(&c)))
+		if err != nil {
+			t.Fatalf("failed to copy blob: %v", err)
+		}
+		if c.finished != 1 || c.last.Overall != cd.Size {
+			t.Errorf("unexpected blob copy progress: %+v", c)
+		}
+		c = counts{}
+		err = rc.BlobCopy(ctx, rSrc, rBlob, cd, BlobWithProgress(track(&c)))
+		if err != nil {
+			t.Fatalf("failed to copy blob: %v", err)
+		}
+		if c.skipped != 1 || c.finished != 0 {
+			t.Errorf("existing blob was not skipped: %+v", c)
+		}
+	})
+}
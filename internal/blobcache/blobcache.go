@@ -0,0 +1,319 @@
+// Package blobcache stores verified content by digest in a local directory with LRU eviction
+package blobcache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+)
+
+const (
+	blobsDir = "blobs"
+	tmpDir   = "tmp"
+	// tmpMaxAge is the age of a temporary file before Prune considers it abandoned
+	tmpMaxAge = time.Hour
+)
+
+// Cache is a content addressed store of blobs and manifests.
+// Content is only added after the digest is verified.
+type Cache struct {
+	mu      sync.Mutex
+	fs      rwfs.RWFS
+	dir     string
+	maxSize int64
+	loaded  bool
+	entries map[digest.Digest]*entry
+	size    int64
+}
+
+type entry struct {
+	size int64
+	used time.Time
+}
+
+// Stats summarizes the content of the cache
+type Stats struct {
+	Count int   `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+// New returns a cache in dir, evicting the least recently used content when maxSize bytes is exceeded.
+// A maxSize <= 0 disables eviction.
+func New(fsys rwfs.RWFS, dir string, maxSize int64) *Cache {
+	if dir == "" {
+		dir = "."
+	}
+	return &Cache{
+		fs:      fsys,
+		dir:     path.Clean(dir),
+		maxSize: maxSize,
+		entries: map[digest.Digest]*entry{},
+	}
+}
+
+// Get returns a reader for the content and the size, types.ErrNotFound is returned on a cache miss
+func (c *Cache) Get(d digest.Digest) (io.ReadCloser, int64, error) {
+	if err := d.Validate(); err != nil {
+		return nil, 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return nil, 0, err
+	}
+	e, ok := c.entries[d]
+	if !ok {
+		return nil, 0, types.ErrNotFound
+	}
+	fh, err := c.fs.Open(c.filename(d))
+	if err != nil {
+		// content was removed outside of this cache
+		c.drop(d)
+		return nil, 0, types.ErrNotFound
+	}
+	// the modified time tracks the last access for the next load, errors only affect the eviction order
+	e.used = time.Now()
+	_ = rwfs.Chtimes(c.fs, c.filename(d), e.used, e.used)
+	return fh, e.size, nil
+}
+
+// Put verifies and adds the bytes to the cache
+func (c *Cache) Put(d digest.Digest, data []byte) error {
+	w, err := c.Writer(d, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Cancel()
+		return err
+	}
+	return w.Commit()
+}
+
+// Writer returns a Writer to add content to the cache, size may be 0 when unknown.
+// types.ErrMismatch is returned when the content already exists.
+func (c *Cache) Writer(d digest.Digest, size int64) (*Writer, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if err := c.load(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	_, ok := c.entries[d]
+	c.mu.Unlock()
+	if ok {
+		return nil, fmt.Errorf("content already cached %s: %w", d.String(), types.ErrMismatch)
+	}
+	tmpName, err := c.tmpName()
+	if err != nil {
+		return nil, err
+	}
+	if err := rwfs.MkdirAll(c.fs, path.Dir(tmpName), 0700); err != nil {
+		return nil, err
+	}
+	fh, err := c.fs.Create(tmpName)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		c:        c,
+		d:        d,
+		size:     size,
+		tmpName:  tmpName,
+		fh:       fh,
+		verifier: d.Verifier(),
+	}, nil
+}
+
+// Prune evicts the least recently used content until the cache is under maxSize bytes.
+// Temporary files not modified within the last hour are considered abandoned and also removed.
+// The remaining content is returned.
+func (c *Cache) Prune(maxSize int64) (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return Stats{}, err
+	}
+	// remove abandoned temporary files, recent files may still be written by another process
+	tmpEntries, err := fs.ReadDir(c.fs, path.Join(c.dir, tmpDir))
+	if err == nil {
+		for _, de := range tmpEntries {
+			fi, err := de.Info()
+			if err != nil || time.Since(fi.ModTime()) < tmpMaxAge {
+				continue
+			}
+			_ = c.fs.Remove(path.Join(c.dir, tmpDir, de.Name()))
+		}
+	}
+	err = c.evict(maxSize)
+	return Stats{Count: len(c.entries), Size: c.size}, err
+}
+
+// Stats returns the number and total size of the cached content
+func (c *Cache) Stats() (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return Stats{}, err
+	}
+	return Stats{Count: len(c.entries), Size: c.size}, nil
+}
+
+// load reads the existing content on first use, the modified time is used as the last access
+func (c *Cache) load() error {
+	if c.loaded {
+		return nil
+	}
+	algs, err := fs.ReadDir(c.fs, path.Join(c.dir, blobsDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+		files, err := fs.ReadDir(c.fs, path.Join(c.dir, blobsDir, alg.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), file.Name())
+			if file.IsDir() || d.Validate() != nil {
+				continue
+			}
+			fi, err := file.Info()
+			if err != nil {
+				return err
+			}
+			c.entries[d] = &entry{size: fi.Size(), used: fi.ModTime()}
+			c.size += fi.Size()
+		}
+	}
+	c.loaded = true
+	return nil
+}
+
+// evict removes the least recently used content until size is under maxSize, caller must hold the lock
+func (c *Cache) evict(maxSize int64) error {
+	if maxSize <= 0 || c.size <= maxSize {
+		return nil
+	}
+	list := make([]digest.Digest, 0, len(c.entries))
+	for d := range c.entries {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return c.entries[list[i]].used.Before(c.entries[list[j]].used)
+	})
+	for _, d := range list {
+		if c.size <= maxSize {
+			break
+		}
+		if err := c.fs.Remove(c.filename(d)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		c.drop(d)
+	}
+	return nil
+}
+
+// drop removes an entry from the index, caller must hold the lock
+func (c *Cache) drop(d digest.Digest) {
+	if e, ok := c.entries[d]; ok {
+		c.size -= e.size
+		delete(c.entries, d)
+	}
+}
+
+func (c *Cache) filename(d digest.Digest) string {
+	return path.Join(c.dir, blobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+func (c *Cache) tmpName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return path.Join(c.dir, tmpDir, hex.EncodeToString(b)), nil
+}
+
+// Writer adds content to the cache, Commit must be called to verify and store the content, or Cancel to discard it
+type Writer struct {
+	c        *Cache
+	d        digest.Digest
+	size     int64
+	written  int64
+	tmpName  string
+	fh       rwfs.WFile
+	verifier digest.Verifier
+	done     bool
+}
+
+// Write adds bytes to the content
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.done {
+		return 0, fmt.Errorf("cache writer is closed")
+	}
+	n, err := w.fh.Write(b)
+	w.written += int64(n)
+	w.verifier.Write(b[:n])
+	return n, err
+}
+
+// Commit verifies the content and adds it to the cache
+func (w *Writer) Commit() error {
+	if w.done {
+		return fmt.Errorf("cache writer is closed")
+	}
+	w.done = true
+	defer w.c.fs.Remove(w.tmpName)
+	if err := w.fh.Close(); err != nil {
+		return err
+	}
+	if w.size > 0 && w.size != w.written {
+		return fmt.Errorf("size mismatch, expected %d, received %d: %w", w.size, w.written, types.ErrMismatch)
+	}
+	if !w.verifier.Verified() {
+		return fmt.Errorf("content does not match %s: %w", w.d.String(), types.ErrDigestMismatch)
+	}
+	c := w.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[w.d]; ok {
+		return nil
+	}
+	filename := c.filename(w.d)
+	if err := rwfs.MkdirAll(c.fs, path.Dir(filename), 0700); err != nil {
+		return err
+	}
+	// rename so other readers never see a partial file
+	if err := rwfs.Rename(c.fs, w.tmpName, filename); err != nil {
+		return err
+	}
+	c.entries[w.d] = &entry{size: w.written, used: time.Now()}
+	c.size += w.written
+	return c.evict(c.maxSize)
+}
+
+// Cancel discards the content
+func (w *Writer) Cancel() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.fh.Close()
+	w.c.fs.Remove(w.tmpName)
+}
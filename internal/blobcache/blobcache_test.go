@@ -0,0 +1,219 @@
+package blobcache
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+)
+
+func TestCache(t *testing.T) {
+	fsMem := rwfs.MemNew()
+	b1 := []byte("hello world")
+	b2 := []byte("hello cache")
+	b3 := []byte("hello again")
+	d1 := digest.FromBytes(b1)
+	d2 := digest.FromBytes(b2)
+	d3 := digest.FromBytes(b3)
+	size := int64(len(b1))
+	c := New(fsMem, "cache", size*2)
+
+	t.Run("miss", func(t *testing.T) {
+		_, _, err := c.Get(d1)
+		if !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("unexpected error, expected not found, received %v", err)
+		}
+	})
+	t.Run("put and get", func(t *testing.T) {
+		if err := c.Put(d1, b1); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		rdr, rdrSize, err := c.Get(d1)
+		if err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+		defer rdr.Close()
+		out, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if string(out) != string(b1) || rdrSize != size {
+			t.Errorf("unexpected content, size %d, received %s", rdrSize, string(out))
+		}
+	})
+	t.Run("put existing", func(t *testing.T) {
+		if err := c.Put(d1, b1); !errors.Is(err, types.ErrMismatch) {
+			t.Errorf("unexpected error, expected mismatch, received %v", err)
+		}
+	})
+	t.Run("digest mismatch", func(t *testing.T) {
+		if err := c.Put(d2, b1); !errors.Is(err, types.ErrDigestMismatch) {
+			t.Errorf("unexpected error, expected digest mismatch, received %v", err)
+		}
+		if _, _, err := c.Get(d2); !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("mismatched content was cached: %v", err)
+		}
+	})
+	t.Run("size mismatch", func(t *testing.T) {
+		w, err := c.Writer(d2, size+1)
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+		if _, err := w.Write(b2); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if err := w.Commit(); !errors.Is(err, types.ErrMismatch) {
+			t.Errorf("unexpected error, expected mismatch, received %v", err)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		w, err := c.Writer(d2, size)
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+		if _, err := w.Write(b2); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		w.Cancel()
+		if _, _, err := c.Get(d2); !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("canceled content was cached: %v", err)
+		}
+	})
+	t.Run("evict", func(t *testing.T) {
+		if err := c.Put(d2, b2); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+		// access d1 so d2 is the least recently used
+		rdr, _, err := c.Get(d1)
+		if err != nil {
+			t.Fatalf("failed to get: %v", err)
+		}
+		rdr.Close()
+		if err := c.Put(d3, b3); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		if _, _, err := c.Get(d2); !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("least recently used content was not evicted: %v", err)
+		}
+		for _, d := range []digest.Digest{d1, d3} {
+			rdr, _, err := c.Get(d)
+			if err != nil {
+				t.Errorf("content evicted %s: %v", d, err)
+				continue
+			}
+			rdr.Close()
+		}
+		stats, err := c.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if stats.Count != 2 || stats.Size != size*2 {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+	})
+	t.Run("reload", func(t *testing.T) {
+		c2 := New(fsMem, "cache", 0)
+		stats, err := c2.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if stats.Count != 2 || stats.Size != size*2 {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+	})
+	t.Run("prune", func(t *testing.T) {
+		// leave an abandoned and an active temporary file
+		wOld, err := c.Writer(d2, size)
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+		old := time.Now().Add(-2 * tmpMaxAge)
+		if err := rwfs.Chtimes(fsMem, wOld.tmpName, old, old); err != nil {
+			t.Fatalf("failed to set time: %v", err)
+		}
+		wActive, err := c.Writer(d2, size)
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+		stats, err := c.Prune(size)
+		if err != nil {
+			t.Fatalf("failed to prune: %v", err)
+		}
+		if stats.Count != 1 || stats.Size != size {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+		if _, _, err := c.Get(d3); err != nil {
+			t.Errorf("most recent content was pruned: %v", err)
+		}
+		tmpFiles, err := fs.ReadDir(fsMem, "cache/tmp")
+		if err != nil {
+			t.Fatalf("failed to read tmp: %v", err)
+		}
+		if len(tmpFiles) != 1 || "cache/tmp/"+tmpFiles[0].Name() != wActive.tmpName {
+			t.Errorf("unexpected temporary files, expected %s, received %v", wActive.tmpName, tmpFiles)
+		}
+		wActive.Cancel()
+		stats, err = c.Prune(0)
+		if err != nil || stats.Count != 1 {
+			t.Errorf("prune without a limit removed content: %v, %v", stats, err)
+		}
+	})
+}
+
+func TestCacheAccess(t *testing.T) {
+	fsMem := rwfs.MemNew()
+	b1 := []byte("hello world")
+	b2 := []byte("hello cache")
+	d1 := digest.FromBytes(b1)
+	d2 := digest.FromBytes(b2)
+	size := int64(len(b1))
+	c := New(fsMem, "cache", 0)
+	for i, tt := range []struct {
+		d digest.Digest
+		b []byte
+	}{{d: d1, b: b1}, {d: d2, b: b2}} {
+		if err := c.Put(tt.d, tt.b); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		// d1 is older than d2
+		mod := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := rwfs.Chtimes(fsMem, c.filename(tt.d), mod, mod); err != nil {
+			t.Fatalf("failed to set time: %v", err)
+		}
+	}
+	tmpFiles, err := fs.ReadDir(fsMem, "cache/tmp")
+	if err != nil {
+		t.Fatalf("failed to read tmp: %v", err)
+	}
+	if len(tmpFiles) > 0 {
+		t.Errorf("temporary files not removed after commit: %v", tmpFiles)
+	}
+	// access d1 so it is the most recently used after a reload
+	rdr, _, err := c.Get(d1)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	rdr.Close()
+	c2 := New(fsMem, "cache", 0)
+	stats, err := c2.Prune(size)
+	if err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if stats.Count != 1 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+	if _, _, err := c2.Get(d2); !errors.Is(err, types.ErrNotFound) {
+		t.Errorf("least recently used content was not evicted: %v", err)
+	}
+	rdr, _, err = c2.Get(d1)
+	if err != nil {
+		t.Fatalf("accessed content was evicted: %v", err)
+	}
+	rdr.Close()
+}
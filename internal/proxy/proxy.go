@@ -0,0 +1,415 @@
+// Package proxy implements a read-only pull-through registry backed by an OCI Layout directory
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	repoRE = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	tagRE  = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// Proxy serves the read side of the distribution API.
+// Content is pulled from the upstream registry on a cache miss and stored in the OCI Layout directory.
+type Proxy struct {
+	RC       *regclient.RegClient
+	Log      *logrus.Logger
+	Upstream string        // upstream registry, e.g. docker.io
+	Store    string        // directory containing an OCI Layout for each repository
+	TagTTL   time.Duration // duration before a tag is resolved again with the upstream registry
+
+	initOnce sync.Once
+	mu       sync.Mutex
+	tags     map[string]time.Time // repo:tag to the last time it was resolved
+	locks    map[string]*keyLock  // repository and digest locks for content being added to the store
+	idxMu    sync.Mutex           // serializes updates to the OCI Layout index
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// ServeHTTP routes requests for the distribution API
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.initOnce.Do(func() {
+		p.tags = map[string]time.Time{}
+		p.locks = map[string]*keyLock{}
+	})
+	log := p.logger()
+	log.WithFields(logrus.Fields{
+		"method": req.Method,
+		"path":   req.URL.Path,
+	}).Debug("Proxy request")
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		p.errorResp(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "proxy is read-only")
+		return
+	}
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if req.URL.Path == "/v2/" || req.URL.Path == "/v2" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		p.errorResp(w, http.StatusNotFound, "UNSUPPORTED", "unknown path")
+		return
+	}
+	reqPath := strings.TrimPrefix(req.URL.Path, "/v2/")
+	head := req.Method == http.MethodHead
+	if i := strings.LastIndex(reqPath, "/manifests/"); i > 0 {
+		p.manifest(req.Context(), w, reqPath[:i], reqPath[i+len("/manifests/"):], req.Header.Values("Accept"), head)
+	} else if i := strings.LastIndex(reqPath, "/blobs/"); i > 0 {
+		p.blob(req.Context(), w, reqPath[:i], reqPath[i+len("/blobs/"):], head)
+	} else if strings.HasSuffix(reqPath, "/tags/list") {
+		p.tagList(w, req, strings.TrimSuffix(reqPath, "/tags/list"))
+	} else {
+		p.errorResp(w, http.StatusNotFound, "UNSUPPORTED", "unknown path")
+	}
+}
+
+func (p *Proxy) manifest(ctx context.Context, w http.ResponseWriter, repo, reference string, accept []string, head bool) {
+	rUp, rLocal, err := p.refs(repo)
+	if err != nil {
+		p.errorResp(w, http.StatusNotFound, "NAME_INVALID", err.Error())
+		return
+	}
+	if dig, errD := digest.Parse(reference); errD == nil {
+		rUp.Digest, rLocal.Digest = dig.String(), dig.String()
+	} else if tagRE.MatchString(reference) {
+		rUp.Tag, rLocal.Tag = reference, reference
+	} else {
+		p.errorResp(w, http.StatusNotFound, "MANIFEST_INVALID", "invalid reference")
+		return
+	}
+	m, err := p.manifestGet(ctx, rUp, rLocal)
+	if err != nil {
+		p.upstreamErr(w, err, "MANIFEST_UNKNOWN")
+		return
+	}
+	raw, err := m.RawBody()
+	if err != nil {
+		p.errorResp(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	desc := m.GetDescriptor()
+	if !manifestAccepted(accept, desc.MediaType) {
+		p.errorResp(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest media type %s is not accepted by the client", desc.MediaType))
+		return
+	}
+	w.Header().Set("Content-Type", desc.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.WriteHeader(http.StatusOK)
+	if !head {
+		w.Write(raw)
+	}
+}
+
+// manifestAccepted returns true when the media type is included in the Accept headers, or no Accept header was sent
+func manifestAccepted(accept []string, mt string) bool {
+	found := false
+	for _, a := range accept {
+		for _, entry := range strings.Split(a, ",") {
+			entry = strings.TrimSpace(strings.SplitN(entry, ";", 2)[0])
+			if entry == "" {
+				continue
+			}
+			found = true
+			if entry == mt || entry == "*/*" || (strings.HasSuffix(entry, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(entry, "*"))) {
+				return true
+			}
+		}
+	}
+	return !found
+}
+
+// manifestGet returns the manifest from the store, pulling from upstream when missing or when the tag has expired
+func (p *Proxy) manifestGet(ctx context.Context, rUp, rLocal ref.Ref) (manifest.Manifest, error) {
+	log := p.logger()
+	unlock := p.lock(rLocal.CommonName())
+	defer unlock()
+	if rLocal.Digest != "" {
+		if m, err := p.RC.ManifestGet(ctx, rLocal); err == nil {
+			return m, nil
+		}
+		return p.manifestPull(ctx, rUp, rLocal)
+	}
+	// tags are served from the store until the TTL expires
+	p.mu.Lock()
+	resolved, ok := p.tags[rLocal.CommonName()]
+	p.mu.Unlock()
+	mLocal, errLocal := p.RC.ManifestGet(ctx, rLocal)
+	if errLocal == nil && ok && time.Since(resolved) < p.TagTTL {
+		return mLocal, nil
+	}
+	mHead, err := p.RC.ManifestHead(ctx, rUp)
+	if err != nil {
+		if errLocal == nil {
+			log.WithFields(logrus.Fields{
+				"ref": rUp.CommonName(),
+				"err": err,
+			}).Warn("Upstream unavailable, serving cached tag")
+			return mLocal, nil
+		}
+		return nil, err
+	}
+	if errLocal == nil && mHead.GetDescriptor().Digest != "" && mHead.GetDescriptor().Digest == mLocal.GetDescriptor().Digest {
+		p.tagResolved(rLocal)
+		return mLocal, nil
+	}
+	m, err := p.manifestPull(ctx, rUp, rLocal)
+	if err != nil {
+		if errLocal == nil {
+			log.WithFields(logrus.Fields{
+				"ref": rUp.CommonName(),
+				"err": err,
+			}).Warn("Upstream pull failed, serving cached tag")
+			return mLocal, nil
+		}
+		return nil, err
+	}
+	p.tagResolved(rLocal)
+	return m, nil
+}
+
+// manifestPull copies a manifest from upstream into the store
+func (p *Proxy) manifestPull(ctx context.Context, rUp, rLocal ref.Ref) (manifest.Manifest, error) {
+	m, err := p.RC.ManifestGet(ctx, rUp)
+	if err != nil {
+		return nil, err
+	}
+	if rLocal.Digest != "" && m.GetDescriptor().Digest.String() != rLocal.Digest {
+		return nil, fmt.Errorf("upstream manifest digest mismatch, expected %s, received %s: %w", rLocal.Digest, m.GetDescriptor().Digest.String(), types.ErrDigestMismatch)
+	}
+	p.idxMu.Lock()
+	err = p.RC.ManifestPut(ctx, rLocal, m)
+	p.idxMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	p.logger().WithFields(logrus.Fields{
+		"ref":    rUp.CommonName(),
+		"digest": m.GetDescriptor().Digest,
+	}).Info("Manifest pulled from upstream")
+	return m, nil
+}
+
+func (p *Proxy) blob(ctx context.Context, w http.ResponseWriter, repo, reference string, head bool) {
+	rUp, rLocal, err := p.refs(repo)
+	if err != nil {
+		p.errorResp(w, http.StatusNotFound, "NAME_INVALID", err.Error())
+		return
+	}
+	dig, err := digest.Parse(reference)
+	if err != nil {
+		p.errorResp(w, http.StatusNotFound, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+	d := types.Descriptor{Digest: dig}
+	unlock := p.lock(rLocal.CommonName() + "@" + dig.String())
+	if head {
+		b, err := p.RC.BlobHead(ctx, rLocal, d)
+		if err != nil {
+			b, err = p.RC.BlobHead(ctx, rUp, d)
+		}
+		unlock()
+		if err != nil {
+			p.upstreamErr(w, err, "BLOB_UNKNOWN")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(b.GetDescriptor().Size, 10))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", dig.String())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if _, err := p.RC.BlobHead(ctx, rLocal, d); err != nil {
+		err = p.RC.BlobCopy(ctx, rUp, rLocal, d)
+		if err != nil {
+			unlock()
+			p.upstreamErr(w, err, "BLOB_UNKNOWN")
+			return
+		}
+		p.logger().WithFields(logrus.Fields{
+			"ref":    rUp.CommonName(),
+			"digest": dig,
+		}).Info("Blob pulled from upstream")
+	}
+	unlock()
+	b, err := p.RC.BlobGet(ctx, rLocal, d)
+	if err != nil {
+		p.errorResp(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer b.Close()
+	w.Header().Set("Content-Length", strconv.FormatInt(b.GetDescriptor().Size, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", dig.String())
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, b); err != nil {
+		p.logger().WithFields(logrus.Fields{
+			"ref":    rLocal.CommonName(),
+			"digest": dig,
+			"err":    err,
+		}).Warn("Failed to send blob")
+	}
+}
+
+func (p *Proxy) tagList(w http.ResponseWriter, req *http.Request, repo string) {
+	rUp, rLocal, err := p.refs(repo)
+	if err != nil {
+		p.errorResp(w, http.StatusNotFound, "NAME_INVALID", err.Error())
+		return
+	}
+	tl, err := p.RC.TagList(req.Context(), rUp)
+	if err != nil {
+		tlLocal, errLocal := p.RC.TagList(req.Context(), rLocal)
+		if errLocal != nil {
+			p.upstreamErr(w, err, "NAME_UNKNOWN")
+			return
+		}
+		p.logger().WithFields(logrus.Fields{
+			"ref": rUp.CommonName(),
+			"err": err,
+		}).Warn("Upstream unavailable, serving cached tags")
+		tl = tlLocal
+	}
+	tags, err := tl.GetTags()
+	if err != nil {
+		p.errorResp(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	sort.Strings(tags)
+	if last := req.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+	if n, err := strconv.Atoi(req.URL.Query().Get("n")); err == nil && n >= 0 && n < len(tags) {
+		tags = tags[:n]
+		if n > 0 {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, repo, n, tags[n-1]))
+		}
+	}
+	body, err := json.Marshal(struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}{Name: repo, Tags: tags})
+	if err != nil {
+		p.errorResp(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// refs returns the upstream and store references for a repository
+func (p *Proxy) refs(repo string) (ref.Ref, ref.Ref, error) {
+	if !repoRE.MatchString(repo) {
+		return ref.Ref{}, ref.Ref{}, fmt.Errorf("invalid repository name %s", repo)
+	}
+	rUp, err := ref.New(p.Upstream + "/" + repo)
+	if err != nil {
+		return ref.Ref{}, ref.Ref{}, err
+	}
+	rLocal, err := ref.New("ocidir://" + path.Join(p.Store, repo))
+	if err != nil {
+		return ref.Ref{}, ref.Ref{}, err
+	}
+	rUp.Tag, rLocal.Tag = "", ""
+	return rUp, rLocal, nil
+}
+
+// lock serializes requests that add the same content to the store
+func (p *Proxy) lock(key string) func() {
+	p.mu.Lock()
+	l, ok := p.locks[key]
+	if !ok {
+		l = &keyLock{}
+		p.locks[key] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, key)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Proxy) tagResolved(r ref.Ref) {
+	p.mu.Lock()
+	p.tags[r.CommonName()] = time.Now()
+	p.mu.Unlock()
+}
+
+// upstreamErr returns the status for an error pulling from the upstream registry
+func (p *Proxy) upstreamErr(w http.ResponseWriter, err error, code string) {
+	switch {
+	case errors.Is(err, types.ErrNotFound):
+		p.errorResp(w, http.StatusNotFound, code, err.Error())
+	case errors.Is(err, types.ErrRateLimit):
+		p.errorResp(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", err.Error())
+	case errors.Is(err, types.ErrUnauthorized):
+		p.errorResp(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+	default:
+		p.logger().WithFields(logrus.Fields{
+			"err": err,
+		}).Warn("Upstream request failed")
+		p.errorResp(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+	}
+}
+
+// errorResp sends an error in the format of the distribution spec
+func (p *Proxy) errorResp(w http.ResponseWriter, status int, code, message string) {
+	type errEntry struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	body, _ := json.Marshal(struct {
+		Errors []errEntry `json:"errors"`
+	}{Errors: []errEntry{{Code: code, Message: message}}})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func (p *Proxy) logger() *logrus.Logger {
+	if p.Log != nil {
+		return p.Log
+	}
+	return &logrus.Logger{Out: ioutil.Discard}
+}
@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/reqresp"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types"
+)
+
+func TestProxy(t *testing.T) {
+	repoPath := "/library/test"
+	blobLen := 1024
+	d1, blob1 := reqresp.NewRandomBlob(blobLen, 1)
+	m1 := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[]}`,
+		types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ImageConfig, d1.String(), blobLen))
+	dm1 := digest.FromBytes(m1)
+	manifestHeaders := http.Header{
+		"Content-Length":        {fmt.Sprintf("%d", len(m1))},
+		"Content-Type":          {types.MediaTypeOCI1Manifest},
+		"Docker-Content-Digest": {dm1.String()},
+	}
+	// single use entries fail the test if the proxy pulls from upstream more than once
+	rrs := []reqresp.ReqResp{
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "HEAD manifest",
+				DelOnUse: true,
+				Method:   "HEAD",
+				Path:     "/v2" + repoPath + "/manifests/v1",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status:  http.StatusOK,
+				Headers: manifestHeaders,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "GET manifest",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + repoPath + "/manifests/v1",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status:  http.StatusOK,
+				Body:    m1,
+				Headers: manifestHeaders,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:     "GET blob",
+				DelOnUse: true,
+				Method:   "GET",
+				Path:     "/v2" + repoPath + "/blobs/" + d1.String(),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   blob1,
+				Headers: http.Header{
+					"Content-Length":        {fmt.Sprintf("%d", blobLen)},
+					"Content-Type":          {"application/octet-stream"},
+					"Docker-Content-Digest": {d1.String()},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "HEAD missing blob",
+				Method: "HEAD",
+				PathRE: regexp.MustCompile(`^/v2` + repoPath + `/blobs/`),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusNotFound,
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "GET tags",
+				Method: "GET",
+				Path:   "/v2" + repoPath + "/tags/list",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Body:   []byte(`{"name":"library/test","tags":["v2","v1","v3"]}`),
+				Headers: http.Header{
+					"Content-Type": {"application/json"},
+				},
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "HEAD manifest rate limited",
+				Method: "HEAD",
+				PathRE: regexp.MustCompile(`^/v2` + repoPath + `/manifests/`),
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusTooManyRequests,
+			},
+		},
+	}
+	rrs = append(rrs, reqresp.BaseEntries...)
+	tsUp := httptest.NewServer(reqresp.NewHandler(t, rrs))
+	defer tsUp.Close()
+	upURL, _ := url.Parse(tsUp.URL)
+	delayInit, _ := time.ParseDuration("0.05s")
+	delayMax, _ := time.ParseDuration("0.10s")
+	rc := regclient.New(
+		regclient.WithFS(rwfs.MemNew()),
+		regclient.WithConfigHost(config.Host{
+			Name:     upURL.Host,
+			Hostname: upURL.Host,
+			TLS:      config.TLSDisabled,
+		}),
+		regclient.WithRetryDelay(delayInit, delayMax),
+		regclient.WithRetryLimit(1),
+	)
+	p := &Proxy{
+		RC:       rc,
+		Upstream: upURL.Host,
+		Store:    "store",
+		TagTTL:   time.Hour,
+	}
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    http.Header
+		expStatus  int
+		expBody    []byte
+		expHeaders http.Header
+	}{
+		{
+			name:      "api",
+			method:    "GET",
+			path:      "/v2/",
+			expStatus: http.StatusOK,
+		},
+		{
+			name:      "manifest pull",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/manifests/v1",
+			expStatus: http.StatusOK,
+			expBody:   m1,
+			expHeaders: http.Header{
+				"Content-Type":          {types.MediaTypeOCI1Manifest},
+				"Docker-Content-Digest": {dm1.String()},
+			},
+		},
+		{
+			name:      "manifest cached tag",
+			method:    "HEAD",
+			path:      "/v2" + repoPath + "/manifests/v1",
+			expStatus: http.StatusOK,
+			expHeaders: http.Header{
+				"Docker-Content-Digest": {dm1.String()},
+			},
+		},
+		{
+			name:      "manifest cached digest",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/manifests/" + dm1.String(),
+			expStatus: http.StatusOK,
+			expBody:   m1,
+		},
+		{
+			name:      "manifest accepted",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/manifests/v1",
+			headers:   http.Header{"Accept": {types.MediaTypeDocker2Manifest + ", " + types.MediaTypeOCI1Manifest + ";q=0.9"}},
+			expStatus: http.StatusOK,
+			expBody:   m1,
+		},
+		{
+			name:      "manifest accepted wildcard",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/manifests/v1",
+			headers:   http.Header{"Accept": {types.MediaTypeDocker2Manifest, "*/*"}},
+			expStatus: http.StatusOK,
+			expBody:   m1,
+		},
+		{
+			name:      "manifest not accepted",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/manifests/v1",
+			headers:   http.Header{"Accept": {types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList}},
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name:      "blob pull",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/blobs/" + d1.String(),
+			expStatus: http.StatusOK,
+			expBody:   blob1,
+		},
+		{
+			name:      "blob cached",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/blobs/" + d1.String(),
+			expStatus: http.StatusOK,
+			expBody:   blob1,
+		},
+		{
+			name:      "blob head cached",
+			method:    "HEAD",
+			path:      "/v2" + repoPath + "/blobs/" + d1.String(),
+			expStatus: http.StatusOK,
+			expHeaders: http.Header{
+				"Content-Length": {fmt.Sprintf("%d", blobLen)},
+			},
+		},
+		{
+			name:      "blob missing",
+			method:    "HEAD",
+			path:      "/v2" + repoPath + "/blobs/" + dm1.String()[:len(dm1.String())-4] + "0000",
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name:      "tag list",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/tags/list",
+			expStatus: http.StatusOK,
+			expBody:   []byte(`{"name":"library/test","tags":["v1","v2","v3"]}`),
+		},
+		{
+			name:      "tag list paginated",
+			method:    "GET",
+			path:      "/v2" + repoPath + "/tags/list?n=1&last=v1",
+			expStatus: http.StatusOK,
+			expBody:   []byte(`{"name":"library/test","tags":["v2"]}`),
+			expHeaders: http.Header{
+				"Link": {`</v2/library/test/tags/list?n=1&last=v2>; rel="next"`},
+			},
+		},
+		{
+			name:      "invalid repo",
+			method:    "GET",
+			path:      "/v2/../etc/manifests/v1",
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name:      "push rejected",
+			method:    "PUT",
+			path:      "/v2" + repoPath + "/manifests/v2",
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			for k, v := range tt.headers {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if resp.StatusCode != tt.expStatus {
+				t.Errorf("unexpected status, expected %d, received %d, body %s", tt.expStatus, resp.StatusCode, string(body))
+			}
+			if tt.expBody != nil && !bytes.Equal(body, tt.expBody) {
+				t.Errorf("unexpected body, received %s", strings.TrimSpace(string(body)))
+			}
+			for k, v := range tt.expHeaders {
+				if resp.Header.Get(k) != v[0] {
+					t.Errorf("unexpected header %s, expected %s, received %s", k, v[0], resp.Header.Get(k))
+				}
+			}
+		})
+	}
+
+	t.Run("stale tag", func(t *testing.T) {
+		// an expired tag is served from the store when upstream is rate limited
+		p.TagTTL = 0
+		resp, err := http.Get(ts.URL + "/v2" + repoPath + "/manifests/v1")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, m1) {
+			t.Errorf("unexpected response, status %d, body %s", resp.StatusCode, string(body))
+		}
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/v2" + repoPath + "/manifests/v9")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("unexpected status, expected %d, received %d", http.StatusTooManyRequests, resp.StatusCode)
+		}
+	})
+}
@@ -201,6 +201,91 @@ func (o *MemFS) Remove(name string) error {
 	}
 }
 
+func (o *MemFS) Rename(oldName, newName string) error {
+	oldDir, oldFile := path.Split(oldName)
+	oldMemDir, err := o.getDir(oldDir)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: oldName,
+			Err:  err,
+		}
+	}
+	child, ok := oldMemDir.child[oldFile]
+	if !ok || oldFile == "" || oldFile == "." {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: oldName,
+			Err:  fs.ErrNotExist,
+		}
+	}
+	newDir, newFile := path.Split(newName)
+	newMemDir, err := o.getDir(newDir)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: newName,
+			Err:  err,
+		}
+	}
+	if newFile == "" || newFile == "." {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: newName,
+			Err:  fs.ErrInvalid,
+		}
+	}
+	if _, ok := newMemDir.child[newFile].(*MemDir); ok {
+		return &fs.PathError{
+			Op:   "rename",
+			Path: newName,
+			Err:  fs.ErrExist,
+		}
+	}
+	delete(oldMemDir.child, oldFile)
+	newMemDir.child[newFile] = child
+	oldMemDir.mod = time.Now()
+	newMemDir.mod = time.Now()
+	return nil
+}
+
+func (o *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	dir, file := path.Split(name)
+	memDir, err := o.getDir(dir)
+	if err != nil {
+		return &fs.PathError{
+			Op:   "chtimes",
+			Path: name,
+			Err:  err,
+		}
+	}
+	var child MemChild = memDir
+	if file != "" && file != "." {
+		var ok bool
+		child, ok = memDir.child[file]
+		if !ok {
+			return &fs.PathError{
+				Op:   "chtimes",
+				Path: name,
+				Err:  fs.ErrNotExist,
+			}
+		}
+	}
+	switch v := child.(type) {
+	case *MemFile:
+		v.mod = mtime
+	case *MemDir:
+		v.mod = mtime
+	default:
+		return &fs.PathError{
+			Op:   "chtimes",
+			Path: name,
+			Err:  fs.ErrInvalid,
+		}
+	}
+	return nil
+}
+
 func (o *MemFS) Sub(name string) (*MemFS, error) {
 	if name == "." {
 		return o, nil
@@ -268,7 +353,7 @@ func (mfp *MemFileFP) Read(b []byte) (int, error) {
 }
 
 func (mfp *MemFileFP) Stat() (fs.FileInfo, error) {
-	fi := NewFI(mfp.name, int64(len(mfp.f.b)), time.Time{}, 0)
+	fi := NewFI(mfp.name, int64(len(mfp.f.b)), mfp.f.mod, 0)
 	return fi, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"time"
 )
 
 // RWFS implemented for the os filesystem
@@ -96,6 +97,26 @@ func (o *OSFS) Remove(name string) error {
 	return os.Remove(full)
 }
 
+func (o *OSFS) Rename(oldName, newName string) error {
+	oldFull, err := o.join("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newFull, err := o.join("rename", newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldFull, newFull)
+}
+
+func (o *OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	full, err := o.join("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(full, atime, mtime)
+}
+
 func (o *OSFS) Sub(name string) (*OSFS, error) {
 	if name == "." {
 		return o, nil
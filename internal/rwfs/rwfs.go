@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 //lint:file-ignore ST1003 names are uppercase to remain compatible with os names
@@ -44,6 +45,18 @@ type WriteFS interface {
 	Remove(string) error
 }
 
+// RenameFS is implemented by filesystems that can rename a file in a single operation
+type RenameFS interface {
+	// Rename moves a file to a new name, replacing any existing file
+	Rename(oldName, newName string) error
+}
+
+// ChtimesFS is implemented by filesystems that can change the modified time of a file
+type ChtimesFS interface {
+	// Chtimes changes the access and modified time of a file
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
 type WFile interface {
 	// Close closes the open file
 	Close() error
@@ -149,7 +162,30 @@ func MkdirAll(rwfs RWFS, name string, perm fs.FileMode) error {
 	return nil
 }
 
-// TODO: add Rename func
+// Rename moves a file to a new name.
+// When the filesystem does not implement RenameFS, the file is copied and the original removed.
+func Rename(rwfs RWFS, oldName, newName string) error {
+	if rfs, ok := rwfs.(RenameFS); ok {
+		return rfs.Rename(oldName, newName)
+	}
+	if err := Copy(rwfs, oldName, rwfs, newName); err != nil {
+		return err
+	}
+	return rwfs.Remove(oldName)
+}
+
+// Chtimes changes the access and modified time of a file.
+// An error is returned when the filesystem does not implement ChtimesFS.
+func Chtimes(rwfs RWFS, name string, atime, mtime time.Time) error {
+	if cfs, ok := rwfs.(ChtimesFS); ok {
+		return cfs.Chtimes(name, atime, mtime)
+	}
+	return &fs.PathError{
+		Op:   "chtimes",
+		Path: name,
+		Err:  fs.ErrInvalid,
+	}
+}
 
 func Stat(rfs fs.FS, name string) (fs.FileInfo, error) {
 	fh, err := rfs.Open(name)
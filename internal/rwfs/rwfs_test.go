@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"path"
 	"testing"
+	"time"
 )
 
 func testRWFS(t *testing.T, rwfs RWFS) {
@@ -534,6 +535,56 @@ func testRWFS(t *testing.T, rwfs RWFS) {
 		}
 	})
 
+	t.Run("rename", func(t *testing.T) {
+		exOld := path.Join(exSubDir, "rename-old.txt")
+		exNew := path.Join(exNestedDir, "rename-new.txt")
+		exTxt := []byte("hello rename")
+		err := WriteFile(rwfs, exOld, exTxt, 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", exOld, err)
+		}
+		err = Rename(rwfs, exOld, exNew)
+		if err != nil {
+			t.Fatalf("failed to rename %s: %v", exOld, err)
+		}
+		if _, err := Stat(rwfs, exOld); err == nil {
+			t.Errorf("%s exists after rename", exOld)
+		}
+		b, err := ReadFile(rwfs, exNew)
+		if err != nil {
+			t.Errorf("failed to read %s: %v", exNew, err)
+		} else if !bytes.Equal(b, exTxt) {
+			t.Errorf("content mismatch %s, expected %s, received %s", exNew, exTxt, b)
+		}
+		err = Rename(rwfs, exOld, exNew)
+		if err == nil {
+			t.Errorf("rename of missing file succeeded")
+		}
+		err = rwfs.Remove(exNew)
+		if err != nil {
+			t.Errorf("failed deleting %s: %v", exNew, err)
+		}
+	})
+
+	t.Run("chtimes", func(t *testing.T) {
+		exTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		err := Chtimes(rwfs, exSubFile1, exTime, exTime)
+		if err != nil {
+			t.Fatalf("failed to chtimes %s: %v", exSubFile1, err)
+		}
+		fi, err := Stat(rwfs, exSubFile1)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", exSubFile1, err)
+		}
+		if !fi.ModTime().Equal(exTime) {
+			t.Errorf("modified time mismatch %s, expected %v, received %v", exSubFile1, exTime, fi.ModTime())
+		}
+		err = Chtimes(rwfs, path.Join(exSubDir, "missing"), exTime, exTime)
+		if err == nil {
+			t.Errorf("chtimes of missing file succeeded")
+		}
+	})
+
 	t.Run("remove", func(t *testing.T) {
 		err := rwfs.Remove(".")
 		if err == nil {
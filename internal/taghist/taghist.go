@@ -0,0 +1,203 @@
+// Package taghist records the digests observed for each tag in a journal file
+package taghist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/regclient/regclient/types/ref"
+)
+
+// Record is a digest observed for a tag between the first and last seen times
+type Record struct {
+	Digest    string    `json:"digest"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Journal is a JSON file with the history of each tag, indexed by repository and tag.
+// Observations are kept in memory until Save writes a temporary file and renames it over the original.
+// Save reads the file again and reapplies the new observations, so processes sharing a file do not
+// discard each other's changes, but two processes saving at the same moment may still lose an update.
+// When the filename is empty, the history is only kept in memory.
+type Journal struct {
+	mu       sync.Mutex
+	filename string
+	loaded   bool
+	pending  []observation // changes since the last save
+	data     map[string]map[string][]Record
+}
+
+type observation struct {
+	repo, tag, digest string
+	t                 time.Time
+}
+
+// New returns a journal backed by filename
+func New(filename string) *Journal {
+	return &Journal{
+		filename: filename,
+		data:     map[string]map[string][]Record{},
+	}
+}
+
+// Observe records the digest of a tag at time t.
+// The last seen time is updated when the digest matches the most recent record,
+// otherwise a new record is added.
+func (j *Journal) Observe(repo, tag, digest string, t time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.load(); err != nil {
+		return err
+	}
+	o := observation{repo: repo, tag: tag, digest: digest, t: t}
+	if o.apply(j.data) {
+		j.pending = append(j.pending, o)
+	}
+	return nil
+}
+
+// apply adds the observation to data, returning true when data is changed
+func (o observation) apply(data map[string]map[string][]Record) bool {
+	if _, ok := data[o.repo]; !ok {
+		data[o.repo] = map[string][]Record{}
+	}
+	records := data[o.repo][o.tag]
+	if l := len(records); l > 0 && records[l-1].Digest == o.digest {
+		if o.t.After(records[l-1].LastSeen) {
+			records[l-1].LastSeen = o.t
+			return true
+		}
+		return false
+	}
+	data[o.repo][o.tag] = append(records, Record{Digest: o.digest, FirstSeen: o.t, LastSeen: o.t})
+	return true
+}
+
+// History returns the records for a tag, oldest first
+func (j *Journal) History(repo, tag string) ([]Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	records := make([]Record, len(j.data[repo][tag]))
+	copy(records, j.data[repo][tag])
+	return records, nil
+}
+
+// Tags returns the sorted list of tags recorded for a repository
+func (j *Journal) Tags(repo string) ([]string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for tag := range j.data[repo] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Save writes any changes to the journal file, merging them with changes saved by other processes
+func (j *Journal) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.pending) == 0 || j.filename == "" {
+		return nil
+	}
+	data, err := j.read()
+	if err != nil {
+		return err
+	}
+	for _, o := range j.pending {
+		o.apply(data)
+	}
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.filename), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.filename), filepath.Base(j.filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), j.filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write tag history %s: %w", j.filename, err)
+	}
+	j.data = data
+	j.pending = nil
+	return nil
+}
+
+// At returns the record for the digest the tag pointed to at time t.
+// A digest is assumed to remain until the next digest is first seen.
+func At(records []Record, t time.Time) (Record, bool) {
+	for i := len(records) - 1; i >= 0; i-- {
+		if !records[i].FirstSeen.After(t) {
+			return records[i], true
+		}
+	}
+	return Record{}, false
+}
+
+// RepoName returns the repository name used to index a reference in the journal
+func RepoName(r ref.Ref) string {
+	r.Tag = ""
+	r.Digest = ""
+	return r.CommonName()
+}
+
+// load reads the file on first use, a missing file is an empty journal
+func (j *Journal) load() error {
+	if j.loaded || j.filename == "" {
+		return nil
+	}
+	data, err := j.read()
+	if err != nil {
+		return err
+	}
+	j.data = data
+	j.loaded = true
+	return nil
+}
+
+// read parses the journal file, a missing file is an empty journal
+func (j *Journal) read() (map[string]map[string][]Record, error) {
+	data := map[string]map[string][]Record{}
+	b, err := os.ReadFile(j.filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse tag history %s: %w", j.filename, err)
+		}
+	}
+	if data == nil {
+		data = map[string]map[string][]Record{}
+	}
+	return data, nil
+}
@@ -0,0 +1,156 @@
+package taghist
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history.json")
+	t0 := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := "registry.example.org/app"
+	j := New(filename)
+	observe := []struct {
+		tag    string
+		digest string
+		offset time.Duration
+	}{
+		{tag: "stable", digest: "sha256:aaaa", offset: 0},
+		{tag: "stable", digest: "sha256:aaaa", offset: time.Hour},
+		{tag: "edge", digest: "sha256:cccc", offset: time.Hour},
+		{tag: "stable", digest: "sha256:bbbb", offset: 2 * time.Hour},
+		{tag: "stable", digest: "sha256:bbbb", offset: 3 * time.Hour},
+		{tag: "stable", digest: "sha256:aaaa", offset: 4 * time.Hour},
+	}
+	for _, o := range observe {
+		if err := j.Observe(repo, o.tag, o.digest, t0.Add(o.offset)); err != nil {
+			t.Fatalf("failed to observe: %v", err)
+		}
+	}
+	if err := j.Save(); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	// reload from the file
+	j = New(filename)
+	tags, err := j.Tags(repo)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "edge" || tags[1] != "stable" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	records, err := j.History(repo, "stable")
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	expect := []Record{
+		{Digest: "sha256:aaaa", FirstSeen: t0, LastSeen: t0.Add(time.Hour)},
+		{Digest: "sha256:bbbb", FirstSeen: t0.Add(2 * time.Hour), LastSeen: t0.Add(3 * time.Hour)},
+		{Digest: "sha256:aaaa", FirstSeen: t0.Add(4 * time.Hour), LastSeen: t0.Add(4 * time.Hour)},
+	}
+	if len(records) != len(expect) {
+		t.Fatalf("unexpected history, expected %v, received %v", expect, records)
+	}
+	for i := range expect {
+		if records[i].Digest != expect[i].Digest || !records[i].FirstSeen.Equal(expect[i].FirstSeen) || !records[i].LastSeen.Equal(expect[i].LastSeen) {
+			t.Errorf("unexpected record %d, expected %v, received %v", i, expect[i], records[i])
+		}
+	}
+	missing, err := j.History(repo, "missing")
+	if err != nil || len(missing) != 0 {
+		t.Errorf("unexpected history for missing tag: %v, %v", missing, err)
+	}
+
+	tests := []struct {
+		name      string
+		at        time.Time
+		expOK     bool
+		expDigest string
+	}{
+		{
+			name:  "before",
+			at:    t0.Add(-time.Minute),
+			expOK: false,
+		},
+		{
+			name:      "first",
+			at:        t0.Add(30 * time.Minute),
+			expOK:     true,
+			expDigest: "sha256:aaaa",
+		},
+		{
+			name:      "between",
+			at:        t0.Add(90 * time.Minute),
+			expOK:     true,
+			expDigest: "sha256:aaaa",
+		},
+		{
+			name:      "second",
+			at:        t0.Add(2 * time.Hour),
+			expOK:     true,
+			expDigest: "sha256:bbbb",
+		},
+		{
+			name:      "latest",
+			at:        t0.Add(24 * time.Hour),
+			expOK:     true,
+			expDigest: "sha256:aaaa",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, ok := At(records, tt.at)
+			if ok != tt.expOK {
+				t.Fatalf("unexpected ok, expected %t, received %t", tt.expOK, ok)
+			}
+			if rec.Digest != tt.expDigest {
+				t.Errorf("unexpected digest, expected %s, received %s", tt.expDigest, rec.Digest)
+			}
+		})
+	}
+}
+
+func TestJournalMerge(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history.json")
+	t0 := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := "registry.example.org/app"
+	// two writers load the journal before either saves
+	j1 := New(filename)
+	j2 := New(filename)
+	if err := j1.Observe(repo, "v1", "sha256:aaaa", t0); err != nil {
+		t.Fatalf("failed to observe: %v", err)
+	}
+	if err := j2.Observe(repo, "v2", "sha256:bbbb", t0.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to observe: %v", err)
+	}
+	if err := j1.Save(); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := j2.Save(); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	// the second writer merges the first writer's changes
+	tags, err := j2.Tags(repo)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Errorf("unexpected tags after save: %v", tags)
+	}
+	j := New(filename)
+	tags, err = j.Tags(repo)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "v1" || tags[1] != "v2" {
+		t.Errorf("unexpected tags in file: %v", tags)
+	}
+	// saving without changes does not overwrite the file
+	if err := j1.Observe(repo, "v1", "sha256:aaaa", t0); err != nil {
+		t.Fatalf("failed to observe: %v", err)
+	}
+	if len(j1.pending) != 0 {
+		t.Errorf("unchanged observation is pending: %v", j1.pending)
+	}
+}
@@ -0,0 +1,235 @@
+// Package tagwalk lists the tags in a repository or registry for copying every image
+package tagwalk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types/ref"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+)
+
+// DigestTagRegex matches digest tags ("<alg>-<hex>.*") used by artifact tools to reference an image.
+// These can be added to the Filter.Deny list when digest tags are copied with each image.
+const DigestTagRegex = `[a-z0-9]+-[a-f0-9]{32,}(\..*)?`
+
+// Filter is an allow and deny list of tag regex strings.
+// Each regex is bound to the beginning and ending of the tag (^ and $).
+type Filter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Apply returns the tags from the input that are allowed and not denied, in the original order.
+// When the allow list is empty, every tag is allowed.
+func (f Filter) Apply(in []string) ([]string, error) {
+	var result []string
+	// apply allow list
+	if len(f.Allow) > 0 {
+		result = make([]string, len(in))
+		for _, filter := range f.Allow {
+			exp, err := regexp.Compile("^" + filter + "$")
+			if err != nil {
+				return result, err
+			}
+			for i := range in {
+				if result[i] == "" && exp.MatchString(in[i]) {
+					result[i] = in[i]
+				}
+			}
+		}
+	} else {
+		// by default, everything is allowed
+		result = make([]string, len(in))
+		copy(result, in)
+	}
+
+	// apply deny list
+	for _, filter := range f.Deny {
+		exp, err := regexp.Compile("^" + filter + "$")
+		if err != nil {
+			return result, err
+		}
+		for i := range result {
+			if result[i] != "" && exp.MatchString(result[i]) {
+				result[i] = ""
+			}
+		}
+	}
+
+	// compress result list, removing empty elements
+	var compressed = make([]string, 0, len(in))
+	for i := range result {
+		if result[i] != "" {
+			compressed = append(compressed, result[i])
+		}
+	}
+	return compressed, nil
+}
+
+// Func is called with the source and target reference of each tag.
+type Func func(ctx context.Context, src, tgt ref.Ref) error
+
+// Walker lists the tags to process from a source repository or registry.
+type Walker struct {
+	RC       *regclient.RegClient
+	Log      *logrus.Logger
+	Filter   Filter
+	Parallel int // number of concurrent calls to Func, defaults to 1
+}
+
+// Registry calls fn for every filtered tag in every repository of the source registry.
+// Errors listing the tags of a repository or processing a tag are logged and the walk continues,
+// the last error is returned.
+func (w Walker) Registry(ctx context.Context, src, tgt string, fn Func) error {
+	log := w.logger()
+	sRepos, err := w.RC.RepoList(ctx, src)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src,
+			"error":  err,
+		}).Error("Failed to list source repositories")
+		return err
+	}
+	sRepoList, err := sRepos.GetRepos()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src,
+			"error":  err,
+		}).Error("Failed to list source repositories")
+		return err
+	}
+	var retErr error
+	for _, repo := range sRepoList {
+		sRepoRef, err := ref.New(fmt.Sprintf("%s/%s", src, repo))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"source": src,
+				"repo":   repo,
+				"error":  err,
+			}).Error("Failed to define source reference")
+			return err
+		}
+		tRepoRef, err := ref.New(fmt.Sprintf("%s/%s", tgt, repo))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"target": tgt,
+				"repo":   repo,
+				"error":  err,
+			}).Error("Failed parsing target")
+			return err
+		}
+		// repositories without matching tags are common when walking a registry
+		err = w.repo(ctx, sRepoRef, tRepoRef, fn, logrus.InfoLevel)
+		if err != nil {
+			retErr = err
+		}
+	}
+	return retErr
+}
+
+// Repo calls fn for every filtered tag in the source repository.
+// Errors processing a tag are logged and the walk continues, the last error is returned.
+func (w Walker) Repo(ctx context.Context, src, tgt ref.Ref, fn Func) error {
+	return w.repo(ctx, src, tgt, fn, logrus.WarnLevel)
+}
+
+// repo walks the tags of a repository, logging at noMatchLevel when the filter excludes every tag
+func (w Walker) repo(ctx context.Context, src, tgt ref.Ref, fn Func, noMatchLevel logrus.Level) error {
+	log := w.logger()
+	sTags, err := w.RC.TagList(ctx, src)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"error":  err,
+		}).Error("Failed getting source tags")
+		return err
+	}
+	sTagsList, err := sTags.GetTags()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"error":  err,
+		}).Error("Failed getting source tags")
+		return err
+	}
+	sTagList, err := w.Filter.Apply(sTagsList)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"source": src.CommonName(),
+			"allow":  w.Filter.Allow,
+			"deny":   w.Filter.Deny,
+			"error":  err,
+		}).Error("Failed processing tag filters")
+		return err
+	}
+	if len(sTagList) == 0 {
+		log.WithFields(logrus.Fields{
+			"source":    src.CommonName(),
+			"allow":     w.Filter.Allow,
+			"deny":      w.Filter.Deny,
+			"available": sTagsList,
+		}).Log(noMatchLevel, "No matching tags found")
+		return nil
+	}
+
+	parallel := int64(w.Parallel)
+	if parallel <= 0 {
+		parallel = 1
+	}
+	sem := semaphore.NewWeighted(parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var retErr error
+	for _, tag := range sTagList {
+		sRef := src
+		sRef.Tag = tag
+		sRef.Digest = ""
+		tRef := tgt
+		tRef.Tag = tag
+		tRef.Digest = ""
+		if err := sem.Acquire(ctx, 1); err != nil {
+			mu.Lock()
+			retErr = err
+			mu.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			err := fn(ctx, sRef, tRef)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"target": tRef.CommonName(),
+					"source": sRef.CommonName(),
+					"error":  err,
+				}).Error("Failed to sync")
+				mu.Lock()
+				retErr = err
+				mu.Unlock()
+			}
+			err = w.RC.Close(ctx, tRef)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"ref":   tRef.CommonName(),
+					"error": err,
+				}).Error("Error closing ref")
+			}
+		}()
+	}
+	wg.Wait()
+	return retErr
+}
+
+func (w Walker) logger() *logrus.Logger {
+	if w.Log != nil {
+		return w.Log
+	}
+	return &logrus.Logger{Out: io.Discard}
+}
@@ -0,0 +1,168 @@
+package tagwalk
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/types/ref"
+)
+
+func TestFilter(t *testing.T) {
+	in := []string{"latest", "v1", "v1.2", "v2", "edge", "sha256-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.sig"}
+	tests := []struct {
+		name   string
+		filter Filter
+		expect []string
+		expErr bool
+	}{
+		{
+			name:   "empty",
+			filter: Filter{},
+			expect: in,
+		},
+		{
+			name:   "allow",
+			filter: Filter{Allow: []string{"v\\d+", "latest"}},
+			expect: []string{"latest", "v1", "v2"},
+		},
+		{
+			name:   "deny",
+			filter: Filter{Deny: []string{DigestTagRegex, "edge"}},
+			expect: []string{"latest", "v1", "v1.2", "v2"},
+		},
+		{
+			name:   "allow and deny",
+			filter: Filter{Allow: []string{"v.*"}, Deny: []string{"v1.*"}},
+			expect: []string{"v2"},
+		},
+		{
+			name:   "invalid regex",
+			filter: Filter{Allow: []string{"v[1"}},
+			expErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.filter.Apply(in)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("filter did not fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filter failed: %v", err)
+			}
+			if !stringSliceEq(result, tt.expect) {
+				t.Errorf("unexpected result, expected %v, received %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	rSrc, err := ref.New("ocidir://testrepo")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	rTgt, err := ref.New("ocidir://testwalk")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	errFail := errors.New("failed")
+	digestTag := "sha256-df7cc4bb1d8cdda233b801fab62160181dc52d0484c42d6fca1439db5e33f95c.35ed41cad670c274.meta"
+	tests := []struct {
+		name   string
+		walker Walker
+		fail   string
+		expect []string
+		expErr error
+	}{
+		{
+			name:   "all",
+			walker: Walker{RC: rc},
+			expect: []string{digestTag, "v1", "v2", "v3"},
+		},
+		{
+			name:   "skip digest tags",
+			walker: Walker{RC: rc, Filter: Filter{Deny: []string{DigestTagRegex}}},
+			expect: []string{"v1", "v2", "v3"},
+		},
+		{
+			name:   "filtered",
+			walker: Walker{RC: rc, Filter: Filter{Allow: []string{"v.*"}, Deny: []string{"v2"}}},
+			expect: []string{"v1", "v3"},
+		},
+		{
+			name:   "no match",
+			walker: Walker{RC: rc, Filter: Filter{Allow: []string{"missing"}}},
+			expect: []string{},
+		},
+		{
+			name:   "parallel",
+			walker: Walker{RC: rc, Parallel: 3},
+			expect: []string{digestTag, "v1", "v2", "v3"},
+		},
+		{
+			name:   "failure continues",
+			walker: Walker{RC: rc, Parallel: 2},
+			fail:   "v2",
+			expect: []string{digestTag, "v1", "v2", "v3"},
+			expErr: errFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := []string{}
+			err := tt.walker.Repo(ctx, rSrc, rTgt, func(ctx context.Context, src, tgt ref.Ref) error {
+				if src.Repository != rSrc.Repository || tgt.Repository != rTgt.Repository || src.Tag != tgt.Tag {
+					t.Errorf("unexpected refs, src %s, tgt %s", src.CommonName(), tgt.CommonName())
+				}
+				mu.Lock()
+				seen = append(seen, src.Tag)
+				mu.Unlock()
+				if src.Tag == tt.fail {
+					return errFail
+				}
+				return nil
+			})
+			if tt.expErr != nil {
+				if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("walk failed: %v", err)
+			}
+			sort.Strings(seen)
+			if !stringSliceEq(seen, tt.expect) {
+				t.Errorf("unexpected tags, expected %v, received %v", tt.expect, seen)
+			}
+		})
+	}
+}
+
+func stringSliceEq(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -36,6 +36,7 @@ func (rc *RegClient) ManifestDelete(ctx context.Context, r ref.Ref) error {
 }
 
 // ManifestGet retrieves a manifest
+// With WithBlobCache, manifests requested by digest are read from and added to the cache.
 func (rc *RegClient) ManifestGet(ctx context.Context, r ref.Ref, opts ...ManifestOpts) (manifest.Manifest, error) {
 	opt := manifestOpt{}
 	for _, fn := range opts {
@@ -52,11 +53,19 @@ func (rc *RegClient) ManifestGet(ctx context.Context, r ref.Ref, opts ...Manifes
 			)
 		}
 	}
+	if m := rc.cacheManifestGet(r); m != nil {
+		return m, nil
+	}
 	schemeAPI, err := rc.schemeGet(r.Scheme)
 	if err != nil {
 		return nil, err
 	}
-	return schemeAPI.ManifestGet(ctx, r)
+	m, err := schemeAPI.ManifestGet(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	rc.cacheManifestPut(r, m)
+	return m, nil
 }
 
 // ManifestHead queries for the existence of a manifest and returns metadata (digest, media-type, size)
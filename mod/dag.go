@@ -34,11 +34,14 @@ type dagConfig struct {
 	stepsLayer     []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer) error
 	stepsLayerFile []func(context.Context, *regclient.RegClient, ref.Ref, *dagLayer, *tar.Header, *tar.Reader) (*tar.Header, *tar.Reader, changes, error)
 	maxDataSize    int64
+	m              manifest.Manifest // starting manifest, pulled from the ref when nil
+	err            error             // invalid options are reported by Apply before any changes
 }
 
 type dagManifest struct {
 	mod       changes
-	top       bool // indicates the top level manifest (needed for manifest lists)
+	top       bool             // indicates the top level manifest (needed for manifest lists)
+	desc      types.Descriptor // descriptor from the parent index, includes the platform
 	newDesc   types.Descriptor
 	m         manifest.Manifest
 	config    *dagOCIConfig
@@ -65,11 +68,16 @@ func dagGet(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Des
 	if d.Digest != "" {
 		getOpts = append(getOpts, regclient.ManifestWithDesc(d))
 	}
-	dm := dagManifest{}
-	dm.m, err = rc.ManifestGet(ctx, r, getOpts...)
+	m, err := rc.ManifestGet(ctx, r, getOpts...)
 	if err != nil {
 		return nil, err
 	}
+	return dagNew(ctx, rc, r, d, m)
+}
+
+// dagNew creates the dag from a manifest, pulling any child manifests and the config from the repository
+func dagNew(ctx context.Context, rc *regclient.RegClient, r ref.Ref, d types.Descriptor, m manifest.Manifest) (*dagManifest, error) {
+	dm := dagManifest{desc: d, m: m}
 	if dm.m.IsList() {
 		dl, err := dm.m.GetManifestList()
 		if err != nil {
@@ -155,7 +163,8 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 			}
 			// update the descriptor list
 			if child.mod == added {
-				// TODO: need to set the platform and any annotations
+				d.Platform = child.desc.Platform
+				d.Annotations = child.desc.Annotations
 				if len(ociI.Manifests) == i {
 					ociI.Manifests = append(ociI.Manifests, d)
 				} else {
@@ -302,7 +311,6 @@ func dagPut(ctx context.Context, rc *regclient.RegClient, mc dagConfig, r ref.Re
 				if err != nil {
 					return err
 				}
-				ociM.Config.MediaType = dm.config.newDesc.MediaType
 				ociM.Config.Digest = dm.config.newDesc.Digest
 				ociM.Config.Size = dm.config.newDesc.Size
 				changed = true
@@ -0,0 +1,175 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/regclient/regclient"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+)
+
+// IndexAddCopy copies the image used by WithIndexAdd into the repository of r.
+// This must be run before Apply when the image to add is in a different repository.
+func IndexAddCopy(ctx context.Context, rc *regclient.RegClient, r, rAdd ref.Ref) error {
+	mAdd, err := rc.ManifestGet(ctx, rAdd)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", rAdd.CommonName(), err)
+	}
+	rTgt := r
+	rTgt.Tag = ""
+	rTgt.Digest = mAdd.GetDescriptor().Digest.String()
+	err = rc.ImageCopy(ctx, rAdd, rTgt)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", rAdd.CommonName(), err)
+	}
+	return nil
+}
+
+// WithIndexAdd adds the manifests from another image to the index.
+// When the source is an index, each of its child manifests is added.
+// Existing entries with a matching platform are replaced.
+// The manifests must already exist in the repository being modified, see IndexAddCopy.
+func WithIndexAdd(rAdd ref.Ref) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if !dm.top || dm.mod == deleted {
+				return nil
+			}
+			if !dm.m.IsList() {
+				return fmt.Errorf("index add requires an index: %s", r.CommonName())
+			}
+			mAdd, err := rc.ManifestGet(ctx, rAdd)
+			if err != nil {
+				return fmt.Errorf("failed to get %s: %w", rAdd.CommonName(), err)
+			}
+			descList := []types.Descriptor{}
+			if mAdd.IsList() {
+				descList, err = mAdd.GetManifestList()
+				if err != nil {
+					return err
+				}
+			} else {
+				descList = append(descList, mAdd.GetDescriptor())
+			}
+			for _, d := range descList {
+				rTgt := r
+				rTgt.Tag = ""
+				rTgt.Digest = d.Digest.String()
+				dmAdd, err := dagGet(ctx, rc, rTgt, d)
+				if err != nil {
+					return fmt.Errorf("failed to get %s, the image must be copied to the repository first: %w", rTgt.CommonName(), err)
+				}
+				if dmAdd.desc.Platform == nil {
+					dmAdd.desc.Platform = dagManifestPlatform(dmAdd)
+				}
+				dmAdd.mod = added
+				dmAdd.newDesc = dmAdd.m.GetDescriptor()
+				// replace any existing entries for the same digest or platform
+				for i := len(dm.manifests) - 1; i >= 0; i-- {
+					child := dm.manifests[i]
+					if child.mod == deleted {
+						continue
+					}
+					p := dagManifestPlatform(child)
+					if child.m.GetDescriptor().Digest != d.Digest &&
+						(p == nil || dmAdd.desc.Platform == nil || !platform.Match(*p, *dmAdd.desc.Platform)) {
+						continue
+					}
+					dagManifestRm(dm, i)
+				}
+				dm.manifests = append(dm.manifests, dmAdd)
+			}
+			return nil
+		})
+	}
+}
+
+// WithPlatformKeep removes all platforms from an index that are not in the list.
+// Entries in the index without a platform are also removed.
+func WithPlatformKeep(pl []platform.Platform) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted || !dm.m.IsList() {
+				return nil
+			}
+			return dagManifestFilter(dm, func(p *platform.Platform) bool {
+				if p == nil {
+					return false
+				}
+				for _, pKeep := range pl {
+					if platform.Match(*p, pKeep) {
+						return true
+					}
+				}
+				return false
+			})
+		})
+	}
+}
+
+// WithPlatformRemove removes a platform from an index.
+func WithPlatformRemove(p platform.Platform) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(ctx context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted || !dm.m.IsList() {
+				return nil
+			}
+			return dagManifestFilter(dm, func(pCur *platform.Platform) bool {
+				return pCur == nil || !platform.Match(*pCur, p)
+			})
+		})
+	}
+}
+
+// dagManifestFilter removes child manifests when keep returns false for their platform
+func dagManifestFilter(dm *dagManifest, keep func(*platform.Platform) bool) error {
+	remain := 0
+	for i := len(dm.manifests) - 1; i >= 0; i-- {
+		child := dm.manifests[i]
+		if child.mod == deleted {
+			continue
+		}
+		if keep(dagManifestPlatform(child)) {
+			remain++
+			continue
+		}
+		dagManifestRm(dm, i)
+	}
+	if remain == 0 {
+		return fmt.Errorf("platform filter would remove all manifests from the index")
+	}
+	return nil
+}
+
+// dagManifestRm removes a child manifest from an index
+func dagManifestRm(dm *dagManifest, i int) {
+	if dm.manifests[i].mod == added {
+		// added entries are not in the original index, drop them from the dag
+		dm.manifests = append(dm.manifests[:i], dm.manifests[i+1:]...)
+		return
+	}
+	dm.manifests[i].mod = deleted
+}
+
+// dagManifestPlatform returns the platform of a manifest, using the config when not set in the index
+func dagManifestPlatform(dm *dagManifest) *platform.Platform {
+	if dm.desc.Platform != nil {
+		return dm.desc.Platform
+	}
+	if dm.config == nil || dm.config.oc == nil {
+		return nil
+	}
+	oc := dm.config.oc.GetConfig()
+	if oc.OS == "" {
+		return nil
+	}
+	return &platform.Platform{
+		OS:           oc.OS,
+		Architecture: oc.Architecture,
+		Variant:      oc.Variant,
+		OSVersion:    oc.OSVersion,
+		OSFeatures:   oc.OSFeatures,
+	}
+}
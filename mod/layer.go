@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"context"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -12,6 +13,100 @@ import (
 	"github.com/regclient/regclient/types/ref"
 )
 
+const whiteoutPrefix = ".wh."
+
+// WithLayerFileFilter removes files from every layer when fn returns false.
+// Whiteout entries are not passed to fn, removing them would restore files from lower layers.
+// Layers compressed with zstd cannot be decompressed, and return an error from Apply.
+func WithLayerFileFilter(fn func(*tar.Header) bool) Opts {
+	return func(dc *dagConfig) {
+		dc.stepsLayerFile = append(dc.stepsLayerFile, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dl *dagLayer, th *tar.Header, tr *tar.Reader) (*tar.Header, *tar.Reader, changes, error) {
+			if strings.HasPrefix(path.Base(th.Name), whiteoutPrefix) {
+				return th, tr, unchanged, nil
+			}
+			if !fn(th) {
+				return th, tr, deleted, nil
+			}
+			return th, tr, unchanged, nil
+		})
+	}
+}
+
+// WithLayerFileRemove removes files matching a glob pattern from every layer.
+// Patterns are matched from the root of the filesystem,
+// "*" and "?" match within a single path segment, and "**" matches any number of segments.
+// Matching a directory also removes the contents of that directory.
+// An invalid pattern is returned as an error from Apply.
+func WithLayerFileRemove(pattern string) Opts {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return func(dc *dagConfig) {
+			if dc.err == nil {
+				dc.err = err
+			}
+		}
+	}
+	return WithLayerFileFilter(func(th *tar.Header) bool {
+		for name := layerFileName(th.Name); name != "" && name != "."; name = path.Dir(name) {
+			if re.MatchString(name) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// globToRegexp converts a glob pattern to an anchored regexp
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.Trim(pattern, "/")
+	reStr := strings.Builder{}
+	reStr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					reStr.WriteString("(.*/)?")
+				} else {
+					reStr.WriteString(".*")
+				}
+			} else {
+				reStr.WriteString("[^/]*")
+			}
+		case '?':
+			reStr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in pattern: %s", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			reStr.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			reStr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			reStr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	reStr.WriteString("$")
+	re, err := regexp.Compile(reStr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	return re, nil
+}
+
 // WithLayerRmCreatedBy deletes a layer based on a regex of the created by field
 // in the config history for that layer
 func WithLayerRmCreatedBy(re regexp.Regexp) Opts {
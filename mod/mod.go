@@ -5,14 +5,18 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/pkg/archive"
 	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/docker/schema2"
 	"github.com/regclient/regclient/types/manifest"
 	"github.com/regclient/regclient/types/ref"
 )
@@ -44,9 +48,27 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	for _, opt := range opts {
 		opt(&dc)
 	}
+	if dc.err != nil {
+		return rMod, dc.err
+	}
 
 	// pull the image metadata into a DAG
-	dm, err := dagGet(ctx, rc, r, types.Descriptor{})
+	var dm *dagManifest
+	var err error
+	if dc.m != nil {
+		// copy the manifest since changes are made in place
+		var raw []byte
+		var m manifest.Manifest
+		raw, err = dc.m.RawBody()
+		if err == nil {
+			m, err = manifest.New(manifest.WithDesc(dc.m.GetDescriptor()), manifest.WithRaw(raw))
+		}
+		if err == nil {
+			dm, err = dagNew(ctx, rc, r, types.Descriptor{}, m)
+		}
+	} else {
+		dm, err = dagGet(ctx, rc, r, types.Descriptor{})
+	}
 	if err != nil {
 		return rMod, err
 	}
@@ -98,9 +120,23 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 					return nil, err
 				}
 			}
+			switch dl.desc.MediaType {
+			case types.MediaTypeOCI1LayerZstd, types.MediaTypeOCI1ForeignLayerZstd:
+				// zstd layers cannot be decompressed, so file steps cannot be applied
+				if len(dc.stepsLayerFile) > 0 && dl.mod != deleted {
+					return nil, fmt.Errorf("zstd compressed layers cannot be modified, layer %s: %w", dl.desc.Digest, types.ErrUnsupported)
+				}
+				return dl, nil
+			}
 			if len(dc.stepsLayerFile) > 0 && dl.mod != deleted {
 				changed := false
 				empty := true
+				recompress := false
+				switch dl.desc.MediaType {
+				case types.MediaTypeDocker2LayerGzip, types.MediaTypeOCI1LayerGzip,
+					types.MediaTypeDocker2ForeignLayer, types.MediaTypeOCI1ForeignLayerGzip:
+					recompress = true
+				}
 				// setup tar reader to process layer
 				dr, err := archive.Decompress(br)
 				if err != nil {
@@ -119,7 +155,7 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 				var gw *gzip.Writer
 				digRaw := digest.Canonical.Digester() // raw/compressed digest
 				digUC := digest.Canonical.Digester()  // uncompressed digest
-				if dl.desc.MediaType == types.MediaTypeDocker2LayerGzip || dl.desc.MediaType == types.MediaTypeOCI1LayerGzip {
+				if recompress {
 					cw := io.MultiWriter(fh, digRaw.Hash())
 					gw = gzip.NewWriter(cw)
 					defer gw.Close()
@@ -129,6 +165,16 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 					dw := io.MultiWriter(fh, digRaw.Hash(), digUC.Hash())
 					tw = tar.NewWriter(dw)
 				}
+				// deleted files are saved in case a hardlink to them is kept
+				rmFiles := map[string]layerRmFile{}
+				rmLinks := map[string]string{}
+				var rmSpool *os.File
+				defer func() {
+					if rmSpool != nil {
+						rmSpool.Close()
+						os.Remove(rmSpool.Name())
+					}
+				}()
 				// iterate over files in the layer
 				for {
 					th, err := tr.Next()
@@ -153,19 +199,58 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 							break
 						}
 					}
-					// copy th and tr to temp tar writer file
-					if changeFile != deleted {
-						empty = false
-						err = tw.WriteHeader(th)
+					if changeFile == deleted {
+						if th.Typeflag != tar.TypeReg {
+							continue
+						}
+						// save the header and content of deleted files for any hardlinks
+						if rmSpool == nil {
+							rmSpool, err = os.CreateTemp("", "regclient-mod-")
+							if err != nil {
+								return nil, err
+							}
+						}
+						offset, err := rmSpool.Seek(0, io.SeekEnd)
 						if err != nil {
 							return nil, err
 						}
-						if th.Typeflag == tar.TypeReg && th.Size > 0 {
-							_, err := io.CopyN(tw, tr, th.Size)
+						if th.Size > 0 {
+							_, err = io.CopyN(rmSpool, tr, th.Size)
 							if err != nil {
 								return nil, err
 							}
 						}
+						rmFiles[layerFileName(th.Name)] = layerRmFile{th: *th, offset: offset}
+						continue
+					}
+					var rdr io.Reader = tr
+					if th.Typeflag == tar.TypeLink {
+						target := layerFileName(th.Linkname)
+						if newTarget, ok := rmLinks[target]; ok {
+							// target was deleted, point to the first hardlink that was kept
+							th.Linkname = newTarget
+							changed = true
+						} else if rmFile, ok := rmFiles[target]; ok {
+							// target was deleted, replace the hardlink with the file content
+							thNew := rmFile.th
+							thNew.Name = th.Name
+							th = &thNew
+							rdr = io.NewSectionReader(rmSpool, rmFile.offset, th.Size)
+							rmLinks[target] = th.Name
+							changed = true
+						}
+					}
+					// copy th and tr to temp tar writer file
+					empty = false
+					err = tw.WriteHeader(th)
+					if err != nil {
+						return nil, err
+					}
+					if th.Typeflag == tar.TypeReg && th.Size > 0 {
+						_, err := io.CopyN(tw, rdr, th.Size)
+						if err != nil {
+							return nil, err
+						}
 					}
 				}
 				br.Close()
@@ -218,6 +303,16 @@ func Apply(ctx context.Context, rc *regclient.RegClient, r ref.Ref, opts ...Opts
 	return rMod, nil
 }
 
+type layerRmFile struct {
+	th     tar.Header
+	offset int64
+}
+
+// layerFileName normalizes the name of a file in a layer tar
+func layerFileName(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
 // WithData sets the descriptor data field max size.
 // This also strips the data field off descriptors above the max size.
 func WithData(maxDataSize int64) Opts {
@@ -226,34 +321,181 @@ func WithData(maxDataSize int64) Opts {
 	}
 }
 
+// WithManifest starts from the provided manifest instead of pulling the manifest for the reference.
+// This is used to create a new image in the repository of the reference without pushing the starting manifest.
+func WithManifest(m manifest.Manifest) Opts {
+	return func(dc *dagConfig) {
+		dc.m = m
+	}
+}
+
+// WithManifestToDocker converts the manifest to Docker schema2 media types
+func WithManifestToDocker() Opts {
+	return func(dc *dagConfig) {
+		dc.stepsManifest = append(dc.stepsManifest, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
+			if dm.mod == deleted {
+				return nil
+			}
+			mt := dm.m.GetDescriptor().MediaType
+			if dm.m.IsList() {
+				ociI, err := manifest.OCIIndexFromAny(dm.m.GetOrig())
+				if err != nil {
+					return err
+				}
+				if len(ociI.Annotations) > 0 {
+					return fmt.Errorf("annotations cannot be converted to a Docker manifest list: %s", r.CommonName())
+				}
+				if ociI.ArtifactType != "" {
+					return fmt.Errorf("artifactType %s cannot be converted to a Docker manifest list: %s", ociI.ArtifactType, r.CommonName())
+				}
+				for i, d := range ociI.Manifests {
+					if d.ArtifactType != "" {
+						return fmt.Errorf("artifactType %s cannot be converted to a Docker manifest list: %s", d.ArtifactType, d.Digest)
+					}
+					switch d.MediaType {
+					case types.MediaTypeOCI1Manifest:
+						ociI.Manifests[i].MediaType = types.MediaTypeDocker2Manifest
+					case types.MediaTypeOCI1ManifestList:
+						ociI.Manifests[i].MediaType = types.MediaTypeDocker2ManifestList
+					case types.MediaTypeDocker2Manifest, types.MediaTypeDocker2ManifestList:
+					default:
+						return fmt.Errorf("media type %s cannot be converted to a Docker manifest list: %s", d.MediaType, d.Digest)
+					}
+				}
+				if mt == types.MediaTypeDocker2ManifestList {
+					return nil
+				}
+				dm.m, err = manifest.New(manifest.WithOrig(schema2.ManifestList{
+					Versioned: schema2.ManifestListSchemaVersion,
+					Manifests: ociI.Manifests,
+				}))
+				if err != nil {
+					return err
+				}
+			} else {
+				ociM, err := manifest.OCIManifestFromAny(dm.m.GetOrig())
+				if err != nil {
+					return err
+				}
+				if len(ociM.Annotations) > 0 {
+					return fmt.Errorf("annotations cannot be converted to a Docker manifest: %s", r.CommonName())
+				}
+				if ociM.ArtifactType != "" {
+					return fmt.Errorf("artifactType %s cannot be converted to a Docker manifest: %s", ociM.ArtifactType, r.CommonName())
+				}
+				switch ociM.Config.MediaType {
+				case types.MediaTypeOCI1ImageConfig:
+					ociM.Config.MediaType = types.MediaTypeDocker2ImageConfig
+				case types.MediaTypeDocker2ImageConfig:
+				default:
+					return fmt.Errorf("config media type %s cannot be converted to a Docker manifest: %s", ociM.Config.MediaType, r.CommonName())
+				}
+				layerMT := map[string]string{}
+				for i, l := range ociM.Layers {
+					switch l.MediaType {
+					case types.MediaTypeOCI1LayerGzip:
+						ociM.Layers[i].MediaType = types.MediaTypeDocker2LayerGzip
+					case types.MediaTypeOCI1ForeignLayerGzip:
+						ociM.Layers[i].MediaType = types.MediaTypeDocker2ForeignLayer
+					case types.MediaTypeDocker2LayerGzip, types.MediaTypeDocker2ForeignLayer:
+					case types.MediaTypeOCI1LayerZstd, types.MediaTypeOCI1ForeignLayerZstd:
+						return fmt.Errorf("zstd compressed layers cannot be converted to a Docker manifest: %s", l.Digest)
+					default:
+						return fmt.Errorf("layer media type %s cannot be converted to a Docker manifest: %s", l.MediaType, l.Digest)
+					}
+					layerMT[l.MediaType] = ociM.Layers[i].MediaType
+				}
+				// update the dag so layer changes retain the new media type
+				for _, dl := range dm.layers {
+					if newMT, ok := layerMT[dl.desc.MediaType]; ok {
+						dl.desc.MediaType = newMT
+					}
+					if newMT, ok := layerMT[dl.newDesc.MediaType]; ok {
+						dl.newDesc.MediaType = newMT
+					}
+				}
+				if mt == types.MediaTypeDocker2Manifest {
+					return nil
+				}
+				dm.m, err = manifest.New(manifest.WithOrig(schema2.Manifest{
+					Versioned: schema2.ManifestSchemaVersion,
+					Config:    ociM.Config,
+					Layers:    ociM.Layers,
+				}))
+				if err != nil {
+					return err
+				}
+			}
+			dm.newDesc = dm.m.GetDescriptor()
+			dm.mod = replaced
+			return nil
+		})
+	}
+}
+
 // WithManifestToOCI converts the manifest to OCI media types
 func WithManifestToOCI() Opts {
 	return func(dc *dagConfig) {
 		dc.stepsManifest = append(dc.stepsManifest, func(c context.Context, rc *regclient.RegClient, r ref.Ref, dm *dagManifest) error {
-			switch dm.m.GetDescriptor().MediaType {
-			case types.MediaTypeOCI1Manifest, types.MediaTypeOCI1ManifestList:
+			if dm.mod == deleted {
 				return nil
 			}
-			om := dm.m.GetOrig()
+			mt := dm.m.GetDescriptor().MediaType
 			if dm.m.IsList() {
-				ociM, err := manifest.OCIIndexFromAny(om)
+				ociI, err := manifest.OCIIndexFromAny(dm.m.GetOrig())
+				if err != nil {
+					return err
+				}
+				for i, d := range ociI.Manifests {
+					switch d.MediaType {
+					case types.MediaTypeDocker2Manifest:
+						ociI.Manifests[i].MediaType = types.MediaTypeOCI1Manifest
+					case types.MediaTypeDocker2ManifestList:
+						ociI.Manifests[i].MediaType = types.MediaTypeOCI1ManifestList
+					}
+				}
+				if mt == types.MediaTypeOCI1ManifestList {
+					return nil
+				}
+				dm.m, err = manifest.New(manifest.WithOrig(ociI))
 				if err != nil {
 					return err
 				}
-				om = ociM
 			} else {
-				ociM, err := manifest.OCIManifestFromAny(om)
+				ociM, err := manifest.OCIManifestFromAny(dm.m.GetOrig())
 				if err != nil {
 					return err
 				}
+				if ociM.Config.MediaType == types.MediaTypeDocker2ImageConfig {
+					ociM.Config.MediaType = types.MediaTypeOCI1ImageConfig
+				}
+				layerMT := map[string]string{}
 				for i, l := range ociM.Layers {
-					if l.MediaType == types.MediaTypeDocker2LayerGzip {
+					switch l.MediaType {
+					case types.MediaTypeDocker2LayerGzip:
 						ociM.Layers[i].MediaType = types.MediaTypeOCI1LayerGzip
+					case types.MediaTypeDocker2ForeignLayer:
+						ociM.Layers[i].MediaType = types.MediaTypeOCI1ForeignLayerGzip
+					}
+					layerMT[l.MediaType] = ociM.Layers[i].MediaType
+				}
+				// update the dag so layer changes retain the new media type
+				for _, dl := range dm.layers {
+					if newMT, ok := layerMT[dl.desc.MediaType]; ok {
+						dl.desc.MediaType = newMT
 					}
+					if newMT, ok := layerMT[dl.newDesc.MediaType]; ok {
+						dl.newDesc.MediaType = newMT
+					}
+				}
+				if mt == types.MediaTypeOCI1Manifest {
+					return nil
+				}
+				dm.m, err = manifest.New(manifest.WithOrig(ociM))
+				if err != nil {
+					return err
 				}
-				om = ociM
 			}
-			dm.m.SetOrig(om)
 			dm.newDesc = dm.m.GetDescriptor()
 			dm.mod = replaced
 			return nil
@@ -1,16 +1,26 @@
 package mod
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/regclient/regclient"
 	"github.com/regclient/regclient/internal/rwfs"
+	"github.com/regclient/regclient/pkg/archive"
+	"github.com/regclient/regclient/types"
+	"github.com/regclient/regclient/types/manifest"
+	v1 "github.com/regclient/regclient/types/oci/v1"
 	"github.com/regclient/regclient/types/platform"
 	"github.com/regclient/regclient/types/ref"
 )
@@ -49,6 +59,14 @@ func TestMod(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to parse platform: %v", err)
 	}
+	pARM64, err := platform.Parse("linux/arm64")
+	if err != nil {
+		t.Errorf("failed to parse platform: %v", err)
+	}
+	pS390X, err := platform.Parse("linux/s390x")
+	if err != nil {
+		t.Errorf("failed to parse platform: %v", err)
+	}
 	m3DescAmd, err := m3.GetPlatformDesc(&pAMD)
 	if err != nil {
 		t.Errorf("failed to get amd64 descriptor: %v", err)
@@ -60,11 +78,14 @@ func TestMod(t *testing.T) {
 
 	// define tests
 	tests := []struct {
-		name     string
-		opts     []Opts
-		ref      string
-		wantErr  error
-		wantSame bool // if the resulting image should be unchanged
+		name          string
+		opts          []Opts
+		ref           string
+		wantErr       error
+		wantSame      bool              // if the resulting image should be unchanged
+		wantPlatforms []string          // platforms in the resulting index, in order
+		wantDigests   map[string]string // digest of the index entry for a platform
+		wantDocker    bool              // if the resulting manifests and configs should have Docker media types
 	}{
 		{
 			name: "To OCI",
@@ -74,6 +95,32 @@ func TestMod(t *testing.T) {
 			ref:      "ocidir://testrepo:v1",
 			wantSame: true,
 		},
+		{
+			name: "To Docker with annotations",
+			opts: []Opts{
+				WithManifestToDocker(),
+			},
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("annotations cannot be converted to a Docker manifest list: ocidir://testrepo:v1"),
+		},
+		{
+			name: "To Docker",
+			opts: []Opts{
+				WithAnnotation("org.example.version", ""),
+				WithManifestToDocker(),
+			},
+			ref:        "ocidir://testrepo:v3",
+			wantDocker: true,
+		},
+		{
+			name: "To Docker manifest",
+			opts: []Opts{
+				WithManifestToDocker(),
+				WithLayerTimestampMax(tTime),
+			},
+			ref:        r3amd.CommonName(),
+			wantDocker: true,
+		},
 		{
 			name: "Add Annotation",
 			opts: []Opts{
@@ -185,6 +232,46 @@ func TestMod(t *testing.T) {
 			},
 			ref: "ocidir://testrepo:v3",
 		},
+		{
+			name: "Layer File Remove",
+			opts: []Opts{
+				WithLayerFileRemove("/layer?"),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name: "Layer File Remove Unchanged",
+			opts: []Opts{
+				WithLayerFileRemove("**/*.pyc"),
+			},
+			ref:      "ocidir://testrepo:v3",
+			wantSame: true,
+		},
+		{
+			name: "Layer File Remove Invalid",
+			opts: []Opts{
+				WithLayerFileRemove("[layer"),
+			},
+			ref:     "ocidir://testrepo:v3",
+			wantErr: fmt.Errorf("unterminated character class in pattern: [layer"),
+		},
+		{
+			name: "Layer File Remove Invalid before pull",
+			opts: []Opts{
+				WithLayerFileRemove("[layer"),
+			},
+			ref:     "ocidir://testrepo:missing",
+			wantErr: fmt.Errorf("unterminated character class in pattern: [layer"),
+		},
+		{
+			name: "Layer File Filter",
+			opts: []Opts{
+				WithLayerFileFilter(func(th *tar.Header) bool {
+					return th.Name != "layer2"
+				}),
+			},
+			ref: "ocidir://testrepo:v3",
+		},
 		{
 			name: "Layer Trim By Created RE",
 			opts: []Opts{
@@ -215,6 +302,64 @@ func TestMod(t *testing.T) {
 			ref:     r3amd.CommonName(),
 			wantErr: fmt.Errorf("layer not found"),
 		},
+		{
+			name: "Platform remove",
+			opts: []Opts{
+				WithPlatformRemove(pAMD),
+			},
+			ref:           "ocidir://testrepo:v3",
+			wantPlatforms: []string{"linux/arm64", "linux/arm/v7", "linux/arm/v6"},
+		},
+		{
+			name: "Platform remove missing",
+			opts: []Opts{
+				WithPlatformRemove(pS390X),
+			},
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "Platform keep",
+			opts: []Opts{
+				WithPlatformKeep([]platform.Platform{pAMD, pARM64}),
+			},
+			ref:           "ocidir://testrepo:v3",
+			wantPlatforms: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name: "Platform keep all removed",
+			opts: []Opts{
+				WithPlatformKeep([]platform.Platform{pS390X}),
+			},
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("platform filter would remove all manifests from the index"),
+		},
+		{
+			name: "Index add",
+			opts: []Opts{
+				WithIndexAdd(r3amd),
+			},
+			ref:           "ocidir://testrepo:v1",
+			wantPlatforms: []string{"linux/arm64", "linux/amd64"},
+			wantDigests:   map[string]string{"linux/amd64": r3amd.Digest},
+		},
+		{
+			name: "Index add then remove",
+			opts: []Opts{
+				WithIndexAdd(r3amd),
+				WithPlatformRemove(pAMD),
+			},
+			ref:           "ocidir://testrepo:v1",
+			wantPlatforms: []string{"linux/arm64"},
+		},
+		{
+			name: "Index add to manifest",
+			opts: []Opts{
+				WithIndexAdd(r3amd),
+			},
+			ref:     r3amd.CommonName(),
+			wantErr: fmt.Errorf("index add requires an index: %s", r3amd.CommonName()),
+		},
 		{
 			name: "Add volume",
 			opts: []Opts{
@@ -307,6 +452,581 @@ func TestMod(t *testing.T) {
 					t.Errorf("digest did not change")
 				}
 			}
+			if tt.wantDocker {
+				err = testDockerMediaTypes(ctx, rc, rMod)
+				if err != nil {
+					t.Errorf("%v", err)
+				}
+			}
+			if tt.wantPlatforms == nil && tt.wantDigests == nil {
+				return
+			}
+			mMod, err := rc.ManifestGet(ctx, rMod)
+			if err != nil {
+				t.Fatalf("failed to get modified manifest: %v", err)
+			}
+			dl, err := mMod.GetManifestList()
+			if err != nil {
+				t.Fatalf("failed to get manifest list: %v", err)
+			}
+			pl := []string{}
+			for _, d := range dl {
+				if d.Platform == nil {
+					t.Errorf("missing platform on %s", d.Digest.String())
+					continue
+				}
+				pl = append(pl, d.Platform.String())
+				if expDig, ok := tt.wantDigests[d.Platform.String()]; ok && d.Digest.String() != expDig {
+					t.Errorf("unexpected digest for %s, expected %s, received %s", d.Platform.String(), expDig, d.Digest.String())
+				}
+			}
+			if tt.wantPlatforms != nil && strings.Join(pl, ",") != strings.Join(tt.wantPlatforms, ",") {
+				t.Errorf("unexpected platforms, expected %v, received %v", tt.wantPlatforms, pl)
+			}
+		})
+	}
+}
+
+// testDockerMediaTypes verifies a manifest, any child manifests, the config, and the layers use Docker media types
+func testDockerMediaTypes(ctx context.Context, rc *regclient.RegClient, r ref.Ref) error {
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", r.CommonName(), err)
+	}
+	mt := m.GetDescriptor().MediaType
+	if m.IsList() {
+		if mt != types.MediaTypeDocker2ManifestList {
+			return fmt.Errorf("unexpected media type for %s: %s", r.CommonName(), mt)
+		}
+		dl, err := m.GetManifestList()
+		if err != nil {
+			return err
+		}
+		for _, d := range dl {
+			if d.MediaType != types.MediaTypeDocker2Manifest {
+				return fmt.Errorf("unexpected media type for descriptor %s: %s", d.Digest.String(), d.MediaType)
+			}
+			rChild := r
+			rChild.Tag = ""
+			rChild.Digest = d.Digest.String()
+			err = testDockerMediaTypes(ctx, rc, rChild)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if mt != types.MediaTypeDocker2Manifest {
+		return fmt.Errorf("unexpected media type for %s: %s", r.CommonName(), mt)
+	}
+	cd, err := m.GetConfig()
+	if err != nil {
+		return err
+	}
+	if cd.MediaType != types.MediaTypeDocker2ImageConfig {
+		return fmt.Errorf("unexpected config media type for %s: %s", r.CommonName(), cd.MediaType)
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		return err
+	}
+	for _, l := range layers {
+		if l.MediaType != types.MediaTypeDocker2LayerGzip && l.MediaType != types.MediaTypeDocker2ForeignLayer {
+			return fmt.Errorf("unexpected layer media type for %s: %s", l.Digest.String(), l.MediaType)
+		}
+	}
+	return nil
+}
+
+func TestIndexAdd(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Fatalf("failed to setup memfs copy: %v", err)
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+	r3, err := ref.New("ocidir://testrepo:v3")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	m3, err := rc.ManifestGet(ctx, r3)
+	if err != nil {
+		t.Fatalf("failed to retrieve v3 ref: %v", err)
+	}
+	pAMD, err := platform.Parse("linux/amd64")
+	if err != nil {
+		t.Fatalf("failed to parse platform: %v", err)
+	}
+	dAMD, err := m3.GetPlatformDesc(&pAMD)
+	if err != nil {
+		t.Fatalf("failed to get amd64 descriptor: %v", err)
+	}
+	rAdd := r3
+	rAdd.Tag = ""
+	rAdd.Digest = dAMD.Digest.String()
+	rTgt, err := ref.New("ocidir://newrepo:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	mEmpty, err := manifest.New(manifest.WithOrig(v1.Index{
+		Versioned: v1.IndexSchemaVersion,
+		MediaType: types.MediaTypeOCI1ManifestList,
+		Manifests: []types.Descriptor{},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+
+	t.Run("missing copy", func(t *testing.T) {
+		_, err := Apply(ctx, rc, rTgt, WithManifest(mEmpty), WithIndexAdd(rAdd))
+		if err == nil {
+			t.Errorf("index add without a copy did not fail")
+		}
+	})
+	t.Run("copy and add", func(t *testing.T) {
+		err := IndexAddCopy(ctx, rc, rTgt, rAdd)
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		rMod, err := Apply(ctx, rc, rTgt, WithManifest(mEmpty), WithIndexAdd(rAdd))
+		if err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+		if rMod.Digest == "" || rMod.Tag != "" {
+			t.Errorf("unexpected ref returned: %s", rMod.CommonName())
+		}
+		mMod, err := rc.ManifestGet(ctx, rMod)
+		if err != nil {
+			t.Fatalf("failed to get modified index: %v", err)
+		}
+		dl, err := mMod.GetManifestList()
+		if err != nil {
+			t.Fatalf("failed to get manifest list: %v", err)
+		}
+		if len(dl) != 1 || dl[0].Digest != dAMD.Digest || dl[0].Platform == nil || dl[0].Platform.String() != "linux/amd64" {
+			t.Errorf("unexpected manifest list: %v", dl)
+		}
+		// the starting index is not pushed and the tag is not created
+		rEmpty := rTgt
+		rEmpty.Tag = ""
+		rEmpty.Digest = mEmpty.GetDescriptor().Digest.String()
+		if _, err := rc.ManifestHead(ctx, rEmpty); err == nil {
+			t.Errorf("empty index was pushed")
+		}
+		if _, err := rc.ManifestHead(ctx, rTgt); err == nil {
+			t.Errorf("target tag was pushed")
+		}
+	})
+}
+
+func TestLayerFiles(t *testing.T) {
+	ctx := context.Background()
+	rc := regclient.New(regclient.WithFS(rwfs.MemNew()))
+	r, err := ref.New("ocidir://testfiles:v1")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	testImagePush(ctx, t, rc, r, []testLayer{
+		{
+			mediaType: types.MediaTypeOCI1LayerGzip,
+			entries: []testTarEntry{
+				{name: "dir/", typeflag: tar.TypeDir},
+				{name: "dir/target", typeflag: tar.TypeReg, content: "hello"},
+				{name: "dir/link1", typeflag: tar.TypeLink, linkname: "dir/target"},
+				{name: "dir/link2", typeflag: tar.TypeLink, linkname: "dir/target"},
+				{name: "dir/.wh.removed", typeflag: tar.TypeReg},
+				{name: "opaque/", typeflag: tar.TypeDir},
+				{name: "opaque/.wh..wh..opq", typeflag: tar.TypeReg},
+			},
+		},
+	})
+	rZstd, err := ref.New("ocidir://testfiles:zstd")
+	if err != nil {
+		t.Fatalf("failed to parse ref: %v", err)
+	}
+	testImagePush(ctx, t, rc, rZstd, []testLayer{
+		{
+			mediaType: types.MediaTypeOCI1LayerZstd,
+			raw:       []byte("not a zstd layer"),
+		},
+	})
+
+	t.Run("hardlink and whiteout", func(t *testing.T) {
+		rMod, err := Apply(ctx, rc, r, WithLayerFileRemove("dir/target"), WithLayerFileRemove("**/removed"), WithLayerFileRemove("opaque/*"))
+		if err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+		if rMod.Digest == r.Digest {
+			t.Fatalf("digest did not change")
+		}
+		files := testLayerFiles(ctx, t, rc, rMod)
+		expect := []testTarEntry{
+			{name: "dir/", typeflag: tar.TypeDir},
+			{name: "dir/link1", typeflag: tar.TypeReg, content: "hello"},
+			{name: "dir/link2", typeflag: tar.TypeLink, linkname: "dir/link1"},
+			{name: "dir/.wh.removed", typeflag: tar.TypeReg},
+			{name: "opaque/", typeflag: tar.TypeDir},
+			{name: "opaque/.wh..wh..opq", typeflag: tar.TypeReg},
+		}
+		if len(files) != len(expect) {
+			t.Fatalf("unexpected files, expected %v, received %v", expect, files)
+		}
+		for i := range expect {
+			if files[i] != expect[i] {
+				t.Errorf("unexpected file %d, expected %v, received %v", i, expect[i], files[i])
+			}
+		}
+	})
+	t.Run("zstd", func(t *testing.T) {
+		_, err := Apply(ctx, rc, rZstd, WithLayerFileRemove("dir/target"))
+		if err == nil || !errors.Is(err, types.ErrUnsupported) {
+			t.Errorf("unexpected error, expected %v, received %v", types.ErrUnsupported, err)
+		}
+		// steps that do not read files are still supported
+		_, err = Apply(ctx, rc, rZstd, WithLabel("test", "zstd"))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+type testLayer struct {
+	mediaType string
+	entries   []testTarEntry
+	raw       []byte // used instead of entries when set
+}
+
+// testImagePush pushes a single platform image with the provided layers
+func testImagePush(ctx context.Context, t *testing.T, rc *regclient.RegClient, r ref.Ref, layers []testLayer) {
+	t.Helper()
+	conf := v1.Image{
+		OS:           "linux",
+		Architecture: "amd64",
+		RootFS:       v1.RootFS{Type: "layers"},
+	}
+	ml := v1.Manifest{
+		Versioned: v1.ManifestSchemaVersion,
+		MediaType: types.MediaTypeOCI1Manifest,
+	}
+	for _, l := range layers {
+		raw := l.raw
+		ucDig := digest.FromBytes(raw)
+		if raw == nil {
+			tarBuf := &bytes.Buffer{}
+			tw := tar.NewWriter(tarBuf)
+			for _, e := range l.entries {
+				th := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.content))}
+				if e.typeflag != tar.TypeReg {
+					th.Size = 0
+				}
+				if err := tw.WriteHeader(th); err != nil {
+					t.Fatalf("failed to write tar header: %v", err)
+				}
+				if th.Size > 0 {
+					if _, err := tw.Write([]byte(e.content)); err != nil {
+						t.Fatalf("failed to write tar content: %v", err)
+					}
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatalf("failed to close tar: %v", err)
+			}
+			ucDig = digest.FromBytes(tarBuf.Bytes())
+			gzBuf := &bytes.Buffer{}
+			gw := gzip.NewWriter(gzBuf)
+			if _, err := gw.Write(tarBuf.Bytes()); err != nil {
+				t.Fatalf("failed to compress layer: %v", err)
+			}
+			if err := gw.Close(); err != nil {
+				t.Fatalf("failed to compress layer: %v", err)
+			}
+			raw = gzBuf.Bytes()
+		}
+		d := types.Descriptor{MediaType: l.mediaType, Digest: digest.FromBytes(raw), Size: int64(len(raw))}
+		if _, err := rc.BlobPut(ctx, r, d, bytes.NewReader(raw)); err != nil {
+			t.Fatalf("failed to push layer: %v", err)
+		}
+		ml.Layers = append(ml.Layers, d)
+		conf.RootFS.DiffIDs = append(conf.RootFS.DiffIDs, ucDig)
+		conf.History = append(conf.History, v1.History{CreatedBy: "test"})
+	}
+	confRaw, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	ml.Config = types.Descriptor{MediaType: types.MediaTypeOCI1ImageConfig, Digest: digest.FromBytes(confRaw), Size: int64(len(confRaw))}
+	if _, err := rc.BlobPut(ctx, r, ml.Config, bytes.NewReader(confRaw)); err != nil {
+		t.Fatalf("failed to push config: %v", err)
+	}
+	m, err := manifest.New(manifest.WithOrig(ml))
+	if err != nil {
+		t.Fatalf("failed to create manifest: %v", err)
+	}
+	if err := rc.ManifestPut(ctx, r, m); err != nil {
+		t.Fatalf("failed to push manifest: %v", err)
+	}
+}
+
+// testLayerFiles returns the entries from the layers of an image
+func testLayerFiles(ctx context.Context, t *testing.T, rc *regclient.RegClient, r ref.Ref) []testTarEntry {
+	t.Helper()
+	m, err := rc.ManifestGet(ctx, r)
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	layers, err := m.GetLayers()
+	if err != nil {
+		t.Fatalf("failed to get layers: %v", err)
+	}
+	files := []testTarEntry{}
+	for _, l := range layers {
+		br, err := rc.BlobGet(ctx, r, l)
+		if err != nil {
+			t.Fatalf("failed to get layer: %v", err)
+		}
+		dr, err := archive.Decompress(br)
+		if err != nil {
+			t.Fatalf("failed to decompress layer: %v", err)
+		}
+		tr := tar.NewReader(dr)
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("failed to read layer: %v", err)
+			}
+			files = append(files, testTarEntry{name: th.Name, typeflag: th.Typeflag, linkname: th.Linkname, content: string(content)})
+		}
+		br.Close()
+	}
+	return files
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "/etc/passwd",
+			match:   []string{"etc/passwd"},
+			noMatch: []string{"etc/passwd-", "etc", "root/etc/passwd"},
+		},
+		{
+			pattern: "**/*.pyc",
+			match:   []string{"a.pyc", "usr/lib/python3/a.pyc"},
+			noMatch: []string{"a.py", "usr/lib/a.pyc/b"},
+		},
+		{
+			pattern: "var/cache/*",
+			match:   []string{"var/cache/apk"},
+			noMatch: []string{"var/cache", "var/cache/apk/index"},
+		},
+		{
+			pattern: "tmp/**",
+			match:   []string{"tmp/a", "tmp/a/b"},
+			noMatch: []string{"tmpfile"},
+		},
+		{
+			pattern: "file[0-9]?",
+			match:   []string{"file1a", "file22"},
+			noMatch: []string{"file1", "filea1"},
+		},
+		{
+			pattern: "file[!0-9]",
+			match:   []string{"filea"},
+			noMatch: []string{"file1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := globToRegexp(tt.pattern)
+			if err != nil {
+				t.Errorf("failed to convert pattern: %v", err)
+				return
+			}
+			for _, name := range tt.match {
+				if !re.MatchString(name) {
+					t.Errorf("pattern %s did not match %s", tt.pattern, name)
+				}
+			}
+			for _, name := range tt.noMatch {
+				if re.MatchString(name) {
+					t.Errorf("pattern %s matched %s", tt.pattern, name)
+				}
+			}
+		})
+	}
+}
+
+func TestRecipe(t *testing.T) {
+	ctx := context.Background()
+	fsOS := rwfs.OSNew("")
+	fsMem := rwfs.MemNew()
+	err := rwfs.CopyRecursive(fsOS, "../testdata", fsMem, ".")
+	if err != nil {
+		t.Errorf("failed to setup memfs copy: %v", err)
+		return
+	}
+	rc := regclient.New(regclient.WithFS(fsMem))
+
+	tests := []struct {
+		name     string
+		recipe   string
+		ref      string
+		wantErr  error
+		wantSame bool
+	}{
+		{
+			name: "yaml",
+			recipe: `
+steps:
+- annotation:
+    name: org.opencontainers.image.source
+    value: https://example.com/repo
+- label:
+    name: test
+    value: hello
+- layerFileRm: "**/*.pyc"
+- timeMax: "2020-01-01T00:00:00Z"
+- platformKeep: ["linux/amd64", "linux/arm64"]
+`,
+			ref: "ocidir://testrepo:v3",
+		},
+		{
+			name:   "json",
+			recipe: `{"steps": [{"exposeAdd": "8080"}, {"toOCI": true}]}`,
+			ref:    "ocidir://testrepo:v1",
+		},
+		{
+			name:     "empty",
+			recipe:   ``,
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "unchanged",
+			recipe: `
+steps:
+- volumeRm: /missing
+- exposeRm: "8080"
+`,
+			ref:      "ocidir://testrepo:v1",
+			wantSame: true,
+		},
+		{
+			name: "multiple mods in a step",
+			recipe: `
+steps:
+- volumeAdd: /data
+  exposeAdd: "8080"
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 0: exactly one modification must be set, found 2"),
+		},
+		{
+			name: "false bool",
+			recipe: `
+steps:
+- toDocker: false
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 0: modification toDocker must not be empty or false"),
+		},
+		{
+			name:    "false bool json",
+			recipe:  `{"steps": [{"volumeAdd": "/data"}, {"externalURLsRm": false}]}`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 1: modification externalURLsRm must not be empty or false"),
+		},
+		{
+			name: "empty string",
+			recipe: `
+steps:
+- volumeAdd: ""
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 0: modification volumeAdd must not be empty or false"),
+		},
+		{
+			name: "false bool with another mod",
+			recipe: `
+steps:
+- volumeAdd: /data
+  toOCI: false
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 0: exactly one modification must be set, found 2"),
+		},
+		{
+			name: "unknown field",
+			recipe: `
+steps:
+- volumeAdd: /data
+- unknownMod: true
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("failed to parse recipe: yaml: unmarshal errors:\n  line 4: field unknownMod not found in type mod.RecipeStep"),
+		},
+		{
+			name: "invalid time",
+			recipe: `
+steps:
+- timeMax: yesterday
+`,
+			ref:     "ocidir://testrepo:v1",
+			wantErr: fmt.Errorf("recipe step 0: time must be formatted %s: parsing time \"yesterday\" as \"%s\": cannot parse \"yesterday\" as \"2006\"", time.RFC3339, time.RFC3339),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := OptsFromRecipe(strings.NewReader(tt.recipe))
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Errorf("recipe did not fail")
+				} else if !errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error() {
+					t.Errorf("unexpected error, wanted %v, received %v", tt.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			r, err := ref.New(tt.ref)
+			if err != nil {
+				t.Errorf("failed creating ref: %v", err)
+				return
+			}
+			rMod, err := Apply(ctx, rc, r, opts...)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if tt.wantSame {
+				if r.Digest != rMod.Digest {
+					t.Errorf("digest changed")
+				}
+			} else {
+				if r.Digest == rMod.Digest {
+					t.Errorf("digest did not change")
+				}
+			}
 		})
 	}
 }
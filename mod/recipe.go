@@ -0,0 +1,274 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types/platform"
+	"github.com/regclient/regclient/types/ref"
+	"gopkg.in/yaml.v2"
+)
+
+// Recipe is a list of modifications to apply to an image
+type Recipe struct {
+	Steps []RecipeStep `yaml:"steps" json:"steps"`
+}
+
+// UnmarshalYAML records the keys in each step to report modifications with an empty or false value
+func (recipe *Recipe) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type recipeAlias Recipe
+	ra := recipeAlias{}
+	if err := unmarshal(&ra); err != nil {
+		return err
+	}
+	stepKeys := struct {
+		Steps []yaml.MapSlice `yaml:"steps"`
+	}{}
+	if err := unmarshal(&stepKeys); err != nil {
+		return err
+	}
+	for i := range ra.Steps {
+		if i >= len(stepKeys.Steps) {
+			break
+		}
+		for _, kv := range stepKeys.Steps[i] {
+			ra.Steps[i].keys = append(ra.Steps[i].keys, fmt.Sprintf("%v", kv.Key))
+		}
+	}
+	*recipe = Recipe(ra)
+	return nil
+}
+
+// RecipeStep is a single modification, exactly one field must be set in each step
+type RecipeStep struct {
+	Annotation        *RecipeKV       `yaml:"annotation" json:"annotation"`
+	AnnotationBase    *RecipeBase     `yaml:"annotationBase" json:"annotationBase"`
+	BuildArgRm        *RecipeBuildArg `yaml:"buildArgRm" json:"buildArgRm"`
+	ConfigTimeMax     string          `yaml:"configTimeMax" json:"configTimeMax"`
+	DataMax           *int64          `yaml:"dataMax" json:"dataMax"`
+	ExposeAdd         string          `yaml:"exposeAdd" json:"exposeAdd"`
+	ExposeRm          string          `yaml:"exposeRm" json:"exposeRm"`
+	ExternalURLsRm    bool            `yaml:"externalURLsRm" json:"externalURLsRm"`
+	IndexAdd          string          `yaml:"indexAdd" json:"indexAdd"`
+	Label             *RecipeKV       `yaml:"label" json:"label"`
+	LabelToAnnotation bool            `yaml:"labelToAnnotation" json:"labelToAnnotation"`
+	LayerFileRm       string          `yaml:"layerFileRm" json:"layerFileRm"`
+	LayerRmCreatedBy  string          `yaml:"layerRmCreatedBy" json:"layerRmCreatedBy"`
+	LayerRmIndex      *int            `yaml:"layerRmIndex" json:"layerRmIndex"`
+	LayerStripFile    string          `yaml:"layerStripFile" json:"layerStripFile"`
+	LayerTimeMax      string          `yaml:"layerTimeMax" json:"layerTimeMax"`
+	PlatformKeep      []string        `yaml:"platformKeep" json:"platformKeep"`
+	PlatformRm        string          `yaml:"platformRm" json:"platformRm"`
+	TimeMax           string          `yaml:"timeMax" json:"timeMax"`
+	ToDocker          bool            `yaml:"toDocker" json:"toDocker"`
+	ToOCI             bool            `yaml:"toOCI" json:"toOCI"`
+	VolumeAdd         string          `yaml:"volumeAdd" json:"volumeAdd"`
+	VolumeRm          string          `yaml:"volumeRm" json:"volumeRm"`
+	keys              []string        // keys found when parsing the step, used to report empty values
+}
+
+// RecipeKV is a name/value pair used for annotations and labels, an empty value deletes the entry
+type RecipeKV struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// RecipeBase defines the base image annotations
+type RecipeBase struct {
+	Name   string `yaml:"name" json:"name"`
+	Digest string `yaml:"digest" json:"digest"`
+}
+
+// RecipeBuildArg identifies a build arg to remove by an exact value or a regex
+type RecipeBuildArg struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"`
+	Regex string `yaml:"regex" json:"regex"`
+}
+
+// OptsFromRecipe parses a yaml or json recipe and returns the list of modifications
+func OptsFromRecipe(r io.Reader) ([]Opts, error) {
+	recipe, err := RecipeRead(r)
+	if err != nil {
+		return nil, err
+	}
+	return recipe.Opts()
+}
+
+// RecipeRead parses a yaml or json recipe
+func RecipeRead(r io.Reader) (Recipe, error) {
+	recipe := Recipe{}
+	dec := yaml.NewDecoder(r)
+	dec.SetStrict(true)
+	if err := dec.Decode(&recipe); err != nil && !errors.Is(err, io.EOF) {
+		return recipe, fmt.Errorf("failed to parse recipe: %w", err)
+	}
+	return recipe, nil
+}
+
+// IndexAddRefs returns the images from each indexAdd step.
+// These should be copied with IndexAddCopy before running Apply.
+func (recipe Recipe) IndexAddRefs() ([]ref.Ref, error) {
+	rl := []ref.Ref{}
+	for i, step := range recipe.Steps {
+		if step.IndexAdd == "" {
+			continue
+		}
+		r, err := ref.New(step.IndexAdd)
+		if err != nil {
+			return nil, fmt.Errorf("recipe step %d: invalid image reference: %w", i, err)
+		}
+		rl = append(rl, r)
+	}
+	return rl, nil
+}
+
+// Opts converts each step in the recipe to a modification
+func (recipe Recipe) Opts() ([]Opts, error) {
+	opts := []Opts{}
+	for i, step := range recipe.Steps {
+		stepOpts, err := step.opts()
+		if err != nil {
+			return nil, fmt.Errorf("recipe step %d: %w", i, err)
+		}
+		opts = append(opts, stepOpts...)
+	}
+	return opts, nil
+}
+
+func (step RecipeStep) opts() ([]Opts, error) {
+	set := 0
+	rv := reflect.ValueOf(step)
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		if !rv.Field(i).IsZero() {
+			set++
+		}
+	}
+	if set == 0 && len(step.keys) > 0 {
+		return nil, fmt.Errorf("modification %s must not be empty or false", strings.Join(step.keys, ", "))
+	}
+	if len(step.keys) > set {
+		// keys with an empty or false value are included in the count
+		set = len(step.keys)
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one modification must be set, found %d", set)
+	}
+
+	switch {
+	case step.Annotation != nil:
+		return []Opts{WithAnnotation(step.Annotation.Name, step.Annotation.Value)}, nil
+	case step.AnnotationBase != nil:
+		r, err := ref.New(step.AnnotationBase.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image reference: %w", err)
+		}
+		d, err := digest.Parse(step.AnnotationBase.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest: %w", err)
+		}
+		return []Opts{WithAnnotationOCIBase(r, d)}, nil
+	case step.BuildArgRm != nil:
+		var re *regexp.Regexp
+		if step.BuildArgRm.Regex != "" {
+			var err error
+			re, err = regexp.Compile(step.BuildArgRm.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("regexp value is invalid: %w", err)
+			}
+		} else {
+			re = regexp.MustCompile(regexp.QuoteMeta(step.BuildArgRm.Value))
+		}
+		return []Opts{WithBuildArgRm(step.BuildArgRm.Name, re)}, nil
+	case step.ConfigTimeMax != "":
+		t, err := recipeTime(step.ConfigTimeMax)
+		if err != nil {
+			return nil, err
+		}
+		return []Opts{WithConfigTimestampMax(t)}, nil
+	case step.DataMax != nil:
+		return []Opts{WithData(*step.DataMax)}, nil
+	case step.ExposeAdd != "":
+		return []Opts{WithExposeAdd(step.ExposeAdd)}, nil
+	case step.ExposeRm != "":
+		return []Opts{WithExposeRm(step.ExposeRm)}, nil
+	case step.ExternalURLsRm:
+		return []Opts{WithExternalURLsRm()}, nil
+	case step.IndexAdd != "":
+		r, err := ref.New(step.IndexAdd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image reference: %w", err)
+		}
+		return []Opts{WithIndexAdd(r)}, nil
+	case step.Label != nil:
+		return []Opts{WithLabel(step.Label.Name, step.Label.Value)}, nil
+	case step.LabelToAnnotation:
+		return []Opts{WithLabelToAnnotation()}, nil
+	case step.LayerFileRm != "":
+		return []Opts{WithLayerFileRemove(step.LayerFileRm)}, nil
+	case step.LayerRmCreatedBy != "":
+		re, err := regexp.Compile(step.LayerRmCreatedBy)
+		if err != nil {
+			return nil, fmt.Errorf("value must be a valid regex: %w", err)
+		}
+		return []Opts{WithLayerRmCreatedBy(*re)}, nil
+	case step.LayerRmIndex != nil:
+		return []Opts{WithLayerRmIndex(*step.LayerRmIndex)}, nil
+	case step.LayerStripFile != "":
+		return []Opts{WithLayerStripFile(step.LayerStripFile)}, nil
+	case step.LayerTimeMax != "":
+		t, err := recipeTime(step.LayerTimeMax)
+		if err != nil {
+			return nil, err
+		}
+		return []Opts{WithLayerTimestampMax(t)}, nil
+	case len(step.PlatformKeep) > 0:
+		pl := []platform.Platform{}
+		for _, ps := range step.PlatformKeep {
+			p, err := platform.Parse(ps)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse platform %s: %w", ps, err)
+			}
+			pl = append(pl, p)
+		}
+		return []Opts{WithPlatformKeep(pl)}, nil
+	case step.PlatformRm != "":
+		p, err := platform.Parse(step.PlatformRm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse platform %s: %w", step.PlatformRm, err)
+		}
+		return []Opts{WithPlatformRemove(p)}, nil
+	case step.TimeMax != "":
+		t, err := recipeTime(step.TimeMax)
+		if err != nil {
+			return nil, err
+		}
+		return []Opts{WithConfigTimestampMax(t), WithLayerTimestampMax(t)}, nil
+	case step.ToDocker:
+		return []Opts{WithManifestToDocker()}, nil
+	case step.ToOCI:
+		return []Opts{WithManifestToOCI()}, nil
+	case step.VolumeAdd != "":
+		return []Opts{WithVolumeAdd(step.VolumeAdd)}, nil
+	case step.VolumeRm != "":
+		return []Opts{WithVolumeRm(step.VolumeRm)}, nil
+	}
+	return nil, fmt.Errorf("unsupported modification")
+}
+
+func recipeTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("time must be formatted %s: %w", time.RFC3339, err)
+	}
+	return t, nil
+}
@@ -3,6 +3,8 @@ package archive
 import "errors"
 
 var (
+	// ErrInvalidPath used when a tar entry would be extracted outside of the target directory
+	ErrInvalidPath = errors.New("path is outside of the extract directory")
 	// ErrNotImplemented used for routines that need to be developed still
 	ErrNotImplemented = errors.New("this archive routine is not implemented yet")
 	// ErrUnknownType used for unknown compression types
@@ -4,14 +4,20 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+// extractMaxSymlinks limits the number of symlinks followed when resolving a path
+const extractMaxSymlinks = 255
+
 // TarOpts configures options for Create/Extract tar
 type TarOpts func(*tarOpts)
 
@@ -50,13 +56,16 @@ func Tar(ctx context.Context, path string, w io.Writer, opts ...TarOpts) error {
 	defer tw.Close()
 
 	// walk the path performing a recursive tar
-	filepath.Walk(path, func(file string, fi os.FileInfo, err error) error {
+	return filepath.Walk(path, func(file string, fi os.FileInfo, err error) error {
 		// return any errors filepath encounters accessing the file
 		if err != nil {
 			return err
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-		// TODO: handle symlinks, security attributes, hard links
+		// TODO: handle security attributes, hard links
 		// TODO: add options for file owner and timestamps
 		// TODO: add options to override time, or disable access/change stamps
 
@@ -66,7 +75,14 @@ func Tar(ctx context.Context, path string, w io.Writer, opts ...TarOpts) error {
 			return nil
 		}
 
-		header, err := tar.FileInfoHeader(fi, relPath)
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
 		if err != nil {
 			return err
 		}
@@ -87,18 +103,20 @@ func Tar(ctx context.Context, path string, w io.Writer, opts ...TarOpts) error {
 			if err != nil {
 				return err
 			}
-			if _, err = io.Copy(tw, f); err != nil {
+			_, err = io.Copy(tw, f)
+			f.Close()
+			if err != nil {
 				return err
 			}
-			f.Close()
 		}
 
 		return nil
 	})
-	return nil
 }
 
 // Extract Tar
+// Entries are extracted relative to path, and symlinks are resolved as if path was the root filesystem.
+// Entries that would be written outside of path return ErrInvalidPath.
 func Extract(ctx context.Context, path string, r io.Reader, opts ...TarOpts) error {
 	to := tarOpts{}
 	for _, opt := range opts {
@@ -129,17 +147,38 @@ func Extract(ctx context.Context, path string, r io.Reader, opts ...TarOpts) err
 		if err != nil {
 			return err
 		}
-		// join a cleaned version of the filename with the path
-		fn := filepath.Join(path, filepath.Clean("/"+hdr.Name))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// resolve the filename within the path, without following a symlink in the last component
+		fn, err := extractJoin(path, hdr.Name, false)
+		if err != nil {
+			return err
+		}
+		if fn == filepath.Clean(path) {
+			continue
+		}
+		// remove any existing non-directory entry, symlinks are replaced rather than followed
+		if cur, err := os.Lstat(fn); err == nil && (!cur.IsDir() || hdr.Typeflag != tar.TypeDir) {
+			if err := os.RemoveAll(fn); err != nil {
+				return err
+			}
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			err = os.MkdirAll(filepath.Dir(fn), 0755)
+			if err != nil {
+				return err
+			}
+		}
 		switch hdr.Typeflag {
 		case tar.TypeDir:
-			err = os.MkdirAll(fn, fs.FileMode(hdr.Mode))
+			err = os.MkdirAll(fn, fs.FileMode(hdr.Mode).Perm())
 			if err != nil {
 				return err
 			}
 		case tar.TypeReg:
-			// TODO: configure file mode, creation timestamp, etc
-			fh, err := os.Create(fn)
+			// TODO: configure file owner, creation timestamp, etc
+			fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(hdr.Mode).Perm())
 			if err != nil {
 				return err
 			}
@@ -151,9 +190,76 @@ func Extract(ctx context.Context, path string, r io.Reader, opts ...TarOpts) err
 			if n != hdr.Size {
 				return fmt.Errorf("size mismatch extracting \"%s\", expected %d, extracted %d", hdr.Name, hdr.Size, n)
 			}
-			// TODO: handle other tar types (symlinks, etc)
+		case tar.TypeSymlink:
+			// the link is not followed during the extract, so the target is not validated
+			err = os.Symlink(hdr.Linkname, fn)
+			if err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target, err := extractJoin(path, hdr.Linkname, false)
+			if err != nil {
+				return err
+			}
+			err = os.Link(target, fn)
+			if err != nil {
+				return err
+			}
+			// TODO: handle other tar types (devices, fifos, etc)
 		}
 	}
 
 	return nil
 }
+
+// extractJoin returns the location of name within root.
+// Symlinks are resolved relative to root, and the last component is only followed when followLast is set.
+func extractJoin(root, name string, followLast bool) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimLeft(name, "/")))
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPath, name)
+	}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean("/"+name)), "/")
+	cur := ""
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			// symlinks cannot resolve above the root
+			cur = strings.TrimSuffix(pathpkg.Dir("/"+cur), "/")
+			cur = strings.TrimPrefix(cur, "/")
+			continue
+		}
+		next := pathpkg.Join(cur, part)
+		fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				cur = next
+				continue
+			}
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 || (len(parts) == 0 && !followLast) {
+			cur = next
+			continue
+		}
+		links++
+		if links > extractMaxSymlinks {
+			return "", fmt.Errorf("too many symlinks resolving %s", name)
+		}
+		target, err := os.Readlink(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		if pathpkg.IsAbs(target) {
+			cur = ""
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return filepath.Join(root, filepath.FromSlash(cur)), nil
+}
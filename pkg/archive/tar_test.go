@@ -0,0 +1,181 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarTestEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func tarTestBuild(t *testing.T, entries []tarTestEntry) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		th := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.content)),
+		}
+		if e.typeflag == tar.TypeDir {
+			th.Mode = 0755
+		}
+		if err := tw.WriteHeader(th); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	return buf
+}
+
+func TestExtract(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		entries []tarTestEntry
+		files   map[string]string
+		links   map[string]string
+		expErr  error
+	}{
+		{
+			name: "files",
+			entries: []tarTestEntry{
+				{name: "dir/", typeflag: tar.TypeDir},
+				{name: "dir/file", typeflag: tar.TypeReg, content: "hello"},
+				{name: "./dir/hard", typeflag: tar.TypeLink, linkname: "dir/file"},
+				{name: "sym", typeflag: tar.TypeSymlink, linkname: "dir/file"},
+			},
+			files: map[string]string{
+				"dir/file": "hello",
+				"dir/hard": "hello",
+				"sym":      "hello",
+			},
+			links: map[string]string{
+				"sym": "dir/file",
+			},
+		},
+		{
+			name: "absolute symlink stays in root",
+			entries: []tarTestEntry{
+				{name: "etc/", typeflag: tar.TypeDir},
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc"},
+				{name: "link/file", typeflag: tar.TypeReg, content: "inside"},
+			},
+			files: map[string]string{
+				"etc/file": "inside",
+			},
+		},
+		{
+			name: "relative symlink stays in root",
+			entries: []tarTestEntry{
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "../../../.."},
+				{name: "link/file", typeflag: tar.TypeReg, content: "inside"},
+			},
+			files: map[string]string{
+				"file": "inside",
+			},
+		},
+		{
+			name: "replace symlink",
+			entries: []tarTestEntry{
+				{name: "target", typeflag: tar.TypeReg, content: "original"},
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "target"},
+				{name: "link", typeflag: tar.TypeReg, content: "replaced"},
+			},
+			files: map[string]string{
+				"target": "original",
+				"link":   "replaced",
+			},
+		},
+		{
+			name: "parent traversal",
+			entries: []tarTestEntry{
+				{name: "../escape", typeflag: tar.TypeReg, content: "outside"},
+			},
+			expErr: ErrInvalidPath,
+		},
+		{
+			name: "nested traversal",
+			entries: []tarTestEntry{
+				{name: "dir/../../escape", typeflag: tar.TypeReg, content: "outside"},
+			},
+			expErr: ErrInvalidPath,
+		},
+		{
+			name: "absolute traversal",
+			entries: []tarTestEntry{
+				{name: "/../escape", typeflag: tar.TypeReg, content: "outside"},
+			},
+			expErr: ErrInvalidPath,
+		},
+		{
+			name: "hardlink traversal",
+			entries: []tarTestEntry{
+				{name: "hard", typeflag: tar.TypeLink, linkname: "../escape"},
+			},
+			expErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "root")
+			if err := os.Mkdir(root, 0755); err != nil {
+				t.Fatalf("failed to create root: %v", err)
+			}
+			err := Extract(ctx, root, tarTestBuild(t, tt.entries))
+			if tt.expErr != nil {
+				if err == nil {
+					t.Errorf("extract did not fail")
+				} else if !errors.Is(err, tt.expErr) {
+					t.Errorf("unexpected error, expected %v, received %v", tt.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extract failed: %v", err)
+			}
+			for name, content := range tt.files {
+				b, err := os.ReadFile(filepath.Join(root, name))
+				if err != nil {
+					t.Errorf("failed to read %s: %v", name, err)
+				} else if string(b) != content {
+					t.Errorf("content mismatch for %s, expected %s, received %s", name, content, string(b))
+				}
+			}
+			for name, target := range tt.links {
+				l, err := os.Readlink(filepath.Join(root, name))
+				if err != nil {
+					t.Errorf("failed to read link %s: %v", name, err)
+				} else if l != target {
+					t.Errorf("link mismatch for %s, expected %s, received %s", name, target, l)
+				}
+			}
+			// nothing should be written outside of the root
+			entries, err := os.ReadDir(base)
+			if err != nil {
+				t.Fatalf("failed to read base: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("unexpected files outside of root: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version, missing or wildcard parts are -1
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// semverParse parses a version with an optional "v" prefix, partial versions are allowed
+func semverParse(s string) (semver, error) {
+	v := semver{major: -1, minor: -1, patch: -1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i] // build metadata is ignored
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.pre = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return v, fmt.Errorf("invalid semver: %s", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid semver: %s", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// fill returns the version with missing parts set to 0
+func (v semver) fill() semver {
+	if v.major < 0 {
+		v.major = 0
+	}
+	if v.minor < 0 {
+		v.minor = 0
+	}
+	if v.patch < 0 {
+		v.patch = 0
+	}
+	return v
+}
+
+// compare returns -1, 0, or 1, following the semver precedence rules
+func (v semver) compare(o semver) int {
+	v, o = v.fill(), o.fill()
+	for _, c := range [][2]int{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if c[0] < c[1] {
+			return -1
+		} else if c[0] > c[1] {
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	vp, op := strings.Split(v.pre, "."), strings.Split(o.pre, ".")
+	for i := 0; i < len(vp) && i < len(op); i++ {
+		if vp[i] == op[i] {
+			continue
+		}
+		vn, vErr := strconv.Atoi(vp[i])
+		on, oErr := strconv.Atoi(op[i])
+		switch {
+		case vErr == nil && oErr == nil:
+			if vn < on {
+				return -1
+			}
+			return 1
+		case vErr == nil:
+			return -1
+		case oErr == nil:
+			return 1
+		case vp[i] < op[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if len(vp) < len(op) {
+		return -1
+	} else if len(vp) > len(op) {
+		return 1
+	}
+	return 0
+}
+
+// bump increments the version at the last specified part, used as the exclusive upper bound of a range
+func (v semver) bump() semver {
+	switch {
+	case v.major < 0:
+		return semver{major: 1 << 30}
+	case v.minor < 0:
+		return semver{major: v.major + 1}
+	case v.patch < 0:
+		return semver{major: v.major, minor: v.minor + 1}
+	default:
+		return semver{major: v.major, minor: v.minor, patch: v.patch + 1}
+	}
+}
+
+// semverConstraint is a single parsed constraint (e.g. ">= 1.2", "~1.2.3", "^1", "1.2.x")
+type semverConstraint struct {
+	op string
+	v  semver
+}
+
+func semverConstraintParse(c string) (semverConstraint, error) {
+	c = strings.TrimSpace(c)
+	op := ""
+	for _, o := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(c, o) {
+			op = o
+			c = c[len(o):]
+			break
+		}
+	}
+	cv, err := semverParse(c)
+	if err != nil {
+		return semverConstraint{}, err
+	}
+	return semverConstraint{op: op, v: cv}, nil
+}
+
+// match checks a version against the constraint
+func (c semverConstraint) match(v semver) bool {
+	cv := c.v
+	switch c.op {
+	case ">=":
+		return v.compare(cv) >= 0
+	case ">":
+		if cv.patch < 0 {
+			// ">1.2" excludes every 1.2.x release
+			return v.compare(cv.bump()) >= 0
+		}
+		return v.compare(cv) > 0
+	case "<=":
+		if cv.patch < 0 {
+			return v.compare(cv.bump()) < 0
+		}
+		return v.compare(cv) <= 0
+	case "<":
+		return v.compare(cv) < 0
+	case "!=":
+		return !semverConstraint{v: cv}.match(v)
+	case "~":
+		// patch updates, or minor updates when only the major version is specified
+		upper := semver{major: cv.major, minor: cv.minor, patch: -1}
+		return v.compare(cv) >= 0 && v.compare(upper.bump()) < 0
+	case "^":
+		// updates that do not change the left most non-zero part
+		upper := semver{major: cv.major, minor: -1, patch: -1}
+		if cv.major == 0 && cv.minor > 0 {
+			upper = semver{major: 0, minor: cv.minor, patch: -1}
+		} else if cv.major == 0 && cv.minor == 0 && cv.patch >= 0 {
+			upper = cv
+		} else if cv.major == 0 && cv.minor == 0 {
+			upper = semver{major: 0, minor: 0, patch: -1}
+		}
+		return v.compare(cv) >= 0 && v.compare(upper.bump()) < 0
+	default:
+		// exact match, or a range for partial versions
+		if cv.patch >= 0 {
+			return v.compare(cv) == 0
+		}
+		return v.compare(cv) >= 0 && v.compare(cv.bump()) < 0
+	}
+}
+
+// semverCompare checks a version against constraints.
+// Constraints separated by a comma must all match, and "||" separates alternatives.
+// Partial versions (e.g. a "1.2" tag) are compared as the ".0" release.
+// An invalid constraint returns an error, while a version that cannot be parsed (e.g. "latest") does not match.
+func semverCompare(constraint, version string) (bool, error) {
+	alts := [][]semverConstraint{}
+	for _, alt := range strings.Split(constraint, "||") {
+		cs := []semverConstraint{}
+		for _, c := range strings.Split(alt, ",") {
+			sc, err := semverConstraintParse(c)
+			if err != nil {
+				return false, err
+			}
+			cs = append(cs, sc)
+		}
+		alts = append(alts, cs)
+	}
+	v, err := semverParse(version)
+	if err != nil {
+		return false, nil
+	}
+	for _, cs := range alts {
+		match := true
+		for _, c := range cs {
+			if !c.match(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func semverMajor(version string) (int, error) {
+	v, err := semverParse(version)
+	if err != nil {
+		return 0, err
+	}
+	return v.fill().major, nil
+}
+
+func semverMinor(version string) (int, error) {
+	v, err := semverParse(version)
+	if err != nil {
+		return 0, err
+	}
+	return v.fill().minor, nil
+}
+
+func semverPatch(version string) (int, error) {
+	v, err := semverParse(version)
+	if err != nil {
+		return 0, err
+	}
+	return v.fill().patch, nil
+}
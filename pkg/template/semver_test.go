@@ -0,0 +1,71 @@
+package template
+
+import "testing"
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expect     bool
+		expErr     bool
+	}{
+		{constraint: "1.2.3", version: "1.2.3", expect: true},
+		{constraint: "=1.2.3", version: "v1.2.3", expect: true},
+		{constraint: "1.2.3", version: "1.2.4", expect: false},
+		{constraint: "1.2", version: "1.2.9", expect: true},
+		{constraint: "1.2.x", version: "1.3.0", expect: false},
+		{constraint: "*", version: "3.0.0", expect: true},
+		{constraint: "!=1.2.3", version: "1.2.4", expect: true},
+		{constraint: ">1.2.3", version: "1.2.4", expect: true},
+		{constraint: ">1.2", version: "1.2.9", expect: false},
+		{constraint: ">1.2", version: "1.3.0", expect: true},
+		{constraint: ">=1.2", version: "1.2.0", expect: true},
+		{constraint: "<1.2", version: "1.1.9", expect: true},
+		{constraint: "<1.2", version: "1.2.0", expect: false},
+		{constraint: "<=1.2", version: "1.2.9", expect: true},
+		{constraint: "<=1.2.3", version: "1.2.4", expect: false},
+		{constraint: "~1.2.3", version: "1.2.9", expect: true},
+		{constraint: "~1.2.3", version: "1.3.0", expect: false},
+		{constraint: "~1", version: "1.9.0", expect: true},
+		{constraint: "^1.2.3", version: "1.9.0", expect: true},
+		{constraint: "^1.2.3", version: "2.0.0", expect: false},
+		{constraint: "^1.2.3", version: "1.2.2", expect: false},
+		{constraint: "^0.2.3", version: "0.2.9", expect: true},
+		{constraint: "^0.2.3", version: "0.3.0", expect: false},
+		{constraint: "^0.0.3", version: "0.0.4", expect: false},
+		{constraint: ">= 1.2, < 2", version: "1.5.0", expect: true},
+		{constraint: ">= 1.2, < 2", version: "2.0.0", expect: false},
+		{constraint: "<1 || >=3", version: "3.1.0", expect: true},
+		{constraint: "<1 || >=3", version: "2.0.0", expect: false},
+		{constraint: "1.2", version: "1.2", expect: true},
+		{constraint: ">=1.2.3", version: "1.2.3-rc1", expect: false},
+		{constraint: "<1.2.3", version: "1.2.3-rc1", expect: true},
+		{constraint: ">1.2.3-alpha.1", version: "1.2.3-alpha.2", expect: true},
+		{constraint: ">1.2.3-alpha.10", version: "1.2.3-alpha.9", expect: false},
+		{constraint: ">1.2.3-alpha", version: "1.2.3-beta", expect: true},
+		{constraint: "1.2.3", version: "1.2.3+build5", expect: true},
+		{constraint: ">=1", version: "latest", expect: false},
+		{constraint: "*", version: "", expect: false},
+		{constraint: ">=one", version: "1.0.0", expErr: true},
+		{constraint: ">=one", version: "latest", expErr: true},
+		{constraint: "<1, >=one", version: "2.0.0", expErr: true},
+		{constraint: ">=1 || ~", version: "1.0.0", expErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.version, func(t *testing.T) {
+			result, err := semverCompare(tt.constraint, tt.version)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("did not fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expect {
+				t.Errorf("unexpected result, expected %t, received %t", tt.expect, result)
+			}
+		})
+	}
+}
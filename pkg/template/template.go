@@ -4,17 +4,24 @@ package template
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
 	gotemplate "text/template"
+
+	"github.com/regclient/regclient/internal/units"
+	"github.com/regclient/regclient/types"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
 )
 
 var tmplFuncs = gotemplate.FuncMap{
 	"default": func(def, orig interface{}) interface{} {
-		if orig == nil || orig == reflect.Zero(reflect.TypeOf(orig)).Interface() {
+		if orig == nil || reflect.ValueOf(orig).IsZero() {
 			return def
 		}
 		return orig
@@ -45,11 +52,35 @@ var tmplFuncs = gotemplate.FuncMap{
 		enc.Encode(v)
 		return buf.String()
 	},
-	"printPretty": printPretty,
-	"lower":       strings.ToLower,
-	"split":       strings.Split,
-	"time":        func() *TimeFuncs { return &TimeFuncs{} },
-	"upper":       strings.ToUpper,
+	"humanSize":      humanSize,
+	"lower":          strings.ToLower,
+	"platformString": platformString,
+	"printPretty":    printPretty,
+	"regexReplace": func(expr, repl, s string) (string, error) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+	"semverCompare": semverCompare,
+	"semverMajor":   semverMajor,
+	"semverMinor":   semverMinor,
+	"semverPatch":   semverPatch,
+	"shortDigest":   shortDigest,
+	"split":         strings.Split,
+	"ternary": func(vTrue, vFalse interface{}, cond bool) interface{} {
+		if cond {
+			return vTrue
+		}
+		return vFalse
+	},
+	"time":       func() *TimeFuncs { return &TimeFuncs{} },
+	"timeAdd":    timeAdd,
+	"timeFormat": timeFormat,
+	"timeSince":  timeSince,
+	"timeSub":    timeSub,
+	"upper":      strings.ToUpper,
 }
 
 // Opt allows options to be passed to templating functions
@@ -75,7 +106,7 @@ func Writer(out io.Writer, tmpl string, data interface{}, opts ...Opt) error {
 // String converts a template to a string
 func String(tmpl string, data interface{}, opts ...Opt) (string, error) {
 	var sb strings.Builder
-	err := Writer(&sb, tmpl, data)
+	err := Writer(&sb, tmpl, data, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -88,3 +119,61 @@ func WithFuncs(funcs gotemplate.FuncMap) Opt {
 		return t.Funcs(funcs), nil
 	}
 }
+
+// humanSize formats any integer or float size in bytes with decimal units (e.g. "2.746MB")
+func humanSize(size interface{}) (string, error) {
+	v := reflect.ValueOf(size)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return units.HumanSize(float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return units.HumanSize(float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return units.HumanSize(v.Float()), nil
+	}
+	return "", fmt.Errorf("humanSize: unsupported type %T", size)
+}
+
+// platformString formats the platform from a platform, descriptor, or image config
+func platformString(v interface{}) (string, error) {
+	switch p := v.(type) {
+	case platform.Platform:
+		return p.String(), nil
+	case *platform.Platform:
+		if p == nil {
+			return "", nil
+		}
+		return p.String(), nil
+	case types.Descriptor:
+		if p.Platform == nil {
+			return "", nil
+		}
+		return p.Platform.String(), nil
+	case v1.Image:
+		return platform.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant, OSVersion: p.OSVersion}.String(), nil
+	case *v1.Image:
+		if p == nil {
+			return "", nil
+		}
+		return platform.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant, OSVersion: p.OSVersion}.String(), nil
+	case string:
+		pp, err := platform.Parse(p)
+		if err != nil {
+			return "", err
+		}
+		return pp.String(), nil
+	}
+	return "", fmt.Errorf("platformString: unsupported type %T", v)
+}
+
+// shortDigest returns the first 12 characters of the encoded digest, without the algorithm
+func shortDigest(d interface{}) string {
+	s := fmt.Sprintf("%v", d)
+	if i := strings.Index(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+	if len(s) > 12 {
+		s = s[:12]
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package template
+
+import (
+	"strings"
+	"testing"
+	gotemplate "text/template"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/regclient/regclient/types"
+	v1 "github.com/regclient/regclient/types/oci/v1"
+	"github.com/regclient/regclient/types/platform"
+)
+
+func TestString(t *testing.T) {
+	created := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := struct {
+		Tag      string
+		Digest   digest.Digest
+		Size     int64
+		Created  *time.Time
+		Desc     types.Descriptor
+		Config   v1.Image
+		Platform platform.Platform
+		Empty    string
+		Labels   map[string]string
+		NoLabels map[string]string
+		Tags     []string
+		NoTags   []string
+	}{
+		Tag:      "v1.2.3",
+		Digest:   digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"),
+		Size:     2746000,
+		Created:  &created,
+		Desc:     types.Descriptor{Platform: &platform.Platform{OS: "linux", Architecture: "arm64"}},
+		Config:   v1.Image{OS: "linux", Architecture: "arm", Variant: "v7"},
+		Platform: platform.Platform{OS: "linux", Architecture: "amd64"},
+		Labels:   map[string]string{"version": "1"},
+		Tags:     []string{"v1", "latest"},
+	}
+	tests := []struct {
+		name   string
+		tmpl   string
+		opts   []Opt
+		expect string
+		expErr bool
+	}{
+		{
+			name:   "default",
+			tmpl:   `{{ default "none" .Empty }} {{ default "none" .Tag }}`,
+			expect: "none v1.2.3",
+		},
+		{
+			name:   "default map and slice",
+			tmpl:   `{{ default "none" .NoLabels }} {{ len (default "none" .Labels) }} {{ default "none" .NoTags }} {{ join (default "none" .Tags) "," }}`,
+			expect: "none 1 none v1,latest",
+		},
+		{
+			name:   "humanSize",
+			tmpl:   `{{ humanSize .Size }} {{ humanSize 512 }} {{ humanSize 1.5e9 }}`,
+			expect: "2.746MB 512B 1.5GB",
+		},
+		{
+			name:   "humanSize invalid",
+			tmpl:   `{{ humanSize .Tag }}`,
+			expErr: true,
+		},
+		{
+			name:   "platformString",
+			tmpl:   `{{ platformString .Platform }} {{ platformString .Desc }} {{ platformString .Config }} {{ platformString "linux/arm64" }}`,
+			expect: "linux/amd64 linux/arm64 linux/arm/v7 linux/arm64",
+		},
+		{
+			name:   "regexReplace",
+			tmpl:   `{{ .Tag | regexReplace "^v([0-9]+)\\..*$" "major-$1" }}`,
+			expect: "major-1",
+		},
+		{
+			name:   "regexReplace invalid",
+			tmpl:   `{{ .Tag | regexReplace "(" "" }}`,
+			expErr: true,
+		},
+		{
+			name:   "semver",
+			tmpl:   `{{ semverMajor .Tag }}.{{ semverMinor .Tag }}.{{ semverPatch .Tag }} {{ semverCompare ">=1.2, <2" .Tag }} {{ semverCompare "^2" .Tag }}`,
+			expect: "1.2.3 true false",
+		},
+		{
+			name:   "semver invalid",
+			tmpl:   `{{ semverMajor "latest" }}`,
+			expErr: true,
+		},
+		{
+			name:   "shortDigest",
+			tmpl:   `{{ shortDigest .Digest }} {{ shortDigest "abc" }}`,
+			expect: "0123456789ab abc",
+		},
+		{
+			name:   "ternary",
+			tmpl:   `{{ ternary "yes" "no" true }} {{ eq .Tag "latest" | ternary "yes" "no" }}`,
+			expect: "yes no",
+		},
+		{
+			name:   "timeAdd",
+			tmpl:   `{{ .Created | timeAdd "36h" | timeFormat "2006-01-02T15:04" }}`,
+			expect: "2022-05-03T00:00",
+		},
+		{
+			name:   "timeSub",
+			tmpl:   `{{ .Created | timeSub "24h" | timeFormat "2006-01-02" }}`,
+			expect: "2022-04-30",
+		},
+		{
+			name:   "timeSince",
+			tmpl:   `{{ gt (timeSince .Created).Hours 24.0 }}`,
+			expect: "true",
+		},
+		{
+			name:   "timeAdd invalid",
+			tmpl:   `{{ .Created | timeAdd "tomorrow" }}`,
+			expErr: true,
+		},
+		{
+			name: "WithFuncs",
+			tmpl: `{{ hello .Tag }}`,
+			opts: []Opt{WithFuncs(gotemplate.FuncMap{
+				"hello": func(s string) string { return "hello " + s },
+			})},
+			expect: "hello v1.2.3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := String(tt.tmpl, data, tt.opts...)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("did not fail, output: %s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.TrimSpace(out) != tt.expect {
+				t.Errorf("unexpected output, expected %s, received %s", tt.expect, out)
+			}
+		})
+	}
+}
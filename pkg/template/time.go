@@ -1,6 +1,7 @@
 package template
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -21,3 +22,72 @@ func (t *TimeFuncs) Now() time.Time {
 func (t *TimeFuncs) Parse(layout string, value string) (time.Time, error) {
 	return time.Parse(layout, value)
 }
+
+// toTime accepts a time or a pointer to a time
+func toTime(t interface{}) (time.Time, error) {
+	switch tt := t.(type) {
+	case time.Time:
+		return tt, nil
+	case *time.Time:
+		if tt == nil {
+			return time.Time{}, fmt.Errorf("time is nil")
+		}
+		return *tt, nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported time type %T", t)
+}
+
+// toDuration accepts a duration or a string parsed by time.ParseDuration
+func toDuration(d interface{}) (time.Duration, error) {
+	switch dt := d.(type) {
+	case time.Duration:
+		return dt, nil
+	case string:
+		return time.ParseDuration(dt)
+	}
+	return 0, fmt.Errorf("unsupported duration type %T", d)
+}
+
+// timeAdd returns t + d, e.g. {{ (time).Now | timeAdd "24h" }}
+func timeAdd(d interface{}, t interface{}) (time.Time, error) {
+	dur, err := toDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tt, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return tt.Add(dur), nil
+}
+
+// timeSub returns t - d, e.g. {{ (time).Now | timeSub "168h" }}
+func timeSub(d interface{}, t interface{}) (time.Time, error) {
+	dur, err := toDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tt, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return tt.Add(-dur), nil
+}
+
+// timeSince returns the duration since t, e.g. {{ timeSince .Created }}
+func timeSince(t interface{}) (time.Duration, error) {
+	tt, err := toTime(t)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(tt), nil
+}
+
+// timeFormat formats t with a Go time layout, e.g. {{ .Created | timeFormat "2006-01-02" }}
+func timeFormat(layout string, t interface{}) (string, error) {
+	tt, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	return tt.Format(layout), nil
+}
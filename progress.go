@@ -0,0 +1,105 @@
+package regclient
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/regclient/regclient/types"
+)
+
+// progress tracks the overall totals sent to a progress callback.
+// A nil progress is valid and reports nothing.
+type progress struct {
+	mu          sync.Mutex
+	cb          func(types.Progress)
+	overall     int64
+	overallSize int64
+}
+
+func newProgress(cb func(types.Progress)) *progress {
+	if cb == nil {
+		return nil
+	}
+	return &progress{cb: cb}
+}
+
+// send updates the totals and calls the callback, done is added to the overall bytes and size to the overall size
+func (p *progress) send(kind types.ProgressKind, state types.ProgressState, d types.Descriptor, cur, done, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.overall += done
+	p.overallSize += size
+	p.cb(types.Progress{
+		Kind:        kind,
+		State:       state,
+		Desc:        d,
+		Current:     cur,
+		Overall:     p.overall,
+		OverallSize: p.overallSize,
+	})
+}
+
+// blobSkipped reports a blob that already exists on the target
+func (p *progress) blobSkipped(d types.Descriptor) {
+	p.send(types.ProgressBlob, types.ProgressSkipped, d, d.Size, d.Size, d.Size)
+}
+
+// manifest reports a manifest that was pushed or written, or skipped when already on the target
+func (p *progress) manifest(d types.Descriptor, skipped bool) {
+	state := types.ProgressFinished
+	if skipped {
+		state = types.ProgressSkipped
+	}
+	p.send(types.ProgressManifest, state, d, d.Size, 0, 0)
+}
+
+// reader wraps a blob reader to report the bytes transferred, finish must be called after a successful transfer
+func (p *progress) reader(d types.Descriptor, r io.Reader) *progressReader {
+	pr := &progressReader{p: p, d: d, r: r}
+	p.send(types.ProgressBlob, types.ProgressStarted, d, 0, 0, d.Size)
+	return pr
+}
+
+type progressReader struct {
+	p   *progress
+	d   types.Descriptor
+	r   io.Reader
+	cur int64
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.cur += int64(n)
+		pr.p.send(types.ProgressBlob, types.ProgressActive, pr.d, pr.cur, int64(n), 0)
+	}
+	return n, err
+}
+
+// Seek passes through to the wrapped reader, adjusting the bytes transferred
+func (pr *progressReader) Seek(offset int64, whence int) (int64, error) {
+	rs, ok := pr.r.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("reader does not support seek: %w", types.ErrUnsupported)
+	}
+	pos, err := rs.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	pr.p.send(types.ProgressBlob, types.ProgressActive, pr.d, pos, pos-pr.cur, 0)
+	pr.cur = pos
+	return pos, nil
+}
+
+// finish reports the completed blob, the size is added to the total when it was unknown at the start
+func (pr *progressReader) finish() {
+	var size int64
+	if pr.d.Size <= 0 {
+		size = pr.cur
+	}
+	pr.p.send(types.ProgressBlob, types.ProgressFinished, pr.d, pr.cur, 0, size)
+}
@@ -15,6 +15,7 @@ import (
 
 	dockercfg "github.com/docker/cli/cli/config"
 	"github.com/regclient/regclient/config"
+	"github.com/regclient/regclient/internal/blobcache"
 	"github.com/regclient/regclient/internal/rwfs"
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/scheme/ocidir"
@@ -51,8 +52,12 @@ func init() {
 
 // RegClient is used to access OCI distribution-spec registries
 type RegClient struct {
-	hosts map[string]*config.Host
-	log   *logrus.Logger
+	blobCache    *blobcache.Cache
+	blobCacheDir string
+	blobCacheMax int64
+	blobLocs     *blobLocations
+	hosts        map[string]*config.Host
+	log          *logrus.Logger
 	// mu        sync.Mutex
 	regOpts   []reg.Opts
 	schemes   map[string]scheme.API
@@ -102,6 +107,10 @@ func New(opts ...Opt) *RegClient {
 		reg.WithUserAgent(rc.userAgent),
 	)
 
+	if rc.blobCacheDir != "" {
+		rc.blobCache = blobcache.New(rc.fs, rc.blobCacheDir, rc.blobCacheMax)
+	}
+
 	// setup scheme's
 	rc.schemes["reg"] = reg.New(rc.regOpts...)
 	rc.schemes["ocidir"] = ocidir.New(
@@ -186,6 +195,26 @@ func WithConfigHost(configHost config.Host) Opt {
 	return WithConfigHosts([]config.Host{configHost})
 }
 
+// WithBlobCache stores blobs and manifests pulled by digest from registries in a local directory.
+// Content is verified before it is cached and read from the cache before contacting the registry.
+// When maxSize bytes is exceeded, the least recently used content is removed, a maxSize <= 0 disables the limit.
+func WithBlobCache(dir string, maxSize int64) Opt {
+	return func(rc *RegClient) {
+		rc.blobCacheDir = dir
+		rc.blobCacheMax = maxSize
+	}
+}
+
+// WithBlobLocationCache tracks the repositories known to hold each blob on a registry.
+// Before uploading a blob, a cross repository mount is attempted from a known repository.
+// The cache is held in memory, up to 5 repositories are tracked for each digest,
+// and the least recently used digests are removed after 10000 digests.
+func WithBlobLocationCache() Opt {
+	return func(rc *RegClient) {
+		rc.blobLocs = newBlobLocations()
+	}
+}
+
 // WithBlobSize overrides default blob sizes
 func WithBlobSize(chunk, max int64) Opt {
 	return func(rc *RegClient) {
@@ -3,6 +3,8 @@ package reg
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -150,3 +152,42 @@ func WithUserAgent(ua string) Opts {
 		r.reghttpOpts = append(r.reghttpOpts, reghttp.WithUserAgent(ua))
 	}
 }
+
+// linkNext returns the url from the rel="next" Link header (RFC 5988) resolved against the request url, or nil for the last page.
+// Links that cannot be parsed are skipped.
+func linkNext(h http.Header, base *url.URL) *url.URL {
+	for _, lh := range h.Values("Link") {
+		for _, link := range strings.Split(lh, ",") {
+			parts := strings.Split(link, ";")
+			uri := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(uri, "<") || !strings.HasSuffix(uri, ">") {
+				continue
+			}
+			isNext := false
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				// rel may be a quoted list of space separated relation types
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						isNext = true
+					}
+				}
+			}
+			if !isNext {
+				continue
+			}
+			u, err := url.Parse(uri[1 : len(uri)-1])
+			if err != nil {
+				continue
+			}
+			if base != nil {
+				u = base.ResolveReference(u)
+			}
+			return u
+		}
+	}
+	return nil
+}
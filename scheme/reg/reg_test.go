@@ -1,5 +1,92 @@
 package reg
 
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestLinkNext(t *testing.T) {
+	base, err := url.Parse("https://registry.example.org/v2/repo/tags/list?n=2")
+	if err != nil {
+		t.Fatalf("failed to parse base url: %v", err)
+	}
+	tests := []struct {
+		name   string
+		links  []string
+		expURL string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:   "relative",
+			links:  []string{`</v2/repo/tags/list?last=b&n=2>; rel="next"`},
+			expURL: "https://registry.example.org/v2/repo/tags/list?last=b&n=2",
+		},
+		{
+			name:   "relative path",
+			links:  []string{`<list?last=b&n=2>; rel="next"`},
+			expURL: "https://registry.example.org/v2/repo/tags/list?last=b&n=2",
+		},
+		{
+			name:   "relative prefix",
+			links:  []string{`</v2/mirror/repo/tags/list?last=b&n=2>; rel="next"`},
+			expURL: "https://registry.example.org/v2/mirror/repo/tags/list?last=b&n=2",
+		},
+		{
+			name:   "absolute",
+			links:  []string{`<https://registry.example.com/v2/repo/tags/list?last=c&n=2>; rel=next`},
+			expURL: "https://registry.example.com/v2/repo/tags/list?last=c&n=2",
+		},
+		{
+			name:   "multiple",
+			links:  []string{`</v2/repo/tags/list?n=2>; rel="first", </v2/repo/tags/list?last=d&n=2>; rel="prefetch next"`},
+			expURL: "https://registry.example.org/v2/repo/tags/list?last=d&n=2",
+		},
+		{
+			name:   "multiple headers",
+			links:  []string{`</v2/repo/tags/list?n=2>; rel="first"`, `</v2/repo/tags/list?last=e&n=2>; rel="next"`},
+			expURL: "https://registry.example.org/v2/repo/tags/list?last=e&n=2",
+		},
+		{
+			name:  "no next",
+			links: []string{`</v2/repo/tags/list?n=2>; rel="prev"`},
+		},
+		{
+			name:  "invalid",
+			links: []string{`/v2/repo/tags/list?last=b; rel="next"`},
+		},
+		{
+			name:  "invalid url",
+			links: []string{`<http://[::1%en0/v2/repo/tags/list?last=b>; rel="next"`},
+		},
+		{
+			name:   "invalid skipped",
+			links:  []string{`/v2/repo/tags/list?last=b; rel="next"`, `</v2/repo/tags/list?last=f&n=2>; rel="next"`},
+			expURL: "https://registry.example.org/v2/repo/tags/list?last=f&n=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for _, l := range tt.links {
+				h.Add("Link", l)
+			}
+			next := linkNext(h, base)
+			if tt.expURL == "" {
+				if next != nil {
+					t.Errorf("unexpected next: %v", next)
+				}
+				return
+			}
+			if next == nil || next.String() != tt.expURL {
+				t.Errorf("unexpected next, expected %s, received %v", tt.expURL, next)
+			}
+		})
+	}
+}
+
 func stringSliceCmp(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -2,6 +2,7 @@ package reg
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -14,7 +15,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// RepoList returns a list of repositories on a registry
+// RepoList returns a list of repositories on a registry.
+// Without the limit or last options, every page is requested by following the Link header.
 // Note the underlying "_catalog" API is not supported on many cloud registries
 func (reg *Reg) RepoList(ctx context.Context, hostname string, opts ...scheme.RepoOpts) (*repo.RepoList, error) {
 	config := scheme.RepoConfig{}
@@ -29,7 +31,45 @@ func (reg *Reg) RepoList(ctx context.Context, hostname string, opts ...scheme.Re
 	if config.Limit > 0 {
 		query.Set("n", strconv.Itoa(config.Limit))
 	}
+	rl, next, err := reg.repoListPage(ctx, hostname, query, nil)
+	if err != nil || next == nil || config.Limit > 0 || config.Last != "" {
+		return rl, err
+	}
+
+	merged := repo.RepoRegistryList{Repositories: rl.Repositories}
+	seen := map[string]bool{}
+	for next != nil {
+		if seen[next.String()] {
+			reg.log.WithFields(logrus.Fields{
+				"host": hostname,
+				"next": next.String(),
+			}).Warn("Repo list repeated a page, stopping")
+			break
+		}
+		seen[next.String()] = true
+		var page *repo.RepoList
+		page, next, err = reg.repoListPage(ctx, hostname, nil, next)
+		if err != nil {
+			return nil, err
+		}
+		merged.Repositories = append(merged.Repositories, page.Repositories...)
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	headers, _ := rl.RawHeaders()
+	return repo.New(
+		repo.WithMT("application/json"),
+		repo.WithRaw(raw),
+		repo.WithHost(hostname),
+		repo.WithHeaders(headers),
+	)
+}
 
+// repoListPage requests a single page of repositories, returning the url for the next page from the Link header.
+// When link is set, that url is requested instead of building one from the query.
+func (reg *Reg) repoListPage(ctx context.Context, hostname string, query url.Values, link *url.URL) (*repo.RepoList, *url.URL, error) {
 	headers := http.Header{
 		"Accept": []string{"application/json"},
 	}
@@ -38,21 +78,22 @@ func (reg *Reg) RepoList(ctx context.Context, hostname string, opts ...scheme.Re
 		NoMirrors: true,
 		APIs: map[string]reghttp.ReqAPI{
 			"": {
-				Method:   "GET",
-				Path:     "_catalog",
-				NoPrefix: true,
-				Query:    query,
-				Headers:  headers,
+				Method:    "GET",
+				DirectURL: link,
+				Path:      "_catalog",
+				NoPrefix:  true,
+				Query:     query,
+				Headers:   headers,
 			},
 		},
 	}
 	resp, err := reg.reghttp.Do(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list repositories for %s: %w", hostname, err)
+		return nil, nil, fmt.Errorf("failed to list repositories for %s: %w", hostname, err)
 	}
 	defer resp.Close()
 	if resp.HTTPResponse().StatusCode != 200 {
-		return nil, fmt.Errorf("failed to list repositories for %s: %w", hostname, reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+		return nil, nil, fmt.Errorf("failed to list repositories for %s: %w", hostname, reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
 
 	respBody, err := ioutil.ReadAll(resp)
@@ -61,7 +102,7 @@ func (reg *Reg) RepoList(ctx context.Context, hostname string, opts ...scheme.Re
 			"err":  err,
 			"host": hostname,
 		}).Warn("Failed to read repo list")
-		return nil, fmt.Errorf("failed to read repo list for %s: %w", hostname, err)
+		return nil, nil, fmt.Errorf("failed to read repo list for %s: %w", hostname, err)
 	}
 	mt := resp.HTTPResponse().Header.Get("Content-Type")
 	rl, err := repo.New(
@@ -76,7 +117,7 @@ func (reg *Reg) RepoList(ctx context.Context, hostname string, opts ...scheme.Re
 			"body": string(respBody),
 			"host": hostname,
 		}).Warn("Failed to unmarshal repo list")
-		return nil, fmt.Errorf("failed to parse repo list for %s: %w", hostname, err)
+		return nil, nil, fmt.Errorf("failed to parse repo list for %s: %w", hostname, err)
 	}
-	return rl, nil
+	return rl, linkNext(resp.HTTPResponse().Header, resp.HTTPResponse().Request.URL), nil
 }
@@ -131,6 +131,40 @@ func TestRepo(t *testing.T) {
 				},
 			},
 		},
+		"linked": {
+			{
+				ReqEntry: reqresp.ReqEntry{
+					Name:   "Linked remainder",
+					Method: "GET",
+					Path:   "/v2/_catalog",
+					Query: map[string][]string{
+						"last": {listRegistry[partialLen-1]},
+					},
+				},
+				RespEntry: reqresp.RespEntry{
+					Status: http.StatusOK,
+					Body:   []byte(fmt.Sprintf(`{"repositories":["%s"]}`, strings.Join(listRegistry[partialLen:], `","`))),
+					Headers: http.Header{
+						"Content-Type": {"text/plain; charset=utf-8"},
+					},
+				},
+			},
+			{
+				ReqEntry: reqresp.ReqEntry{
+					Name:   "Linked first",
+					Method: "GET",
+					Path:   "/v2/_catalog",
+				},
+				RespEntry: reqresp.RespEntry{
+					Status: http.StatusOK,
+					Body:   []byte(fmt.Sprintf(`{"repositories":["%s"]}`, strings.Join(listRegistry[:partialLen], `","`))),
+					Headers: http.Header{
+						"Content-Type": {"text/plain; charset=utf-8"},
+						"Link":         {fmt.Sprintf(`</v2/_catalog?last=%s&n=%d>; rel="next"`, url.QueryEscape(listRegistry[partialLen-1]), partialLen)},
+					},
+				},
+			},
+		},
 	}
 	tss := map[string]*httptest.Server{}
 	rcHosts := []*config.Host{}
@@ -193,6 +227,22 @@ func TestRepo(t *testing.T) {
 			t.Errorf("repositories do not match: expected %v, received %v", listRegistry, rlRepos)
 		}
 	})
+	// pages from the link header are merged
+	t.Run("Linked", func(t *testing.T) {
+		u, _ := url.Parse(tss["linked"].URL)
+		host := u.Host
+		rl, err := reg.RepoList(ctx, host)
+		if err != nil {
+			t.Errorf("error listing repos: %v", err)
+			return
+		}
+		rlRepos, err := rl.GetRepos()
+		if err != nil {
+			t.Errorf("error retrieving repos: %v", err)
+		} else if stringSliceCmp(listRegistry, rlRepos) == false {
+			t.Errorf("repositories do not match: expected %v, received %v", listRegistry, rlRepos)
+		}
+	})
 	// test with options
 	t.Run("Pagenation", func(t *testing.T) {
 		u, _ := url.Parse(tss["registry"].URL)
@@ -165,13 +165,96 @@ func (reg *Reg) TagDelete(ctx context.Context, r ref.Ref) error {
 	return nil
 }
 
-// TagList returns a listing to tags from the repository
+// TagList returns a listing to tags from the repository.
+// Without the limit or last options, every page is requested by following the Link header,
+// and the tags from each page are merged into a single list.
 func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts) (*tag.List, error) {
 	var config scheme.TagConfig
 	for _, opt := range opts {
 		opt(&config)
 	}
+	if config.Limit > 0 || config.Last != "" {
+		tl, _, err := reg.tagListPage(ctx, r, tagListQuery(config), nil)
+		return tl, err
+	}
+
+	var tlFirst *tag.List
+	merged := struct {
+		tag.DockerList
+		tag.GCRList
+	}{}
+	pages := 0
+	err := reg.TagListIter(ctx, r, func(tl *tag.List) error {
+		if tlFirst == nil {
+			tlFirst = tl
+		}
+		pages++
+		merged.Name = tl.Name
+		merged.Tags = append(merged.Tags, tl.Tags...)
+		merged.Children = append(merged.Children, tl.Children...)
+		for k, v := range tl.Manifests {
+			if merged.Manifests == nil {
+				merged.Manifests = map[string]tag.GCRManifestInfo{}
+			}
+			merged.Manifests[k] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pages == 1 {
+		return tlFirst, nil
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	headers, _ := tlFirst.RawHeaders()
+	return tag.New(
+		tag.WithMT("application/json"),
+		tag.WithRaw(raw),
+		tag.WithRef(r),
+		tag.WithHeaders(headers),
+	)
+}
 
+// TagListIter calls fn with each page of tags from the repository,
+// following the Link header to request the next page.
+// The limit option sets the page size and the last option sets the starting point.
+func (reg *Reg) TagListIter(ctx context.Context, r ref.Ref, fn func(*tag.List) error, opts ...scheme.TagOpts) error {
+	var config scheme.TagConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	query := tagListQuery(config)
+	var link *url.URL
+	seen := map[string]bool{}
+	for {
+		tl, next, err := reg.tagListPage(ctx, r, query, link)
+		if err != nil {
+			return err
+		}
+		err = fn(tl)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		if seen[next.String()] {
+			reg.log.WithFields(logrus.Fields{
+				"ref":  r.CommonName(),
+				"next": next.String(),
+			}).Warn("Tag list repeated a page, stopping")
+			return nil
+		}
+		seen[next.String()] = true
+		link = next
+	}
+}
+
+func tagListQuery(config scheme.TagConfig) url.Values {
 	query := url.Values{}
 	if config.Last != "" {
 		query.Set("last", config.Last)
@@ -179,6 +262,12 @@ func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts)
 	if config.Limit > 0 {
 		query.Set("n", strconv.Itoa(config.Limit))
 	}
+	return query
+}
+
+// tagListPage requests a single page of tags, returning the url for the next page from the Link header.
+// When link is set, that url is requested instead of building one from the query.
+func (reg *Reg) tagListPage(ctx context.Context, r ref.Ref, query url.Values, link *url.URL) (*tag.List, *url.URL, error) {
 	headers := http.Header{
 		"Accept": []string{"application/json"},
 	}
@@ -187,6 +276,7 @@ func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts)
 		APIs: map[string]reghttp.ReqAPI{
 			"": {
 				Method:     "GET",
+				DirectURL:  link,
 				Repository: r.Repository,
 				Path:       "tags/list",
 				Query:      query,
@@ -196,11 +286,11 @@ func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts)
 	}
 	resp, err := reg.reghttp.Do(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list tags for %s: %w", r.CommonName(), err)
+		return nil, nil, fmt.Errorf("failed to list tags for %s: %w", r.CommonName(), err)
 	}
 	defer resp.Close()
 	if resp.HTTPResponse().StatusCode != 200 {
-		return nil, fmt.Errorf("failed to list tags for %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
+		return nil, nil, fmt.Errorf("failed to list tags for %s: %w", r.CommonName(), reghttp.HTTPError(resp.HTTPResponse().StatusCode))
 	}
 	respBody, err := ioutil.ReadAll(resp)
 	if err != nil {
@@ -208,7 +298,7 @@ func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts)
 			"err": err,
 			"ref": r.CommonName(),
 		}).Warn("Failed to read tag list")
-		return nil, fmt.Errorf("failed to read tags for %s: %w", r.CommonName(), err)
+		return nil, nil, fmt.Errorf("failed to read tags for %s: %w", r.CommonName(), err)
 	}
 	mt := resp.HTTPResponse().Header.Get("Content-Type")
 	tl, err := tag.New(
@@ -223,8 +313,7 @@ func (reg *Reg) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagOpts)
 			"body": respBody,
 			"ref":  r.CommonName(),
 		}).Warn("Failed to unmarshal tag list")
-		return tl, fmt.Errorf("failed to unmarshal tag list for %s: %w", r.CommonName(), err)
+		return tl, nil, fmt.Errorf("failed to unmarshal tag list for %s: %w", r.CommonName(), err)
 	}
-
-	return tl, nil
+	return tl, linkNext(resp.HTTPResponse().Header, resp.HTTPResponse().Request.URL), nil
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/regclient/regclient/scheme"
 	"github.com/regclient/regclient/types"
 	"github.com/regclient/regclient/types/ref"
+	"github.com/regclient/regclient/types/tag"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,6 +37,11 @@ func TestTag(t *testing.T) {
 	listTagBody2 := []byte(fmt.Sprintf("{\"name\":\"%s\",\"tags\":[\"%s\"]}",
 		strings.TrimLeft(repoPath, "/"),
 		strings.Join(listTagList[pageLen:], "\",\"")))
+	linkedRepo := "/linked"
+	linkedTagList := []string{"a", "b", "c", "d", "e"}
+	linkedBody := func(tags []string) []byte {
+		return []byte(fmt.Sprintf(`{"name":"%s","tags":["%s"]}`, strings.TrimLeft(linkedRepo, "/"), strings.Join(tags, `","`)))
+	}
 	missingRepo := "/missing"
 	delOCITag := "del-oci"
 	delFallbackTag := "del-fallback"
@@ -97,6 +103,56 @@ func TestTag(t *testing.T) {
 				Body: listTagBody,
 			},
 		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "linked page 3",
+				Method: "GET",
+				Path:   "/v2" + linkedRepo + "/tags/list",
+				Query: map[string][]string{
+					"last": {"d"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Type": {"application/json"},
+				},
+				Body: linkedBody(linkedTagList[4:]),
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "linked page 2",
+				Method: "GET",
+				Path:   "/v2" + linkedRepo + "/tags/list",
+				Query: map[string][]string{
+					"last": {"b"},
+				},
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Type": {"application/json"},
+					"Link":         {`<list?last=d&n=2>; rel="next"`},
+				},
+				Body: linkedBody(linkedTagList[2:4]),
+			},
+		},
+		{
+			ReqEntry: reqresp.ReqEntry{
+				Name:   "linked page 1",
+				Method: "GET",
+				Path:   "/v2" + linkedRepo + "/tags/list",
+			},
+			RespEntry: reqresp.RespEntry{
+				Status: http.StatusOK,
+				Headers: http.Header{
+					"Content-Type": {"application/json"},
+					"Link":         {`</v2/linked/tags/list?last=b&n=2>; rel="next"`},
+				},
+				Body: linkedBody(linkedTagList[:2]),
+			},
+		},
 		{
 			ReqEntry: reqresp.ReqEntry{
 				Name:   "tag missing",
@@ -247,6 +303,61 @@ func TestTag(t *testing.T) {
 			t.Errorf("returned list mismatch, expected %v, received %v", listTagList, tags)
 		}
 	})
+	// list tags following the link header
+	t.Run("Linked", func(t *testing.T) {
+		listRef, err := ref.New(tsURL.Host + linkedRepo)
+		if err != nil {
+			t.Fatalf("failed creating ref: %v", err)
+		}
+		tl, err := reg.TagList(ctx, listRef)
+		if err != nil {
+			t.Fatalf("failed to list tags: %v", err)
+		}
+		tags, err := tl.GetTags()
+		if err != nil {
+			t.Fatalf("failed to extract tag list: %v", err)
+		}
+		if !stringSliceCmp(tags, linkedTagList) {
+			t.Errorf("returned list mismatch, expected %v, received %v", linkedTagList, tags)
+		}
+		// an explicit limit only returns the first page
+		tl, err = reg.TagList(ctx, listRef, scheme.WithTagLimit(2))
+		if err != nil {
+			t.Fatalf("failed to list tags: %v", err)
+		}
+		tags, _ = tl.GetTags()
+		if !stringSliceCmp(tags, linkedTagList[:2]) {
+			t.Errorf("returned list mismatch, expected %v, received %v", linkedTagList[:2], tags)
+		}
+	})
+	t.Run("ListIter", func(t *testing.T) {
+		listRef, err := ref.New(tsURL.Host + linkedRepo)
+		if err != nil {
+			t.Fatalf("failed creating ref: %v", err)
+		}
+		pages := [][]string{}
+		err = reg.TagListIter(ctx, listRef, func(tl *tag.List) error {
+			tags, err := tl.GetTags()
+			pages = append(pages, tags)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to iterate tags: %v", err)
+		}
+		if len(pages) != 3 || !stringSliceCmp(pages[0], linkedTagList[:2]) || !stringSliceCmp(pages[1], linkedTagList[2:4]) || !stringSliceCmp(pages[2], linkedTagList[4:]) {
+			t.Errorf("unexpected pages: %v", pages)
+		}
+		// errors from the callback stop the iteration
+		errStop := errors.New("stop")
+		count := 0
+		err = reg.TagListIter(ctx, listRef, func(tl *tag.List) error {
+			count++
+			return errStop
+		})
+		if !errors.Is(err, errStop) || count != 1 {
+			t.Errorf("unexpected result from stopped iteration: count %d, err %v", count, err)
+		}
+	})
 	// list tags with pagenation
 	t.Run("Pagenation", func(t *testing.T) {
 		listRef, err := ref.New(tsURL.Host + repoPath)
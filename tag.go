@@ -8,6 +8,10 @@ import (
 	"github.com/regclient/regclient/types/tag"
 )
 
+type tagIterator interface {
+	TagListIter(ctx context.Context, r ref.Ref, fn func(*tag.List) error, opts ...scheme.TagOpts) error
+}
+
 // TagDelete deletes a tag from the registry. Since there's no API for this,
 // you'd want to normally just delete the manifest. However multiple tags may
 // point to the same manifest, so instead you must:
@@ -30,3 +34,22 @@ func (rc *RegClient) TagList(ctx context.Context, r ref.Ref, opts ...scheme.TagO
 	}
 	return schemeAPI.TagList(ctx, r, opts...)
 }
+
+// TagListIter calls fn with each page of tags from a repository.
+// Pages are requested following the registry Link header, so the full list is never held in memory.
+// The limit option sets the page size and the last option sets the starting point.
+// Schemes without pagination call fn once with the full list.
+func (rc *RegClient) TagListIter(ctx context.Context, r ref.Ref, fn func(*tag.List) error, opts ...scheme.TagOpts) error {
+	schemeAPI, err := rc.schemeGet(r.Scheme)
+	if err != nil {
+		return err
+	}
+	if ti, ok := schemeAPI.(tagIterator); ok {
+		return ti.TagListIter(ctx, r, fn, opts...)
+	}
+	tl, err := schemeAPI.TagList(ctx, r, opts...)
+	if err != nil {
+		return err
+	}
+	return fn(tl)
+}
@@ -40,6 +40,10 @@ type Descriptor struct {
 	// Platform describes the platform which the image in the manifest runs on.
 	// This should only be used when referring to a manifest.
 	Platform *platform.Platform `json:"platform,omitempty"`
+
+	// ArtifactType is the artifactType of the referenced manifest.
+	// This should only be used when referring to a manifest.
+	ArtifactType string `json:"artifactType,omitempty"`
 }
 
 var emptyDigest = digest.FromBytes([]byte{})
@@ -91,6 +95,9 @@ func (d Descriptor) MarshalPrettyTW(tw *tabwriter.Writer, prefix string) error {
 			fmt.Fprintf(tw, "%sOSFeatures:\t%s\n", prefix, strings.Join(p.OSFeatures, ", "))
 		}
 	}
+	if d.ArtifactType != "" {
+		fmt.Fprintf(tw, "%sArtifactType:\t%s\n", prefix, d.ArtifactType)
+	}
 	if len(d.URLs) > 0 {
 		fmt.Fprintf(tw, "%sURLs:\t%s\n", prefix, strings.Join(d.URLs, ", "))
 	}
@@ -9,6 +9,8 @@ var (
 	ErrAPINotFound = errors.New("API not found")
 	// ErrBackoffLimit maximum backoff attempts reached
 	ErrBackoffLimit = errors.New("backoff limit reached")
+	// ErrBaseUnavailable when the base image cannot be retrieved
+	ErrBaseUnavailable = errors.New("base image is unavailable")
 	// ErrCanceled if the context was canceled
 	ErrCanceled = errors.New("context was canceled")
 	// ErrDigestMismatch if the expected digest wasn't received
@@ -19,6 +21,10 @@ var (
 	ErrHTTPStatus = errors.New("unexpected http status code")
 	// ErrInvalidChallenge indicates an issue with the received challenge in the WWW-Authenticate header
 	ErrInvalidChallenge = errors.New("invalid challenge header")
+	// ErrMismatch if the content does not match the expected value
+	ErrMismatch = errors.New("content does not match")
+	// ErrMissingAnnotation returned when a required annotation is not found
+	ErrMissingAnnotation = errors.New("annotation is missing")
 	// ErrMissingDigest returned when image reference does not include a digest
 	ErrMissingDigest = errors.New("digest missing from image reference")
 	// ErrMissingLocation returned when the location header is missing
@@ -0,0 +1,61 @@
+package types
+
+// ProgressKind identifies the content in a progress update
+type ProgressKind int
+
+const (
+	// ProgressBlob is a layer, config, or other blob
+	ProgressBlob ProgressKind = iota
+	// ProgressManifest is a manifest or index
+	ProgressManifest
+)
+
+// String returns the name of the kind
+func (k ProgressKind) String() string {
+	switch k {
+	case ProgressBlob:
+		return "blob"
+	case ProgressManifest:
+		return "manifest"
+	}
+	return "unknown"
+}
+
+// ProgressState is the status of the content in a progress update
+type ProgressState int
+
+const (
+	// ProgressStarted is sent before the first byte is transferred
+	ProgressStarted ProgressState = iota
+	// ProgressActive is sent as bytes are transferred
+	ProgressActive
+	// ProgressSkipped is sent when the content already exists or was mounted on the target
+	ProgressSkipped
+	// ProgressFinished is sent when the transfer completes
+	ProgressFinished
+)
+
+// String returns the name of the state
+func (s ProgressState) String() string {
+	switch s {
+	case ProgressStarted:
+		return "started"
+	case ProgressActive:
+		return "active"
+	case ProgressSkipped:
+		return "skipped"
+	case ProgressFinished:
+		return "finished"
+	}
+	return "unknown"
+}
+
+// Progress is passed to progress callbacks while content is transferred
+type Progress struct {
+	Kind        ProgressKind
+	State       ProgressState
+	Desc        Descriptor
+	Current     int64 // bytes transferred for this descriptor
+	Overall     int64 // bytes transferred or skipped for every blob
+	OverallSize int64 // size of every blob seen so far
+}